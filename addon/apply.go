@@ -0,0 +1,118 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jwilder/k3a/pkg/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// fieldManager owns the fields k3a sets through server-side apply
+const fieldManager = "k3a"
+
+// clients talks to the cluster API with typed and dynamic clients
+type clients struct {
+	kube    kubernetes.Interface
+	dynamic dynamic.Interface
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+}
+
+func connect(ctx context.Context, cluster string, cred *azidentity.DefaultAzureCredential) (*clients, error) {
+	kubeClient, config, err := kube.NewClient(ctx, cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	return &clients{
+		kube:    kubeClient,
+		dynamic: dynamicClient,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+	}, nil
+}
+
+// resource returns the dynamic client for an object's kind, waiting briefly for kinds defined by
+// CRDs applied earlier in the same manifest to be served
+func (c *clients) resource(ctx context.Context, gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	var mapping *meta.RESTMapping
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err == nil || !meta.IsNoMatchError(err) {
+			break
+		}
+		c.mapper.Reset()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(3 * time.Second):
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown kind %s: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource), nil
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// apply server-side applies an object and returns a reference to it
+func (c *clients) apply(ctx context.Context, obj *unstructured.Unstructured) (objectRef, error) {
+	ref := objectRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	client, err := c.resource(ctx, obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return ref, err
+	}
+	if _, err := client.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return ref, fmt.Errorf("failed to apply %s '%s': %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return ref, nil
+}
+
+// delete removes a previously applied object, ignoring objects and kinds that are already gone
+func (c *clients) delete(ctx context.Context, ref objectRef) error {
+	gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unknown kind %s: %w", gvk, err)
+	}
+	var client dynamic.ResourceInterface = c.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		client = c.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	policy := metav1.DeletePropagationBackground
+	err = client.Delete(ctx, ref.Name, metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s '%s': %w", ref.Kind, ref.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package addon
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	k3acluster "github.com/jwilder/k3a/cluster"
+	"github.com/jwilder/k3a/pkg/storage"
+	"github.com/jwilder/k3a/pkg/version"
+	"github.com/jwilder/k3a/pool"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// networkContributorRole is the built-in Network Contributor role
+const networkContributorRole = "4d97b98b-1d4f-4787-a291-c67834d212e7"
+
+//go:embed manifests/*.yaml
+var manifestFS embed.FS
+
+// Addon is an in-cluster component k3a can install from an embedded, version-pinned manifest
+type Addon struct {
+	Name        string
+	Version     string
+	Description string
+	manifest    string
+	roles       []string // Role definition GUIDs the cluster managed identity is granted on the resource group
+}
+
+// catalog lists the available addons. Bumping an addon's version means replacing its manifest.
+var catalog = []Addon{
+	{Name: "cert-manager", Version: "1.18.2", Description: "Certificates from ACME and other issuers, with CRDs and webhook", manifest: "manifests/cert-manager.yaml"},
+	{Name: "etcd-backup", Version: "1.0.0", Description: "Scheduled etcd snapshots to the cluster storage account", manifest: "manifests/etcd-backup.yaml"},
+	{Name: "ingress-nginx", Version: "1.11.0", Description: "NGINX ingress controller behind a LoadBalancer Service (needs loadbalancer-controller)", manifest: "manifests/ingress-nginx.yaml"},
+	{Name: "loadbalancer-controller", Version: releaseVersion(), Description: "In-cluster 'k3a loadbalancer sync' for Services of type LoadBalancer", manifest: "manifests/loadbalancer-controller.yaml", roles: []string{networkContributorRole}},
+	{Name: "local-path-provisioner", Version: "0.0.30", Description: "local-path StorageClass backed by node disks", manifest: "manifests/local-path-provisioner.yaml"},
+	{Name: "metrics-server", Version: "0.9.0", Description: "Resource metrics for kubectl top and autoscaling", manifest: "manifests/metrics-server.yaml"},
+}
+
+// imageRepository holds the k3a release images, tagged with the release version
+const imageRepository = "ghcr.io/jwilder/k3a"
+
+// releaseVersion is the version of addons that run the k3a image: the CLI's release, or "dev"
+func releaseVersion() string {
+	if v := version.Get(); v != "" {
+		return v
+	}
+	return "dev"
+}
+
+func findAddon(name string) (Addon, error) {
+	var names []string
+	for _, a := range catalog {
+		if a.Name == name {
+			return a, nil
+		}
+		names = append(names, a.Name)
+	}
+	sort.Strings(names)
+	return Addon{}, fmt.Errorf("unknown addon '%s' (available: %s)", name, strings.Join(names, ", "))
+}
+
+// templateValues is the data addon manifests are rendered with. Manifests read cluster data from the
+// fields and user settings from --set through the value function: {{ value "replicas" "1" }}.
+type templateValues struct {
+	SubscriptionID   string
+	Cluster          string
+	Location         string
+	PodCIDR          string
+	ServiceCIDR      string
+	PodCIDRv6        string // IPv6 pod range of dual-stack clusters; empty otherwise
+	ServiceCIDRv6    string // IPv6 service range of dual-stack clusters; empty otherwise
+	StorageAccount   string
+	EtcdScript       string
+	IdentityClientID string // client ID of the cluster managed identity, for workloads that use it through IMDS
+	K3aImage         string // k3a release image matching this CLI; empty for development builds
+}
+
+// clusterValues collects the cluster data available to addon manifests
+func clusterValues(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (templateValues, error) {
+	values := templateValues{
+		SubscriptionID: subscriptionID,
+		Cluster:        cluster,
+		StorageAccount: storage.AccountName(cluster),
+		EtcdScript:     k3acluster.EtcdScript,
+	}
+	if v := version.Get(); v != "" {
+		values.K3aImage = imageRepository + ":" + v
+	}
+	rgClient, err := armresources.NewResourceGroupsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return values, fmt.Errorf("failed to create resource groups client: %w", err)
+	}
+	rg, err := rgClient.Get(ctx, cluster, nil)
+	if err != nil {
+		return values, fmt.Errorf("failed to get resource group '%s': %w", cluster, err)
+	}
+	if rg.Location != nil {
+		values.Location = *rg.Location
+	}
+	cidrs, err := pool.GetClusterCIDRs(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return values, err
+	}
+	values.PodCIDR, values.ServiceCIDR = cidrs.Pod, cidrs.Service
+	values.PodCIDRv6, values.ServiceCIDRv6 = cidrs.PodV6, cidrs.ServiceV6
+	identity, err := k3acluster.Identity(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return values, err
+	}
+	values.IdentityClientID = *identity.Properties.ClientID
+	return values, nil
+}
+
+// render executes the addon's manifest template and decodes the resulting objects
+func (a Addon) render(values templateValues, set map[string]string) ([]*unstructured.Unstructured, error) {
+	raw, err := manifestFS.ReadFile(a.manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded manifest for '%s': %w", a.Name, err)
+	}
+	used := make(map[string]bool)
+	tmpl, err := template.New(a.Name).Option("missingkey=error").Funcs(template.FuncMap{
+		"value": func(key, def string) string {
+			used[key] = true
+			if v, ok := set[key]; ok {
+				return v
+			}
+			return def
+		},
+		"required": func(msg, v string) (string, error) {
+			if v == "" {
+				return "", errors.New(msg)
+			}
+			return v, nil
+		},
+		"indent": func(spaces int, s string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+		},
+	}).Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest for '%s': %w", a.Name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("failed to render manifest for '%s': %w", a.Name, err)
+	}
+	for key := range set {
+		if !used[key] {
+			return nil, fmt.Errorf("addon '%s' has no setting '%s'", a.Name, key)
+		}
+	}
+
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(&buf, 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode manifest for '%s': %w", a.Name, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: obj})
+	}
+	return objects, nil
+}
@@ -0,0 +1,108 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	k3acluster "github.com/jwilder/k3a/cluster"
+)
+
+type InstallArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Name           string
+	Set            map[string]string // Addon settings, read by the manifest's value function
+}
+
+// Install renders an addon's manifest with cluster data, applies it through the API and records it.
+// Installing an addon again upgrades it and prunes objects the new manifest no longer has.
+func Install(args InstallArgs) error {
+	a, err := findAddon(args.Name)
+	if err != nil {
+		return err
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	values, err := clusterValues(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	objects, err := a.render(values, args.Set)
+	if err != nil {
+		return err
+	}
+	for _, role := range a.roles {
+		if err := k3acluster.GrantIdentityRole(ctx, args.SubscriptionID, args.Cluster, role, cred); err != nil {
+			return err
+		}
+	}
+	c, err := connect(ctx, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(ctx, c.kube)
+	if err != nil {
+		return err
+	}
+
+	previous, upgrade := state[a.Name]
+	applied := make([]objectRef, 0, len(objects))
+	// fail records every object this or an earlier install may have left behind, so a later install
+	// can prune them and remove can delete them
+	fail := func(err error) error {
+		if saveErr := saveRecord(ctx, c.kube, a.Name, &record{
+			Version:     a.Version,
+			Set:         args.Set,
+			InstalledAt: time.Now().UTC(),
+			Objects:     mergeRefs(applied, previous.Objects),
+			Failed:      true,
+		}); saveErr != nil {
+			fmt.Printf("Warning: failed to record addon '%s': %v\n", a.Name, saveErr)
+		}
+		return fmt.Errorf("install of addon '%s' stopped part way, run it again or remove the addon: %w", a.Name, err)
+	}
+	for _, obj := range objects {
+		ref, err := c.apply(ctx, obj)
+		if err != nil {
+			// The object may exist even though the apply failed
+			applied = append(applied, ref)
+			return fail(err)
+		}
+		applied = append(applied, ref)
+	}
+
+	// Prune what the previous version applied but this one doesn't
+	if upgrade {
+		keep := make(map[objectKey]bool)
+		for _, ref := range applied {
+			keep[ref.key()] = true
+		}
+		for i := len(previous.Objects) - 1; i >= 0; i-- {
+			if ref := previous.Objects[i]; !keep[ref.key()] {
+				if err := c.delete(ctx, ref); err != nil {
+					return fail(err)
+				}
+			}
+		}
+		if previous.Version != a.Version {
+			fmt.Printf("Upgraded addon '%s' from %s to %s\n", a.Name, previous.Version, a.Version)
+		}
+	}
+
+	if err := saveRecord(ctx, c.kube, a.Name, &record{
+		Version:     a.Version,
+		Set:         args.Set,
+		InstalledAt: time.Now().UTC(),
+		Objects:     applied,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Addon '%s' %s installed (%d objects)\n", a.Name, a.Version, len(applied))
+	return nil
+}
@@ -0,0 +1,54 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/rodaine/table"
+)
+
+type ListArgs struct {
+	SubscriptionID string
+	Cluster        string
+}
+
+// List prints the available addons and which version of each is installed in the cluster
+func List(args ListArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	c, err := connect(ctx, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(ctx, c.kube)
+	if err != nil {
+		return err
+	}
+
+	tbl := table.New("NAME", "VERSION", "INSTALLED", "DESCRIPTION")
+	for _, a := range catalog {
+		installed := "-"
+		if r, ok := state[a.Name]; ok {
+			installed = r.Version
+			if r.Failed {
+				installed += " (failed)"
+			} else if r.Version != a.Version {
+				installed += " (upgrade available)"
+			}
+		}
+		tbl.AddRow(a.Name, a.Version, installed, a.Description)
+	}
+	// Addons dropped from the catalog can still be removed
+	for name, r := range state {
+		if _, err := findAddon(name); err != nil {
+			tbl.AddRow(name, "-", r.Version, "no longer available")
+		}
+	}
+	tbl.Print()
+	return nil
+}
@@ -0,0 +1,47 @@
+package addon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+type RemoveArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Name           string
+}
+
+// Remove deletes the objects recorded when the addon was installed, in reverse order
+func Remove(args RemoveArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	c, err := connect(ctx, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	state, err := loadState(ctx, c.kube)
+	if err != nil {
+		return err
+	}
+	r, ok := state[args.Name]
+	if !ok {
+		return fmt.Errorf("addon '%s' is not installed", args.Name)
+	}
+
+	for i := len(r.Objects) - 1; i >= 0; i-- {
+		if err := c.delete(ctx, r.Objects[i]); err != nil {
+			return err
+		}
+	}
+	if err := saveRecord(ctx, c.kube, args.Name, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Addon '%s' removed (%d objects deleted)\n", args.Name, len(r.Objects))
+	return nil
+}
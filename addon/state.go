@@ -0,0 +1,124 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// stateConfigMap in kube-system records the installed addons, one JSON record per addon
+const stateConfigMap = "k3a-addons"
+
+// objectRef identifies an object applied for an addon so it can be pruned or removed later
+type objectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// key identifies the object an objectRef points at; the same object can be applied with another API version
+type objectKey struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r objectRef) key() objectKey {
+	gvk := schema.FromAPIVersionAndKind(r.APIVersion, r.Kind)
+	return objectKey{Group: gvk.Group, Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}
+}
+
+// mergeRefs returns refs followed by the objects in previous that refs doesn't have
+func mergeRefs(refs, previous []objectRef) []objectRef {
+	merged := append([]objectRef{}, refs...)
+	seen := make(map[objectKey]bool)
+	for _, ref := range refs {
+		seen[ref.key()] = true
+	}
+	for _, ref := range previous {
+		if !seen[ref.key()] {
+			merged = append(merged, ref)
+		}
+	}
+	return merged
+}
+
+// record is what k3a remembers about an installed addon
+type record struct {
+	Version     string            `json:"version"`
+	Set         map[string]string `json:"set,omitempty"`
+	InstalledAt time.Time         `json:"installedAt"`
+	Objects     []objectRef       `json:"objects"`
+	// Failed is set when the last install stopped part way; Objects then holds everything that may exist
+	Failed bool `json:"failed,omitempty"`
+}
+
+// loadState returns the installed addons by name
+func loadState(ctx context.Context, client kubernetes.Interface) (map[string]record, error) {
+	state := make(map[string]record)
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceSystem).Get(ctx, stateConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s ConfigMap: %w", stateConfigMap, err)
+	}
+	for name, data := range cm.Data {
+		var r record
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, fmt.Errorf("invalid record for addon '%s' in %s ConfigMap: %w", name, stateConfigMap, err)
+		}
+		state[name] = r
+	}
+	return state, nil
+}
+
+// saveRecord stores an addon's record, or deletes it when r is nil
+func saveRecord(ctx context.Context, client kubernetes.Interface, name string, r *record) error {
+	configMaps := client.CoreV1().ConfigMaps(metav1.NamespaceSystem)
+	cm, err := configMaps.Get(ctx, stateConfigMap, metav1.GetOptions{})
+	create := apierrors.IsNotFound(err)
+	if err != nil && !create {
+		return fmt.Errorf("failed to read %s ConfigMap: %w", stateConfigMap, err)
+	}
+	if create {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      stateConfigMap,
+				Namespace: metav1.NamespaceSystem,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "k3a"},
+			},
+		}
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if r == nil {
+		delete(cm.Data, name)
+	} else {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		cm.Data[name] = string(data)
+	}
+
+	if create {
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s ConfigMap: %w", stateConfigMap, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+// NSG rules that scope inbound access to the API server and SSH. NSG rules see traffic after the load
+// balancer has translated it, so the SSH NAT range (50000-50100) arrives on the backend port 22.
+const (
+	apiServerAccessRule = "AllowAPIServerInbound"
+	sshAccessRule       = "AllowSSHInbound"
+	legacyCorpNetRule   = "AllowCorpNetPublic"
+)
+
+// SetAccessRangesArgs holds arguments for updating a cluster's authorized source ranges
+type SetAccessRangesArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Sources        []string // CIDRs, IP addresses or a single service tag; defaults to the caller's public IP
+}
+
+// SetAccessRanges replaces the sources allowed to reach the API server and SSH NAT pool
+func SetAccessRanges(args SetAccessRangesArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	sources, err := resolveAllowedSources(ctx, args.Sources)
+	if err != nil {
+		return err
+	}
+	if err := setAccessRules(ctx, args.SubscriptionID, args.Cluster, "k3a-nsg", sources, cred); err != nil {
+		return err
+	}
+	fmt.Printf("Inbound access to the API server and SSH limited to: %s\n", strings.Join(sources, ", "))
+
+	// Clusters created by older versions of k3a still carry an allow-all CorpNetPublic rule
+	rulesClient, err := armnetwork.NewSecurityRulesClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create security rules client: %w", err)
+	}
+	if _, err := rulesClient.Get(ctx, args.Cluster, "k3a-nsg", legacyCorpNetRule, nil); err == nil {
+		fmt.Printf("Note: rule '%s' still allows all traffic from CorpNetPublic; remove it with 'k3a nsg rule delete --name %s'\n", legacyCorpNetRule, legacyCorpNetRule)
+	}
+	return nil
+}
+
+// resolveAllowedSources validates the sources, defaulting to the caller's public IP when none are given
+func resolveAllowedSources(ctx context.Context, sources []string) ([]string, error) {
+	if len(sources) == 0 {
+		ip, err := getCallerPublicIP(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect your public IP, pass --allowed-source: %w", err)
+		}
+		fmt.Printf("No --allowed-source given, allowing your public IP %s\n", ip)
+		return []string{ip + "/32"}, nil
+	}
+
+	tags := 0
+	for _, source := range sources {
+		if _, _, err := net.ParseCIDR(source); err == nil {
+			continue
+		}
+		if net.ParseIP(source) != nil {
+			continue
+		}
+		if source == "*" {
+			continue
+		}
+		// Anything else is treated as a service tag such as AzureCloud or VirtualNetwork
+		tags++
+	}
+	if tags > 0 && len(sources) > 1 {
+		return nil, fmt.Errorf("a service tag can't be combined with other allowed sources in one NSG rule")
+	}
+	return sources, nil
+}
+
+// getCallerPublicIP returns the public IP the caller's traffic to Azure egresses from
+func getCallerPublicIP(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.ipify.org", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("unexpected response %q", string(body))
+	}
+	return ip.String(), nil
+}
+
+// setAccessRules creates or updates the API server and SSH inbound rules for the given sources
+func setAccessRules(ctx context.Context, subscriptionID, resourceGroup, nsgName string, sources []string, cred *azidentity.DefaultAzureCredential) error {
+	rulesClient, err := armnetwork.NewSecurityRulesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create security rules client: %w", err)
+	}
+
+	accessRules := []struct {
+		name     string
+		priority int32
+		port     string
+	}{
+		{apiServerAccessRule, 150, "6443"},
+		{sshAccessRule, 151, "22"},
+	}
+	for _, r := range accessRules {
+		props := &armnetwork.SecurityRulePropertiesFormat{
+			Priority:                 to.Ptr(r.priority),
+			Direction:                to.Ptr(armnetwork.SecurityRuleDirectionInbound),
+			Access:                   to.Ptr(armnetwork.SecurityRuleAccessAllow),
+			Protocol:                 to.Ptr(armnetwork.SecurityRuleProtocolTCP),
+			SourcePortRange:          to.Ptr("*"),
+			DestinationAddressPrefix: to.Ptr("*"),
+			DestinationPortRange:     to.Ptr(r.port),
+		}
+		if len(sources) == 1 {
+			props.SourceAddressPrefix = to.Ptr(sources[0])
+		} else {
+			props.SourceAddressPrefixes = to.SliceOfPtrs(sources...)
+		}
+		poller, err := rulesClient.BeginCreateOrUpdate(ctx, resourceGroup, nsgName, r.name, armnetwork.SecurityRule{
+			Name:       to.Ptr(r.name),
+			Properties: props,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to set NSG rule '%s': %w", r.name, err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("failed to complete NSG rule '%s' update: %w", r.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package cluster
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jwilder/k3a/pkg/storage"
+	"github.com/jwilder/k3a/pool"
+	"github.com/rodaine/table"
+)
+
+// EtcdScript takes, lists and restores etcd snapshots on a control-plane node. The etcd-backup addon
+// runs it on a schedule.
+//
+//go:embed etcd.sh
+var EtcdScript string
+
+// snapshotName matches the names of the snapshots EtcdScript uploads
+var snapshotName = regexp.MustCompile(`^etcd-\d{8}T\d{6}Z\.db$`)
+
+type BackupArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Retain         int // Snapshots to keep, oldest are deleted first; 0 keeps all
+}
+
+// Backup takes an etcd snapshot on a control-plane node and uploads it to the cluster storage account
+func Backup(args BackupArgs) error {
+	if args.Retain < 0 {
+		return fmt.Errorf("retain must not be negative")
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	runner, err := pool.NewKubectlRunner(ctx, args.SubscriptionID, args.Cluster, cred, nil)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	output, err := runner.RunScript(EtcdScript, "backup", storage.AccountName(args.Cluster), strconv.Itoa(args.Retain))
+	if err != nil {
+		return fmt.Errorf("failed to back up etcd: %w", err)
+	}
+	fmt.Print(output)
+	return nil
+}
+
+type ListBackupsArgs struct {
+	SubscriptionID string
+	Cluster        string
+}
+
+// ListBackups prints the etcd snapshots in the cluster storage account
+func ListBackups(args ListBackupsArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	runner, err := pool.NewKubectlRunner(ctx, args.SubscriptionID, args.Cluster, cred, nil)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	output, err := runner.RunScript(EtcdScript, "list", storage.AccountName(args.Cluster))
+	if err != nil {
+		return fmt.Errorf("failed to list etcd snapshots: %w", err)
+	}
+
+	tbl := table.New("SNAPSHOT", "SIZE (MB)", "CREATED")
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseFloat(fields[1], 64)
+		tbl.AddRow(fields[0], fmt.Sprintf("%.1f", size/(1<<20)), fields[2])
+	}
+	tbl.Print()
+	return nil
+}
+
+type RestoreArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Snapshot       string
+	Force          bool
+}
+
+// Restore replaces the control plane's etcd data with a snapshot from the cluster storage account.
+// Only stacked etcd can be restored this way, and the snapshot comes back as a single-member etcd.
+// With more than one control-plane instance, Force stops etcd and the API server on the other
+// instances and restores on one of them; the others are then deleted and the pool scaled back up.
+func Restore(args RestoreArgs) error {
+	if !snapshotName.MatchString(args.Snapshot) {
+		return fmt.Errorf("invalid snapshot name '%s' (expected etcd-<timestamp>.db)", args.Snapshot)
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	hostnames, err := pool.ControlPlaneHostnames(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	if len(hostnames) > 1 && !args.Force {
+		return fmt.Errorf("restore needs exactly one control-plane instance, found %d; delete the unhealthy members "+
+			"with 'k3a pool instance delete' until one remains, or pass --force to restore on one member and replace the others", len(hostnames))
+	}
+
+	runner, err := pool.NewKubectlRunner(ctx, args.SubscriptionID, args.Cluster, cred, nil)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	// The other members would keep serving the old data behind the API load balancer
+	var others []string
+	for _, host := range hostnames {
+		if host != runner.Host {
+			others = append(others, host)
+		}
+	}
+	for _, host := range others {
+		if err := stopControlPlane(ctx, args.SubscriptionID, args.Cluster, host, hostnames, cred); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Restoring etcd on %s from snapshot '%s'...\n", runner.Host, args.Snapshot)
+	output, err := runner.RunScript(EtcdScript, "restore", storage.AccountName(args.Cluster), args.Snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to restore etcd: %w", err)
+	}
+	fmt.Print(output)
+	if len(others) > 0 {
+		fmt.Printf("%s no longer run etcd or the API server. Delete their instances with 'k3a pool instance delete --force', "+
+			"then scale the control-plane pool back up to rejoin them.\n", strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// stopControlPlane stops etcd and the API server on one control-plane instance
+func stopControlPlane(ctx context.Context, subscriptionID, cluster, host string, hostnames []string, cred *azidentity.DefaultAzureCredential) error {
+	var exclude []string
+	for _, name := range hostnames {
+		if name != host {
+			exclude = append(exclude, name)
+		}
+	}
+	runner, err := pool.NewKubectlRunner(ctx, subscriptionID, cluster, cred, exclude)
+	if err != nil {
+		return fmt.Errorf("failed to stop etcd and the API server on %s: %w", host, err)
+	}
+	defer runner.Close()
+
+	fmt.Printf("Stopping etcd and the API server on %s...\n", host)
+	if _, err := runner.RunScript(EtcdScript, "stop"); err != nil {
+		return fmt.Errorf("failed to stop etcd and the API server on %s: %w", host, err)
+	}
+	return nil
+}
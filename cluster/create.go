@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,8 +12,13 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"github.com/jwilder/k3a/pkg/kube"
+	"github.com/jwilder/k3a/pkg/registry"
+	"github.com/jwilder/k3a/pkg/storage"
 	kstrings "github.com/jwilder/k3a/pkg/strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -31,6 +37,15 @@ type CreateArgs struct {
 	Cluster          string
 	Location         string
 	VnetAddressSpace string
+	VnetID           string   // existing VNet to create the node subnet in
+	SubnetID         string   // existing subnet to place nodes in
+	IPFamily         string   // ipv4 (default) or dual for dual-stack IPv4/IPv6
+	Egress           string   // loadbalancer (default) or nat-gateway
+	OutboundIPs      int      // public IPs used for outbound traffic
+	SNATPorts        int      // SNAT ports allocated per instance by the load balancer outbound rule
+	AllowedSources   []string // sources allowed to reach the API server and SSH; defaults to the caller's public IP
+	Private          bool     // API server only reachable inside the VNet through an internal LB and private DNS
+	DeletedKeyVault  string   // recover (default) or purge a soft-deleted Key Vault left by a cluster of the same name
 }
 
 // retryRoleAssignment retries role assignment creation to handle AAD replication delays
@@ -63,16 +78,20 @@ func retryRoleAssignment(ctx context.Context, client *armauthorization.RoleAssig
 }
 
 // createResourceGroup creates an Azure resource group
-func createResourceGroup(ctx context.Context, subscriptionID, cluster, location string, cred *azidentity.DefaultAzureCredential) error {
+func createResourceGroup(ctx context.Context, subscriptionID, cluster, location string, extraTags map[string]string, cred *azidentity.DefaultAzureCredential) error {
 	resourceGroupsClient, err := armresources.NewResourceGroupsClient(subscriptionID, cred, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create resource groups client: %w", err)
 	}
+	tags := map[string]*string{
+		"k3a": to.Ptr("cluster"),
+	}
+	for k, v := range extraTags {
+		tags[k] = to.Ptr(v)
+	}
 	_, err = resourceGroupsClient.CreateOrUpdate(ctx, cluster, armresources.ResourceGroup{
 		Location: to.Ptr(location),
-		Tags: map[string]*string{
-			"k3a": to.Ptr("cluster"),
-		},
+		Tags:     tags,
 	}, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create resource group: %w", err)
@@ -81,8 +100,8 @@ func createResourceGroup(ctx context.Context, subscriptionID, cluster, location
 }
 
 // createKeyVault creates a Key Vault and assigns roles
-func createKeyVault(ctx context.Context, subscriptionID, cluster, location, vnetNamePrefix, msiPrincipalID, callingPrincipalID string, cred *azidentity.DefaultAzureCredential, tenantID string) (string, error) {
-	keyVaultName := strings.ToLower(vnetNamePrefix + "kv" + kstrings.UniqueString(cluster))
+func createKeyVault(ctx context.Context, subscriptionID, cluster, location, msiPrincipalID, callingPrincipalID string, recover bool, cred *azidentity.DefaultAzureCredential, tenantID string) (string, error) {
+	keyVaultName := kube.KeyVaultName(cluster)
 	keyVaultClient, err := armkeyvault.NewVaultsClient(subscriptionID, cred, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create Key Vault client: %w", err)
@@ -98,6 +117,9 @@ func createKeyVault(ctx context.Context, subscriptionID, cluster, location, vnet
 			},
 		},
 	}
+	if recover {
+		keyVaultParams.Properties.CreateMode = to.Ptr(armkeyvault.CreateModeRecover)
+	}
 	_, err = keyVaultClient.BeginCreateOrUpdate(ctx, cluster, keyVaultName, keyVaultParams, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create Key Vault: %w", err)
@@ -256,7 +278,52 @@ func Create(args CreateArgs) error {
 	}
 	ctx := context.Background()
 
-	if err := createResourceGroup(ctx, subscriptionID, cluster, location, cred); err != nil {
+	if args.IPFamily == "" {
+		args.IPFamily = IPFamilyIPv4
+	}
+	if args.IPFamily != IPFamilyIPv4 && args.IPFamily != IPFamilyDual {
+		return fmt.Errorf("invalid IP family: %s (must be '%s' or '%s')", args.IPFamily, IPFamilyIPv4, IPFamilyDual)
+	}
+	dualStack := args.IPFamily == IPFamilyDual
+	egress := egressConfig{Mode: args.Egress, OutboundIPs: args.OutboundIPs, SNATPortsPerInstance: args.SNATPorts}
+	if err := egress.validate(dualStack); err != nil {
+		return err
+	}
+
+	// Private clusters aren't reachable from the internet, so only scope access there when asked to
+	var allowedSources []string
+	if !args.Private || len(args.AllowedSources) > 0 {
+		allowedSources, err = resolveAllowedSources(ctx, args.AllowedSources)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Key Vault names are derived from the cluster name, so a previous cluster's soft-deleted vault blocks ours
+	recoverKeyVault, err := resolveDeletedKeyVault(ctx, subscriptionID, cluster, location, args.DeletedKeyVault, cred)
+	if err != nil {
+		return err
+	}
+
+	// Work out the node subnet and check it against the pod/service CIDRs before creating anything
+	vnetName := vnetNamePrefix + "-vnet"
+	network, err := resolveNodeNetwork(ctx, subscriptionID, cluster, vnetName, args, cred)
+	if err != nil {
+		return err
+	}
+
+	rgTags := map[string]string{
+		clusternet.SubnetIDTag: network.SubnetID,
+		clusternet.IPFamilyTag: args.IPFamily,
+	}
+	for k, v := range egress.tags() {
+		rgTags[k] = v
+	}
+	if args.Private {
+		rgTags[clusternet.PrivateTag] = "true"
+		rgTags[clusternet.APIServerNameTag] = "api." + privateDNSZoneName(cluster)
+	}
+	if err := createResourceGroup(ctx, subscriptionID, cluster, location, rgTags, cred); err != nil {
 		return err
 	}
 
@@ -286,7 +353,7 @@ func Create(args CreateArgs) error {
 		return err
 	}
 
-	_, err = createKeyVault(ctx, subscriptionID, cluster, location, vnetNamePrefix, msiPrincipalID, callingPrincipalID, cred, tenantID)
+	_, err = createKeyVault(ctx, subscriptionID, cluster, location, msiPrincipalID, callingPrincipalID, recoverKeyVault, cred, tenantID)
 	if err != nil {
 		return err
 	}
@@ -297,15 +364,38 @@ func Create(args CreateArgs) error {
 	if err != nil {
 		return err
 	}
+	if len(allowedSources) > 0 {
+		if err := setAccessRules(ctx, subscriptionID, cluster, nsgName, allowedSources, cred); err != nil {
+			return err
+		}
+		fmt.Printf("Inbound access to the API server and SSH limited to: %s\n", strings.Join(allowedSources, ", "))
+	}
 
-	// Create Virtual Network (VNet) with subnets
-	vnetName := vnetNamePrefix + "-vnet"
-	if err := createVirtualNetwork(ctx, subscriptionID, cluster, location, vnetName, args.VnetAddressSpace, nsgID, cred); err != nil {
+	// NAT gateway egress is attached to the node subnet, so it has to exist first
+	if egress.Mode == clusternet.EgressNATGateway {
+		natGatewayID, err := createNATGateway(ctx, subscriptionID, cluster, location, egress.OutboundIPs, cred)
+		if err != nil {
+			return err
+		}
+		network.NATGatewayID = natGatewayID
+	}
+
+	// Create Virtual Network (VNet) with subnets, or attach to the user's VNet
+	if network.Existing {
+		if err := attachSubnet(ctx, network, nsgID, cred); err != nil {
+			return err
+		}
+	} else if err := createVirtualNetwork(ctx, subscriptionID, cluster, location, vnetName, network, nsgID, cred); err != nil {
 		return err
 	}
+	if dualStack {
+		fmt.Printf("Node subnet: %s, %s (%s)\n", network.SubnetPrefix, network.SubnetPrefixV6, network.SubnetID)
+	} else {
+		fmt.Printf("Node subnet: %s (%s)\n", network.SubnetPrefix, network.SubnetID)
+	}
 
 	// Create Storage Account
-	storageName := strings.ToLower(vnetNamePrefix + "storage" + kstrings.UniqueString(cluster))
+	storageName := storage.AccountName(cluster)
 	if err := createStorageAccount(ctx, subscriptionID, cluster, location, storageName, cred); err != nil {
 		return err
 	}
@@ -346,21 +436,72 @@ func Create(args CreateArgs) error {
 		return fmt.Errorf("failed to assign Table Data Contributor role to MSI: %w", err)
 	}
 
+	// The cluster registry table is read and written with the caller's token, not the account key
+	callerTableRoleAssignmentName := kstrings.DeterministicGUID(storageAccountID + callingPrincipalID + "0a9a7e1f-b9d0-4cc4-a60d-0319b160aaa3")
+	err = retryRoleAssignment(ctx, roleAssignmentsClient, storageAccountID, callerTableRoleAssignmentName, armauthorization.RoleAssignmentCreateParameters{
+		Properties: &armauthorization.RoleAssignmentProperties{
+			PrincipalID:      to.Ptr(callingPrincipalID),
+			RoleDefinitionID: to.Ptr(tableRoleDefID),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to assign Table Data Contributor role to the current principal: %w", err)
+	}
+
 	clusterHash := kstrings.UniqueString(cluster)
 
-	lbDNSName, err := createLoadBalancer(ctx, subscriptionID, cluster, location, vnetNamePrefix, clusterHash, cred, msiID, msiPrincipalID, roleAssignmentsClient)
+	lbDNSName, err := createLoadBalancer(ctx, subscriptionID, cluster, location, vnetNamePrefix, clusterHash, args.Private, dualStack, egress, cred, msiID, msiPrincipalID, roleAssignmentsClient)
 	if err != nil {
 		return fmt.Errorf("failed to create Load Balancer: %w", err)
 	}
 
+	if args.Private {
+		// The public LB only provides outbound SNAT; the API server and SSH go through an internal LB
+		internalLBName := strings.ToLower(vnetNamePrefix+"lb"+clusterHash) + "-internal"
+		apiIP, err := createInternalLoadBalancer(ctx, subscriptionID, cluster, location, internalLBName, network.SubnetID, cred)
+		if err != nil {
+			return err
+		}
+		zoneName := privateDNSZoneName(cluster)
+		if err := createPrivateDNSZone(ctx, subscriptionID, cluster, zoneName, network.VnetID, apiIP, cred); err != nil {
+			return err
+		}
+
+		fmt.Printf("Private cluster resources created successfully!\n")
+		fmt.Printf("Internal Load Balancer IP: %s\n", apiIP)
+		fmt.Printf("Kubernetes API endpoint will be available inside the VNet at: https://api.%s:6443\n", zoneName)
+		recordCluster(ctx, args, cred)
+		return nil
+	}
+
 	// Output the cluster information
 	fmt.Printf("Cluster resources created successfully!\n")
 	fmt.Printf("Load Balancer DNS: %s\n", lbDNSName)
 	fmt.Printf("Kubernetes API endpoint will be available at: https://%s:6443\n", lbDNSName)
 
+	recordCluster(ctx, args, cred)
 	return nil
 }
 
+// recordCluster writes the cluster's create arguments to the cluster registry. The cluster works
+// without the record, so failures only warn. The table role assigned during create can take a few
+// minutes to apply, so access denied errors are retried for a while.
+func recordCluster(ctx context.Context, args CreateArgs, cred *azidentity.DefaultAzureCredential) {
+	for attempt := 1; ; attempt++ {
+		err := registry.Put(ctx, args.SubscriptionID, args.Cluster, registry.Record{Kind: registry.KindCluster, Name: args.Cluster}, args, cred)
+		if err == nil {
+			return
+		}
+		var respErr *azcore.ResponseError
+		if attempt < 20 && errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden {
+			time.Sleep(15 * time.Second)
+			continue
+		}
+		fmt.Printf("Warning: failed to record cluster metadata: %v\n", err)
+		return
+	}
+}
+
 // storeSecretInKeyVault stores a secret in Azure Key Vault
 func storeSecretInKeyVault(ctx context.Context, subscriptionID, keyVaultName, secretName, secretValue string) error {
 	vaultUrl := fmt.Sprintf("https://%s.vault.azure.net/", keyVaultName)
@@ -380,7 +521,7 @@ func storeSecretInKeyVault(ctx context.Context, subscriptionID, keyVaultName, se
 	return nil
 }
 
-// createNetworkSecurityGroup creates a Network Security Group with default rules including CorpNetPublic access
+// createNetworkSecurityGroup creates the cluster Network Security Group; inbound access rules are added by setAccessRules
 func createNetworkSecurityGroup(ctx context.Context, subscriptionID, resourceGroup, location, nsgName string, cred *azidentity.DefaultAzureCredential) (string, error) {
 	nsgClient, err := armnetwork.NewSecurityGroupsClient(subscriptionID, cred, nil)
 	if err != nil {
@@ -408,55 +549,29 @@ func createNetworkSecurityGroup(ctx context.Context, subscriptionID, resourceGro
 		return "", fmt.Errorf("NSG creation did not return a valid ID")
 	}
 
-	// Add CorpNetPublic rule automatically
-	fmt.Println("Adding CorpNetPublic NSG rule...")
-	securityRulesClient, err := armnetwork.NewSecurityRulesClient(subscriptionID, cred, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create security rules client: %w", err)
-	}
-
-	corpNetRule := armnetwork.SecurityRule{
-		Name: to.Ptr("AllowCorpNetPublic"),
-		Properties: &armnetwork.SecurityRulePropertiesFormat{
-			Priority:                 to.Ptr[int32](150),
-			Direction:                to.Ptr(armnetwork.SecurityRuleDirectionInbound),
-			Access:                   to.Ptr(armnetwork.SecurityRuleAccessAllow),
-			Protocol:                 to.Ptr(armnetwork.SecurityRuleProtocolAsterisk),
-			SourceAddressPrefix:      to.Ptr("CorpNetPublic"),
-			SourcePortRange:          to.Ptr("*"),
-			DestinationAddressPrefix: to.Ptr("*"),
-			DestinationPortRange:     to.Ptr("*"),
-		},
-	}
-
-	_, err = securityRulesClient.BeginCreateOrUpdate(ctx, resourceGroup, nsgName, "AllowCorpNetPublic", corpNetRule, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to add CorpNetPublic NSG rule: %w", err)
-	}
-
-	fmt.Println("CorpNetPublic NSG rule added successfully")
 	return *finalResp.SecurityGroup.ID, nil
 }
 
 // createVirtualNetwork creates a Virtual Network with subnets and attaches the NSG
-func createVirtualNetwork(ctx context.Context, subscriptionID, resourceGroup, location, vnetName, addressSpace, nsgID string, cred *azidentity.DefaultAzureCredential) error {
+func createVirtualNetwork(ctx context.Context, subscriptionID, resourceGroup, location, vnetName string, network nodeNetwork, nsgID string, cred *azidentity.DefaultAzureCredential) error {
 	vnetClient, err := armnetwork.NewVirtualNetworksClient(subscriptionID, cred, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create VNet client: %w", err)
 	}
-	_, err = vnetClient.BeginCreateOrUpdate(ctx, resourceGroup, vnetName, armnetwork.VirtualNetwork{
+	addressPrefixes := []*string{to.Ptr(network.AddressSpace)}
+	if network.AddressSpaceV6 != "" {
+		addressPrefixes = append(addressPrefixes, to.Ptr(network.AddressSpaceV6))
+	}
+	poller, err := vnetClient.BeginCreateOrUpdate(ctx, resourceGroup, vnetName, armnetwork.VirtualNetwork{
 		Location: to.Ptr(location),
 		Properties: &armnetwork.VirtualNetworkPropertiesFormat{
 			AddressSpace: &armnetwork.AddressSpace{
-				AddressPrefixes: []*string{to.Ptr(addressSpace)},
+				AddressPrefixes: addressPrefixes,
 			},
 			Subnets: []*armnetwork.Subnet{
 				{
-					Name: to.Ptr("default"),
-					Properties: &armnetwork.SubnetPropertiesFormat{
-						AddressPrefix:        to.Ptr("10.1.0.0/16"),
-						NetworkSecurityGroup: &armnetwork.SecurityGroup{ID: to.Ptr(nsgID)},
-					},
+					Name:       to.Ptr("default"),
+					Properties: network.subnetProperties(nsgID),
 				},
 			},
 		},
@@ -464,66 +579,146 @@ func createVirtualNetwork(ctx context.Context, subscriptionID, resourceGroup, lo
 	if err != nil {
 		return fmt.Errorf("failed to create VNet: %w", err)
 	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to complete VNet creation: %w", err)
+	}
 	return nil
 }
 
-// createLoadBalancer provisions a Standard Load Balancer, public IP, backend pool, NAT pool, outbound rule, and private DNS zone with VNet link
-func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, location, vnetNamePrefix, clusterHash string, cred *azidentity.DefaultAzureCredential, msiID string, msiPrincipalID string, roleAssignmentsClient *armauthorization.RoleAssignmentsClient) (string, error) {
+// createLoadBalancer provisions a Standard Load Balancer, public IP, backend pool, NAT pool and outbound rule.
+// For private clusters only the outbound IPs and rule are created and an empty DNS name is returned.
+// With NAT gateway egress the outbound IPs and rule are skipped.
+func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, location, vnetNamePrefix, clusterHash string, private, dualStack bool, egress egressConfig, cred *azidentity.DefaultAzureCredential, msiID string, msiPrincipalID string, roleAssignmentsClient *armauthorization.RoleAssignmentsClient) (string, error) {
 	lbName := strings.ToLower(vnetNamePrefix + "lb" + clusterHash)
 	publicIPName := lbName + "-publicIP"
 
+	// A private cluster only uses the public LB for egress, which the NAT gateway already provides
+	if private && egress.Mode == clusternet.EgressNATGateway {
+		return "", nil
+	}
+
 	// 1. Create Primary Public IP (for inbound traffic)
 	publicIPClient, err := armnetwork.NewPublicIPAddressesClient(subscriptionID, cred, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create public IP client: %w", err)
 	}
-	_, err = publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, publicIPName, armnetwork.PublicIPAddress{
-		Location: to.Ptr(location),
-		SKU: &armnetwork.PublicIPAddressSKU{
-			Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
-		},
-		Properties: &armnetwork.PublicIPAddressPropertiesFormat{
-			PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
-			DNSSettings: &armnetwork.PublicIPAddressDNSSettings{
-				DomainNameLabel: to.Ptr(resourceGroup), // Use resource group name (cluster name) as DNS label
+	if !private {
+		_, err = publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, publicIPName, armnetwork.PublicIPAddress{
+			Location: to.Ptr(location),
+			SKU: &armnetwork.PublicIPAddressSKU{
+				Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
 			},
-		},
-	}, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create primary public IP: %w", err)
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+				PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+				DNSSettings: &armnetwork.PublicIPAddressDNSSettings{
+					DomainNameLabel: to.Ptr(resourceGroup), // Use resource group name (cluster name) as DNS label
+				},
+			},
+		}, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create primary public IP: %w", err)
+		}
 	}
 
-	// 2. Create 5 additional Public IPs for outbound rules
-	outboundPublicIPIDs := make([]string, 5)
-	for i := 0; i < 5; i++ {
-		outboundIPName := fmt.Sprintf("%s-outbound-ip-%d", lbName, i+1)
-		_, err = publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, outboundIPName, armnetwork.PublicIPAddress{
+	// Public dual-stack clusters also accept API server and SSH traffic over IPv6
+	inboundIPv6 := dualStack && !private
+	publicIPv6Name := publicIPName + clusternet.DNSLabelIPv6Suffix
+	var publicIPv6ID string
+	if inboundIPv6 {
+		poller, err := publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, publicIPv6Name, armnetwork.PublicIPAddress{
 			Location: to.Ptr(location),
 			SKU: &armnetwork.PublicIPAddressSKU{
 				Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
 			},
 			Properties: &armnetwork.PublicIPAddressPropertiesFormat{
 				PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+				PublicIPAddressVersion:   to.Ptr(armnetwork.IPVersionIPv6),
+				DNSSettings: &armnetwork.PublicIPAddressDNSSettings{
+					DomainNameLabel: to.Ptr(resourceGroup + clusternet.DNSLabelIPv6Suffix),
+				},
 			},
 		}, nil)
 		if err != nil {
-			return "", fmt.Errorf("failed to create outbound public IP %d: %w", i+1, err)
+			return "", fmt.Errorf("failed to create IPv6 public IP: %w", err)
 		}
-
-		// Get the resource ID
-		outboundPublicIP, err := publicIPClient.Get(ctx, resourceGroup, outboundIPName, nil)
+		resp, err := poller.PollUntilDone(ctx, nil)
 		if err != nil {
-			return "", fmt.Errorf("failed to get outbound public IP %d: %w", i+1, err)
+			return "", fmt.Errorf("failed to complete IPv6 public IP creation: %w", err)
+		}
+		publicIPv6ID = *resp.ID
+	}
+
+	// 2. Create the public IPs for the outbound rule; a NAT gateway handles egress instead when configured
+	useOutboundRule := egress.Mode == clusternet.EgressLoadBalancer
+	var outboundPublicIPIDs []string
+	if useOutboundRule {
+		for i := 0; i < egress.OutboundIPs; i++ {
+			outboundIPName := fmt.Sprintf("%s-outbound-ip-%d", lbName, i+1)
+			_, err = publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, outboundIPName, armnetwork.PublicIPAddress{
+				Location: to.Ptr(location),
+				SKU: &armnetwork.PublicIPAddressSKU{
+					Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
+				},
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+					PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+				},
+			}, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to create outbound public IP %d: %w", i+1, err)
+			}
+
+			// Get the resource ID
+			outboundPublicIP, err := publicIPClient.Get(ctx, resourceGroup, outboundIPName, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to get outbound public IP %d: %w", i+1, err)
+			}
+			outboundPublicIPIDs = append(outboundPublicIPIDs, *outboundPublicIP.ID)
+		}
+	}
+
+	// Dual-stack clusters get IPv6 public IPs for IPv6 egress. The IPv6 outbound rule hands out as many
+	// SNAT ports per instance as the IPv4 one, so it gets as many IPs to serve as many instances.
+	var outboundPublicIPv6IDs []string
+	if dualStack {
+		count := 1
+		if useOutboundRule {
+			count = egress.OutboundIPs
+		}
+		for i := 0; i < count; i++ {
+			outboundIPv6Name := lbName + "-outbound-ipv6"
+			if i > 0 {
+				outboundIPv6Name = fmt.Sprintf("%s-%d", outboundIPv6Name, i+1)
+			}
+			poller, err := publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, outboundIPv6Name, armnetwork.PublicIPAddress{
+				Location: to.Ptr(location),
+				SKU: &armnetwork.PublicIPAddressSKU{
+					Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
+				},
+				Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+					PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+					PublicIPAddressVersion:   to.Ptr(armnetwork.IPVersionIPv6),
+				},
+			}, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to create outbound IPv6 public IP %d: %w", i+1, err)
+			}
+			resp, err := poller.PollUntilDone(ctx, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to complete outbound IPv6 public IP %d creation: %w", i+1, err)
+			}
+			outboundPublicIPv6IDs = append(outboundPublicIPv6IDs, *resp.ID)
 		}
-		outboundPublicIPIDs[i] = *outboundPublicIP.ID
 	}
 
 	// 3. Get Primary Public IP resource ID
-	publicIP, err := publicIPClient.Get(ctx, resourceGroup, publicIPName, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to get public IP: %w", err)
+	var publicIPID string
+	if !private {
+		publicIP, err := publicIPClient.Get(ctx, resourceGroup, publicIPName, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to get public IP: %w", err)
+		}
+		publicIPID = *publicIP.ID
 	}
-	publicIPID := *publicIP.ID
 
 	// 3. Create or Update Load Balancer
 	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
@@ -532,6 +727,7 @@ func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, loca
 	}
 	frontendIPConfigName := "LoadBalancerFrontend"
 	backendPoolName := "outbound-pool"
+	backendPoolNameV6 := "outbound-pool-ipv6"
 	sshNatPoolName := "ssh"
 	outboundRuleName := "OutboundRule"
 
@@ -554,21 +750,69 @@ func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, loca
 			Name: to.Ptr(backendPoolName),
 		})
 	}
+	if dualStack {
+		foundOutboundPoolV6 := false
+		for _, pool := range existingBackendPools {
+			if pool != nil && pool.Name != nil && *pool.Name == backendPoolNameV6 {
+				foundOutboundPoolV6 = true
+				break
+			}
+		}
+		if !foundOutboundPoolV6 {
+			existingBackendPools = append(existingBackendPools, &armnetwork.BackendAddressPool{
+				Name: to.Ptr(backendPoolNameV6),
+			})
+		}
+	}
 
-	// 4. Create Frontend IP Configurations (1 primary + 5 outbound)
-	frontendIPConfigurations := []*armnetwork.FrontendIPConfiguration{
+	// 4. Create Frontend IP Configurations (1 primary + 1 per outbound IP)
+	frontendIPConfigurations := []*armnetwork.FrontendIPConfiguration{}
+	var inboundNatPools []*armnetwork.InboundNatPool
+	if !private {
 		// Primary frontend IP (for inbound traffic and DNS)
-		{
+		frontendIPConfigurations = append(frontendIPConfigurations, &armnetwork.FrontendIPConfiguration{
 			Name: to.Ptr(frontendIPConfigName),
 			Properties: &armnetwork.FrontendIPConfigurationPropertiesFormat{
 				PublicIPAddress: &armnetwork.PublicIPAddress{ID: to.Ptr(publicIPID)},
 			},
-		},
+		})
+		inboundNatPools = append(inboundNatPools, &armnetwork.InboundNatPool{
+			Name: to.Ptr(sshNatPoolName),
+			Properties: &armnetwork.InboundNatPoolPropertiesFormat{
+				FrontendIPConfiguration: &armnetwork.SubResource{
+					ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", subscriptionID, resourceGroup, lbName, frontendIPConfigName)),
+				},
+				Protocol:               to.Ptr(armnetwork.TransportProtocolTCP),
+				FrontendPortRangeStart: to.Ptr[int32](50000),
+				FrontendPortRangeEnd:   to.Ptr[int32](50100),
+				BackendPort:            to.Ptr[int32](22),
+			},
+		})
+	}
+	if inboundIPv6 {
+		frontendIPConfigurations = append(frontendIPConfigurations, &armnetwork.FrontendIPConfiguration{
+			Name: to.Ptr(clusternet.APIFrontendIPv6),
+			Properties: &armnetwork.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &armnetwork.PublicIPAddress{ID: to.Ptr(publicIPv6ID)},
+			},
+		})
+		inboundNatPools = append(inboundNatPools, &armnetwork.InboundNatPool{
+			Name: to.Ptr(clusternet.SSHNATPoolIPv6),
+			Properties: &armnetwork.InboundNatPoolPropertiesFormat{
+				FrontendIPConfiguration: &armnetwork.SubResource{
+					ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", subscriptionID, resourceGroup, lbName, clusternet.APIFrontendIPv6)),
+				},
+				Protocol:               to.Ptr(armnetwork.TransportProtocolTCP),
+				FrontendPortRangeStart: to.Ptr[int32](50000),
+				FrontendPortRangeEnd:   to.Ptr[int32](50100),
+				BackendPort:            to.Ptr[int32](22),
+			},
+		})
 	}
 
-	// Add 5 outbound frontend IP configurations
+	// Add one outbound frontend IP configuration per outbound IP
 	outboundFrontendIPRefs := []*armnetwork.SubResource{}
-	for i := 0; i < 5; i++ {
+	for i := range outboundPublicIPIDs {
 		outboundFrontendName := fmt.Sprintf("outbound-frontend-%d", i+1)
 		frontendIPConfigurations = append(frontendIPConfigurations, &armnetwork.FrontendIPConfiguration{
 			Name: to.Ptr(outboundFrontendName),
@@ -583,6 +827,55 @@ func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, loca
 		})
 	}
 
+	var outboundRules []*armnetwork.OutboundRule
+	if useOutboundRule {
+		// Each outbound IP provides 64,000 SNAT ports shared by all backend instances, so the
+		// pool can hold up to outbound IPs * 64,000 / ports-per-instance instances
+		fmt.Printf("Outbound rule: %d public IPs, %d SNAT ports per instance (up to %d instances)\n", egress.OutboundIPs, egress.SNATPortsPerInstance, egress.maxInstances())
+		outboundRules = append(outboundRules, &armnetwork.OutboundRule{
+			Name: to.Ptr(outboundRuleName),
+			Properties: &armnetwork.OutboundRulePropertiesFormat{
+				BackendAddressPool: &armnetwork.SubResource{
+					ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s", subscriptionID, resourceGroup, lbName, backendPoolName)),
+				},
+				FrontendIPConfigurations: outboundFrontendIPRefs,
+				Protocol:                 to.Ptr(armnetwork.LoadBalancerOutboundRuleProtocolAll),
+				AllocatedOutboundPorts:   to.Ptr(int32(egress.SNATPortsPerInstance)),
+			},
+		})
+	}
+
+	// IPv6 egress uses its own frontend, backend pool and outbound rule since a rule can't mix IP versions
+	if dualStack {
+		var outboundFrontendIPv6Refs []*armnetwork.SubResource
+		for i, id := range outboundPublicIPv6IDs {
+			outboundFrontendNameV6 := clusternet.OutboundFrontendIPv6
+			if i > 0 {
+				outboundFrontendNameV6 = fmt.Sprintf("%s-%d", outboundFrontendNameV6, i+1)
+			}
+			frontendIPConfigurations = append(frontendIPConfigurations, &armnetwork.FrontendIPConfiguration{
+				Name: to.Ptr(outboundFrontendNameV6),
+				Properties: &armnetwork.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &armnetwork.PublicIPAddress{ID: to.Ptr(id)},
+				},
+			})
+			outboundFrontendIPv6Refs = append(outboundFrontendIPv6Refs, &armnetwork.SubResource{
+				ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", subscriptionID, resourceGroup, lbName, outboundFrontendNameV6)),
+			})
+		}
+		outboundRules = append(outboundRules, &armnetwork.OutboundRule{
+			Name: to.Ptr(outboundRuleName + "IPv6"),
+			Properties: &armnetwork.OutboundRulePropertiesFormat{
+				BackendAddressPool: &armnetwork.SubResource{
+					ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s", subscriptionID, resourceGroup, lbName, backendPoolNameV6)),
+				},
+				FrontendIPConfigurations: outboundFrontendIPv6Refs,
+				Protocol:                 to.Ptr(armnetwork.LoadBalancerOutboundRuleProtocolAll),
+				AllocatedOutboundPorts:   to.Ptr(int32(egress.SNATPortsPerInstance)),
+			},
+		})
+	}
+
 	_, err = lbClient.BeginCreateOrUpdate(ctx, resourceGroup, lbName, armnetwork.LoadBalancer{
 		Location: to.Ptr(location),
 		SKU: &armnetwork.LoadBalancerSKU{
@@ -591,43 +884,18 @@ func createLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, loca
 		Properties: &armnetwork.LoadBalancerPropertiesFormat{
 			FrontendIPConfigurations: frontendIPConfigurations,
 			BackendAddressPools:      existingBackendPools,
-			InboundNatPools: []*armnetwork.InboundNatPool{
-				{
-					Name: to.Ptr(sshNatPoolName),
-					Properties: &armnetwork.InboundNatPoolPropertiesFormat{
-						FrontendIPConfiguration: &armnetwork.SubResource{
-							ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", subscriptionID, resourceGroup, lbName, frontendIPConfigName)),
-						},
-						Protocol:               to.Ptr(armnetwork.TransportProtocolTCP),
-						FrontendPortRangeStart: to.Ptr[int32](50000),
-						FrontendPortRangeEnd:   to.Ptr[int32](50100),
-						BackendPort:            to.Ptr[int32](22),
-					},
-				},
-			},
-			OutboundRules: []*armnetwork.OutboundRule{
-				// Configure outbound rule to support large-scale deployments (1100+ VMSS instances)
-				// Configure outbound SNAT ports
-				// With 5 public IPs providing 64K ports each = 320,000 total available SNAT ports
-				// Setting 192 ports per instance for up to 1,666 instances (320,000/192)
-				{
-					Name: to.Ptr(outboundRuleName),
-					Properties: &armnetwork.OutboundRulePropertiesFormat{
-						BackendAddressPool: &armnetwork.SubResource{
-							ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s", subscriptionID, resourceGroup, lbName, backendPoolName)),
-						},
-						FrontendIPConfigurations: outboundFrontendIPRefs, // Use all 5 outbound IPs
-						Protocol:                 to.Ptr(armnetwork.LoadBalancerOutboundRuleProtocolAll),
-						AllocatedOutboundPorts:   to.Ptr[int32](192), // 192 SNAT ports per backend instance
-					},
-				},
-			},
+			InboundNatPools:          inboundNatPools,
+			OutboundRules:            outboundRules,
 		},
 	}, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create load balancer: %w", err)
 	}
 
+	if private {
+		return "", nil
+	}
+
 	// 4. Wait for public IP to be assigned and get its FQDN
 	// The DNS label was already set when creating the public IP, so we just need to construct the FQDN
 	var publicIPFQDN string
@@ -3,16 +3,23 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/jwilder/k3a/pkg/kube"
+	"github.com/jwilder/k3a/pkg/protect"
 )
 
 type DeleteArgs struct {
 	SubscriptionID string
 	Cluster        string
+	Purge          bool // Purge the soft-deleted Key Vault once the resource group is gone
 }
 
+// Delete deletes the cluster resource group. It refuses groups not tagged k3a=cluster, protected
+// clusters and groups holding management locks. With Purge, the cluster Key Vault, which Azure keeps
+// soft-deleted, is purged afterwards so the cluster name can be reused.
 func Delete(args DeleteArgs) error {
 	subscriptionID := args.SubscriptionID
 	if subscriptionID == "" {
@@ -34,13 +41,19 @@ func Delete(args DeleteArgs) error {
 		return fmt.Errorf("failed to create resource groups client: %w", err)
 	}
 
-	// Fetch the resource group to validate the tag
-	rg, err := resourceGroupsClient.Get(ctx, cluster, nil)
-	if err != nil {
-		return fmt.Errorf("failed to get resource group: %w", err)
+	// A cluster whose resource group is already gone can still have its soft-deleted Key Vault purged
+	if args.Purge {
+		exists, err := resourceGroupsClient.CheckExistence(ctx, cluster, nil)
+		if err != nil {
+			return fmt.Errorf("failed to check resource group: %w", err)
+		}
+		if !exists.Success {
+			return purgeClusterKeyVault(ctx, subscriptionID, cluster, cred)
+		}
 	}
-	if rg.Tags == nil || rg.Tags["k3a"] == nil || *rg.Tags["k3a"] != "cluster" {
-		return fmt.Errorf("resource group '%s' does not have the required tag k3a=cluster and cannot be deleted by this command", cluster)
+
+	if err := checkDeletable(ctx, subscriptionID, cluster, resourceGroupsClient, cred); err != nil {
+		return err
 	}
 
 	poller, err := resourceGroupsClient.BeginDelete(ctx, cluster, nil)
@@ -53,5 +66,72 @@ func Delete(args DeleteArgs) error {
 		return fmt.Errorf("failed to delete resource group: %w", err)
 	}
 
+	if args.Purge {
+		return purgeClusterKeyVault(ctx, subscriptionID, cluster, cred)
+	}
+	fmt.Printf("Key Vault '%s' stays soft-deleted until Azure purges it. Creating a cluster with the same name recovers it; 'k3a cluster delete --purge' purges it.\n", kube.KeyVaultName(cluster))
 	return nil
 }
+
+// DeletePlan checks that the cluster can be deleted and returns the resources deleting it would destroy
+func DeletePlan(args DeleteArgs) ([]string, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	resourceGroupsClient, err := armresources.NewResourceGroupsClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource groups client: %w", err)
+	}
+	vaultPlan := fmt.Sprintf("Soft-deleted Key Vault %s and its secrets (purged, cannot be recovered)", kube.KeyVaultName(args.Cluster))
+	if args.Purge {
+		exists, err := resourceGroupsClient.CheckExistence(ctx, args.Cluster, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check resource group: %w", err)
+		}
+		if !exists.Success {
+			return []string{vaultPlan}, nil
+		}
+	}
+	if err := checkDeletable(ctx, args.SubscriptionID, args.Cluster, resourceGroupsClient, cred); err != nil {
+		return nil, err
+	}
+
+	resourcesClient, err := armresources.NewClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resources client: %w", err)
+	}
+	plan := []string{fmt.Sprintf("Resource group %s", args.Cluster)}
+	var resources []string
+	pager := resourcesClient.NewListByResourceGroupPager(args.Cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list resources: %w", err)
+		}
+		for _, resource := range page.Value {
+			if resource.Name != nil && resource.Type != nil {
+				resources = append(resources, fmt.Sprintf("%s %s", *resource.Type, *resource.Name))
+			}
+		}
+	}
+	sort.Strings(resources)
+	plan = append(plan, resources...)
+	if args.Purge {
+		plan = append(plan, vaultPlan)
+	}
+	return plan, nil
+}
+
+// checkDeletable validates the k3a=cluster tag on the resource group and that nothing protects it
+func checkDeletable(ctx context.Context, subscriptionID, cluster string, resourceGroupsClient *armresources.ResourceGroupsClient, cred *azidentity.DefaultAzureCredential) error {
+	rg, err := resourceGroupsClient.Get(ctx, cluster, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get resource group: %w", err)
+	}
+	if rg.Tags == nil || rg.Tags["k3a"] == nil || *rg.Tags["k3a"] != "cluster" {
+		return fmt.Errorf("resource group '%s' does not have the required tag k3a=cluster and cannot be deleted by this command", cluster)
+	}
+	return protect.Check(ctx, subscriptionID, cluster, protect.ResourceGroupID(subscriptionID, cluster), "cluster", rg.Tags, cred)
+}
@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jwilder/k3a/pkg/registry"
+)
+
+type DescribeArgs struct {
+	SubscriptionID string
+	Cluster        string
+}
+
+// Describe prints how the cluster and its pools were created, from the records in the cluster registry
+func Describe(args DescribeArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	records, err := registry.List(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Printf("No records for cluster '%s'; it was created before k3a recorded cluster metadata.\n", args.Cluster)
+		return nil
+	}
+
+	for i, r := range records {
+		if i > 0 {
+			fmt.Println()
+		}
+		if r.Kind == registry.KindCluster {
+			fmt.Printf("Cluster: %s\n", r.Name)
+		} else {
+			fmt.Printf("Pool: %s\n", r.Name)
+		}
+		fmt.Printf("  Created:     %s by %s\n", r.CreatedAt.Local().Format(time.RFC1123), r.CreatedBy)
+		if !r.UpdatedAt.Equal(r.CreatedAt) {
+			fmt.Printf("  Updated:     %s\n", r.UpdatedAt.Local().Format(time.RFC1123))
+		}
+		fmt.Printf("  k3a version: %s\n", r.K3aVersion)
+		if r.K8sVersion != "" {
+			fmt.Printf("  Kubernetes:  %s\n", r.K8sVersion)
+		}
+		if r.SSHKeyFingerprint != "" {
+			fmt.Printf("  SSH key:     %s\n", r.SSHKeyFingerprint)
+		}
+		printRecordArgs(r.Args)
+	}
+	return nil
+}
+
+// printRecordArgs prints the create arguments that were set, sorted by name
+func printRecordArgs(data string) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(data), &args); err != nil {
+		fmt.Printf("  Arguments:   %s\n", data)
+		return
+	}
+	names := make([]string, 0, len(args))
+	for name, value := range args {
+		if name == "SubscriptionID" || value == nil || reflect.ValueOf(value).IsZero() {
+			continue
+		}
+		if list, ok := value.([]any); ok && len(list) == 0 {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return
+	}
+	fmt.Println("  Arguments:")
+	for _, name := range names {
+		var value string
+		switch v := args[name].(type) {
+		case string:
+			value = v
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				if str, ok := item.(string); ok {
+					items[i] = str
+				} else {
+					encoded, _ := json.Marshal(item)
+					items[i] = string(encoded)
+				}
+			}
+			value = strings.Join(items, ", ")
+		default:
+			encoded, _ := json.Marshal(v)
+			value = string(encoded)
+		}
+		fmt.Printf("    %s: %s\n", name, value)
+	}
+}
@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/clusternet"
+)
+
+// maxNATGatewayIPs is the number of public IPs a NAT gateway can use
+const maxNATGatewayIPs = 16
+
+// egressConfig is how nodes get outbound connectivity
+type egressConfig struct {
+	Mode                 string
+	OutboundIPs          int
+	SNATPortsPerInstance int
+}
+
+// validate fills in defaults and checks the outbound IP count and SNAT port allocation
+func (e *egressConfig) validate(dualStack bool) error {
+	if e.Mode == "" {
+		e.Mode = clusternet.EgressLoadBalancer
+	}
+	switch e.Mode {
+	case clusternet.EgressLoadBalancer:
+		if e.OutboundIPs < 1 {
+			return fmt.Errorf("--outbound-ips must be at least 1")
+		}
+		if e.SNATPortsPerInstance < 8 || e.SNATPortsPerInstance%8 != 0 {
+			return fmt.Errorf("--snat-ports-per-instance must be a positive multiple of 8, got %d", e.SNATPortsPerInstance)
+		}
+		if e.SNATPortsPerInstance > clusternet.PortsPerFrontendIP {
+			return fmt.Errorf("--snat-ports-per-instance can't exceed %d", clusternet.PortsPerFrontendIP)
+		}
+	case clusternet.EgressNATGateway:
+		if e.OutboundIPs < 1 || e.OutboundIPs > maxNATGatewayIPs {
+			return fmt.Errorf("--outbound-ips must be between 1 and %d for a NAT gateway", maxNATGatewayIPs)
+		}
+		if dualStack {
+			return fmt.Errorf("--egress %s does not support dual-stack clusters; NAT gateway is IPv4 only", clusternet.EgressNATGateway)
+		}
+	default:
+		return fmt.Errorf("invalid egress mode: %s (must be '%s' or '%s')", e.Mode, clusternet.EgressLoadBalancer, clusternet.EgressNATGateway)
+	}
+	return nil
+}
+
+// maxInstances is the number of instances the load balancer outbound rule can give SNAT ports to
+func (e egressConfig) maxInstances() int {
+	return e.OutboundIPs * clusternet.PortsPerFrontendIP / e.SNATPortsPerInstance
+}
+
+// tags returns the resource group tags describing the egress configuration
+func (e egressConfig) tags() map[string]string {
+	tags := map[string]string{
+		clusternet.EgressTag:      e.Mode,
+		clusternet.OutboundIPsTag: fmt.Sprintf("%d", e.OutboundIPs),
+	}
+	if e.Mode == clusternet.EgressLoadBalancer {
+		tags[clusternet.SNATPortsTag] = fmt.Sprintf("%d", e.SNATPortsPerInstance)
+	}
+	return tags
+}
+
+// createNATGateway creates a NAT gateway with count public IPs and returns its ID
+func createNATGateway(ctx context.Context, subscriptionID, resourceGroup, location string, count int, cred *azidentity.DefaultAzureCredential) (string, error) {
+	publicIPClient, err := armnetwork.NewPublicIPAddressesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create public IP client: %w", err)
+	}
+	var publicIPs []*armnetwork.SubResource
+	for i := 0; i < count; i++ {
+		ipName := fmt.Sprintf("%s-ip-%d", clusternet.NATGatewayName, i+1)
+		poller, err := publicIPClient.BeginCreateOrUpdate(ctx, resourceGroup, ipName, armnetwork.PublicIPAddress{
+			Location: to.Ptr(location),
+			SKU: &armnetwork.PublicIPAddressSKU{
+				Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
+			},
+			Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+				PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+			},
+		}, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create NAT gateway public IP %d: %w", i+1, err)
+		}
+		resp, err := poller.PollUntilDone(ctx, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to complete NAT gateway public IP %d creation: %w", i+1, err)
+		}
+		publicIPs = append(publicIPs, &armnetwork.SubResource{ID: resp.ID})
+	}
+
+	natClient, err := armnetwork.NewNatGatewaysClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create NAT gateway client: %w", err)
+	}
+	poller, err := natClient.BeginCreateOrUpdate(ctx, resourceGroup, clusternet.NATGatewayName, armnetwork.NatGateway{
+		Location: to.Ptr(location),
+		SKU: &armnetwork.NatGatewaySKU{
+			Name: to.Ptr(armnetwork.NatGatewaySKUNameStandard),
+		},
+		Properties: &armnetwork.NatGatewayPropertiesFormat{
+			PublicIPAddresses:    publicIPs,
+			IdleTimeoutInMinutes: to.Ptr[int32](4),
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create NAT gateway: %w", err)
+	}
+	resp, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to complete NAT gateway creation: %w", err)
+	}
+	fmt.Printf("NAT gateway '%s' created with %d public IPs\n", clusternet.NATGatewayName, count)
+	return *resp.ID, nil
+}
@@ -0,0 +1,181 @@
+#!/bin/bash
+# etcd snapshot backup and restore for k3a clusters. Runs as root on a control-plane node, which has
+# the Azure CLI, the etcd client certificates and the cluster MSI with Storage Blob Data Contributor
+# on the cluster storage account.
+#
+#   etcd.sh backup <storage-account> <retain>    snapshot etcd, upload it and keep the newest <retain>
+#   etcd.sh list <storage-account>               print snapshots as name, size and creation time
+#   etcd.sh restore <storage-account> <snapshot> restore a stacked etcd member from a snapshot
+#   etcd.sh stop                                 stop the local etcd and API server before a forced restore
+set -euo pipefail
+
+ETCD_VERSION=v3.5.21
+CONTAINER=etcd-backups
+MANIFESTS=/etc/kubernetes/manifests
+APISERVER=$MANIFESTS/kube-apiserver.yaml
+export PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+
+# manifest_flag prints the value of a flag in a static pod manifest
+manifest_flag() {
+  sed -n "s/^ *- --$2=//p" "$1" | head -n1
+}
+
+ensure_etcd_tools() {
+  if command -v etcdctl >/dev/null && command -v etcdutl >/dev/null; then
+    return
+  fi
+  local tmp
+  tmp=$(mktemp -d)
+  curl -fsSL "https://github.com/etcd-io/etcd/releases/download/${ETCD_VERSION}/etcd-${ETCD_VERSION}-linux-amd64.tar.gz" |
+    tar -xz -C "$tmp" --strip-components=1
+  install -m 0755 "$tmp/etcdctl" "$tmp/etcdutl" /usr/local/bin/
+  rm -rf "$tmp"
+}
+
+storage() {
+  az storage "$@" --account-name "$ACCOUNT" --auth-mode login --only-show-errors
+}
+
+backup() {
+  local retain=$1
+  if [ ! -f "$APISERVER" ]; then
+    echo "$APISERVER not found; not a control-plane node" >&2
+    exit 1
+  fi
+  # Snapshot the etcd the API server uses, whether stacked or external
+  local endpoints cacert cert key
+  endpoints=$(manifest_flag "$APISERVER" etcd-servers)
+  cacert=$(manifest_flag "$APISERVER" etcd-cafile)
+  cert=$(manifest_flag "$APISERVER" etcd-certfile)
+  key=$(manifest_flag "$APISERVER" etcd-keyfile)
+  ensure_etcd_tools
+
+  local name
+  name="etcd-$(date -u +%Y%m%dT%H%M%SZ).db"
+  FILE="/var/tmp/$name"
+  trap 'rm -f "$FILE"' EXIT
+  ETCDCTL_API=3 etcdctl --endpoints="${endpoints%%,*}" \
+    ${cacert:+--cacert="$cacert"} ${cert:+--cert="$cert"} ${key:+--key="$key"} \
+    snapshot save "$FILE" >/dev/null
+
+  az login --identity --output none
+  storage container create --name "$CONTAINER" --output none
+  storage blob upload --container-name "$CONTAINER" --name "$name" --file "$FILE" --output none
+  echo "uploaded $name"
+
+  # Snapshot names sort by time, so everything before the newest <retain> is expired
+  if [ "$retain" -gt 0 ]; then
+    storage blob list --container-name "$CONTAINER" --prefix etcd- --query "[].name" --output tsv |
+      sort | head -n -"$retain" | while read -r old; do
+      storage blob delete --container-name "$CONTAINER" --name "$old" --output none
+      echo "expired $old"
+    done
+  fi
+}
+
+# restore_exit removes the downloaded snapshot and, when a restore fails part way, moves the original
+# etcd data dir and the static pod manifests back so the node comes up as it was
+restore_exit() {
+  local status=$?
+  rm -f "$FILE"
+  [ "$status" -eq 0 ] && return
+  if [ -n "$DATA" ]; then
+    rm -rf "$DATA.restore"
+    if [ -n "$PREVIOUS" ] && [ -d "$PREVIOUS" ] && [ ! -d "$DATA" ]; then
+      mv "$PREVIOUS" "$DATA"
+      echo "restore failed; original etcd data moved back to $DATA" >&2
+    fi
+  fi
+  if [ -n "$STASH" ]; then
+    local manifest
+    for manifest in "$STASH"/*.yaml; do
+      [ -f "$manifest" ] || continue
+      mv "$manifest" "$MANIFESTS/"
+      echo "restore failed; $(basename "$manifest") moved back to $MANIFESTS" >&2
+    done
+  fi
+}
+
+list() {
+  az login --identity --output none
+  storage blob list --container-name "$CONTAINER" --prefix etcd- \
+    --query "[].[name, properties.contentLength, properties.creationTime]" --output tsv
+}
+
+restore() {
+  local snapshot=$1
+  if [ ! -f "$MANIFESTS/etcd.yaml" ]; then
+    echo "etcd is external ($(manifest_flag "$APISERVER" etcd-servers)); restore $snapshot on the etcd hosts with etcdutl snapshot restore" >&2
+    exit 2
+  fi
+  local name peer
+  name=$(manifest_flag "$MANIFESTS/etcd.yaml" name)
+  peer=$(manifest_flag "$MANIFESTS/etcd.yaml" initial-advertise-peer-urls)
+  DATA=$(manifest_flag "$MANIFESTS/etcd.yaml" data-dir)
+  ensure_etcd_tools
+
+  FILE="/var/tmp/$snapshot"
+  trap restore_exit EXIT
+  az login --identity --output none
+  storage blob download --container-name "$CONTAINER" --name "$snapshot" --file "$FILE" --output none
+  etcdutl snapshot status "$FILE" >/dev/null
+
+  # Stop the API server and etcd by moving their static pod manifests aside
+  STASH=/var/tmp/k3a-restore-manifests
+  mkdir -p "$STASH"
+  mv "$APISERVER" "$MANIFESTS/etcd.yaml" "$STASH/"
+  for _ in $(seq 60); do
+    crictl ps --quiet --name 'etcd|kube-apiserver' | grep -q . || break
+    sleep 2
+  done
+
+  PREVIOUS="$DATA.$(date -u +%Y%m%dT%H%M%SZ)"
+  rm -rf "$DATA.restore"
+  etcdutl snapshot restore "$FILE" --name "$name" --initial-cluster "$name=$peer" \
+    --initial-advertise-peer-urls "$peer" --data-dir "$DATA.restore"
+  mv "$DATA" "$PREVIOUS"
+  mv "$DATA.restore" "$DATA"
+  mv "$STASH/etcd.yaml" "$STASH/kube-apiserver.yaml" "$MANIFESTS/"
+  echo "restored $snapshot; previous etcd data kept in $PREVIOUS"
+
+  for _ in $(seq 60); do
+    if curl -fsk https://127.0.0.1:6443/readyz >/dev/null; then
+      echo "API server is ready"
+      return
+    fi
+    sleep 5
+  done
+  echo "API server not ready after 5 minutes" >&2
+  exit 1
+}
+
+stop() {
+  if [ ! -f "$MANIFESTS/etcd.yaml" ]; then
+    echo "no stacked etcd on this node" >&2
+    exit 2
+  fi
+  # Moved out of the manifests dir for good: the instance is deleted and rejoins fresh
+  mkdir -p /var/tmp/k3a-stopped-manifests
+  mv "$APISERVER" "$MANIFESTS/etcd.yaml" /var/tmp/k3a-stopped-manifests/
+  for _ in $(seq 60); do
+    crictl ps --quiet --name 'etcd|kube-apiserver' | grep -q . || break
+    sleep 2
+  done
+  echo "stopped etcd and the API server"
+}
+
+ACCOUNT=${2:-}
+FILE=
+DATA=
+PREVIOUS=
+STASH=
+case "${1:-}" in
+backup) backup "${3:-7}" ;;
+list) list ;;
+restore) restore "$3" ;;
+stop) stop ;;
+*)
+  echo "usage: $0 backup|list|restore <storage-account> [retain|snapshot] | stop" >&2
+  exit 1
+  ;;
+esac
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+)
+
+// IdentityName is the user-assigned managed identity cluster create attaches to every node
+const IdentityName = "k3a-msi"
+
+// Identity returns the cluster's managed identity, which in-cluster components reach through IMDS
+func Identity(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (*armmsi.Identity, error) {
+	msiClient, err := armmsi.NewUserAssignedIdentitiesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MSI client: %w", err)
+	}
+	msi, err := msiClient.Get(ctx, cluster, IdentityName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed identity '%s': %w", IdentityName, err)
+	}
+	if msi.Properties == nil || msi.Properties.PrincipalID == nil || msi.Properties.ClientID == nil {
+		return nil, fmt.Errorf("managed identity '%s' has no principal or client ID", IdentityName)
+	}
+	return &msi.Identity, nil
+}
+
+// GrantIdentityRole assigns a built-in role, given by its role definition GUID, to the cluster's managed
+// identity on the cluster resource group. Granting a role the identity already has is a no-op.
+func GrantIdentityRole(ctx context.Context, subscriptionID, cluster, roleDefinitionGUID string, cred *azidentity.DefaultAzureCredential) error {
+	msi, err := Identity(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	roleAssignmentsClient, err := armauthorization.NewRoleAssignmentsClient(subscriptionID, cred, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			APIVersion: "2022-04-01",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create role assignments client: %w", err)
+	}
+	scope := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", subscriptionID, cluster)
+	roleAssignmentName := kstrings.DeterministicGUID(scope + *msi.ID + roleDefinitionGUID)
+	err = retryRoleAssignment(ctx, roleAssignmentsClient, scope, roleAssignmentName, armauthorization.RoleAssignmentCreateParameters{
+		Properties: &armauthorization.RoleAssignmentProperties{
+			PrincipalID:      msi.Properties.PrincipalID,
+			RoleDefinitionID: to.Ptr(fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", subscriptionID, roleDefinitionGUID)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to assign role %s to managed identity '%s': %w", roleDefinitionGUID, IdentityName, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/jwilder/k3a/pkg/kube"
+)
+
+// What cluster create does with a soft-deleted Key Vault left behind by an earlier cluster of the same name
+const (
+	DeletedKeyVaultRecover = "recover"
+	DeletedKeyVaultPurge   = "purge"
+)
+
+// getDeletedKeyVault returns the soft-deleted vault with the given name, or nil if there is none
+func getDeletedKeyVault(ctx context.Context, client *armkeyvault.VaultsClient, name string) (*armkeyvault.DeletedVault, error) {
+	pager := client.NewListDeletedPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deleted Key Vaults: %w", err)
+		}
+		for _, vault := range page.Value {
+			if vault.Name != nil && strings.EqualFold(*vault.Name, name) && vault.Properties != nil && vault.Properties.Location != nil {
+				return vault, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// purgeDeletedKeyVault permanently deletes a soft-deleted vault and its secrets
+func purgeDeletedKeyVault(ctx context.Context, client *armkeyvault.VaultsClient, vault *armkeyvault.DeletedVault) error {
+	if vault.Properties.PurgeProtectionEnabled != nil && *vault.Properties.PurgeProtectionEnabled {
+		purgeDate := "its scheduled purge date"
+		if vault.Properties.ScheduledPurgeDate != nil {
+			purgeDate = vault.Properties.ScheduledPurgeDate.Local().Format(time.RFC1123)
+		}
+		return fmt.Errorf("deleted Key Vault '%s' has purge protection enabled and cannot be purged before %s", *vault.Name, purgeDate)
+	}
+	fmt.Printf("Purging soft-deleted Key Vault '%s'...\n", *vault.Name)
+	poller, err := client.BeginPurgeDeleted(ctx, *vault.Name, *vault.Properties.Location, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start purging Key Vault '%s': %w", *vault.Name, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to purge Key Vault '%s': %w", *vault.Name, err)
+	}
+	return nil
+}
+
+// resolveDeletedKeyVault deals with a soft-deleted vault that would block creating the cluster's vault.
+// It purges the vault when mode is purge and reports whether the vault should be created in recover mode.
+func resolveDeletedKeyVault(ctx context.Context, subscriptionID, cluster, location, mode string, cred *azidentity.DefaultAzureCredential) (bool, error) {
+	if mode == "" {
+		mode = DeletedKeyVaultRecover
+	}
+	if mode != DeletedKeyVaultRecover && mode != DeletedKeyVaultPurge {
+		return false, fmt.Errorf("invalid deleted Key Vault mode: %s (must be '%s' or '%s')", mode, DeletedKeyVaultRecover, DeletedKeyVaultPurge)
+	}
+	client, err := armkeyvault.NewVaultsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+	vault, err := getDeletedKeyVault(ctx, client, kube.KeyVaultName(cluster))
+	if err != nil || vault == nil {
+		return false, err
+	}
+
+	deletedLocation := *vault.Properties.Location
+	fmt.Printf("Found soft-deleted Key Vault '%s' in %s from a previous cluster named '%s'.\n", *vault.Name, deletedLocation, cluster)
+	if mode == DeletedKeyVaultPurge {
+		return false, purgeDeletedKeyVault(ctx, client, vault)
+	}
+	if !strings.EqualFold(strings.ReplaceAll(deletedLocation, " ", ""), location) {
+		return false, fmt.Errorf("soft-deleted Key Vault '%s' is in %s and can only be recovered there; create the cluster in %s or pass --deleted-keyvault %s",
+			*vault.Name, deletedLocation, deletedLocation, DeletedKeyVaultPurge)
+	}
+	fmt.Printf("Recovering Key Vault '%s'; its secrets are replaced as the cluster is bootstrapped.\n", *vault.Name)
+	return true, nil
+}
+
+// purgeClusterKeyVault purges the cluster's soft-deleted Key Vault, if there is one
+func purgeClusterKeyVault(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) error {
+	client, err := armkeyvault.NewVaultsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+	vault, err := getDeletedKeyVault(ctx, client, kube.KeyVaultName(cluster))
+	if err != nil {
+		return err
+	}
+	if vault == nil {
+		fmt.Printf("No soft-deleted Key Vault found for cluster '%s'.\n", cluster)
+		return nil
+	}
+	return purgeDeletedKeyVault(ctx, client, vault)
+}
@@ -0,0 +1,327 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/cidr"
+	"github.com/jwilder/k3a/pkg/clusternet"
+)
+
+// IP families accepted by cluster create
+const (
+	IPFamilyIPv4 = clusternet.IPFamilyIPv4
+	IPFamilyDual = clusternet.IPFamilyDual
+)
+
+// nodeNetwork is the VNet and node subnet a cluster uses
+type nodeNetwork struct {
+	VnetID         string
+	SubnetID       string
+	SubnetPrefix   string
+	SubnetPrefixV6 string // IPv6 /64 of the node subnet, dual-stack only
+	AddressSpace   string
+	AddressSpaceV6 string
+	Existing       bool   // VNet brought by the user instead of the k3a-vnet created with the cluster
+	CreateSubnet   bool   // k3a adds its node subnet, clusternet.NodeSubnetName, to the VNet
+	NATGatewayID   string // NAT gateway attached to the node subnet for egress, if any
+}
+
+// resolveNodeNetwork works out the node subnet from --subnet-id, --vnet-id or the address space
+// of the VNet k3a creates, then checks it against the pod and service CIDRs and peered ranges.
+func resolveNodeNetwork(ctx context.Context, subscriptionID, cluster, vnetName string, args CreateArgs, cred *azidentity.DefaultAzureCredential) (nodeNetwork, error) {
+	var network nodeNetwork
+	var vnet *armnetwork.VirtualNetwork
+	dualStack := args.IPFamily == IPFamilyDual
+
+	switch {
+	case args.SubnetID != "":
+		subnetResourceID, err := arm.ParseResourceID(args.SubnetID)
+		if err != nil {
+			return network, fmt.Errorf("invalid --subnet-id: %w", err)
+		}
+		if subnetResourceID.Parent == nil || subnetResourceID.ResourceType.String() != "Microsoft.Network/virtualNetworks/subnets" {
+			return network, fmt.Errorf("--subnet-id must be a subnet resource ID")
+		}
+		vnetResourceID := subnetResourceID.Parent
+		if args.VnetID != "" && !strings.EqualFold(args.VnetID, vnetResourceID.String()) {
+			return network, fmt.Errorf("--subnet-id is not in the VNet given by --vnet-id")
+		}
+		subnetClient, err := armnetwork.NewSubnetsClient(subnetResourceID.SubscriptionID, cred, nil)
+		if err != nil {
+			return network, fmt.Errorf("failed to create subnet client: %w", err)
+		}
+		subnet, err := subnetClient.Get(ctx, subnetResourceID.ResourceGroupName, vnetResourceID.Name, subnetResourceID.Name, nil)
+		if err != nil {
+			return network, fmt.Errorf("failed to get subnet '%s': %w", args.SubnetID, err)
+		}
+		v4, v6 := splitFamilies(clusternet.SubnetPrefixes(subnet.Properties))
+		if len(v4) == 0 {
+			return network, fmt.Errorf("subnet '%s' has no IPv4 address prefix", args.SubnetID)
+		}
+		if dualStack && len(v6) == 0 {
+			return network, fmt.Errorf("subnet '%s' has no IPv6 address prefix, which a dual-stack cluster needs", args.SubnetID)
+		}
+		vnet, err = getVirtualNetwork(ctx, vnetResourceID, cred)
+		if err != nil {
+			return network, err
+		}
+		network = nodeNetwork{
+			VnetID:       vnetResourceID.String(),
+			SubnetID:     *subnet.ID,
+			SubnetPrefix: v4[0],
+			Existing:     true,
+		}
+		if dualStack {
+			network.SubnetPrefixV6 = v6[0]
+		}
+
+	case args.VnetID != "":
+		vnetResourceID, err := arm.ParseResourceID(args.VnetID)
+		if err != nil {
+			return network, fmt.Errorf("invalid --vnet-id: %w", err)
+		}
+		vnet, err = getVirtualNetwork(ctx, vnetResourceID, cred)
+		if err != nil {
+			return network, err
+		}
+		if vnet.Properties == nil || vnet.Properties.AddressSpace == nil || len(vnet.Properties.AddressSpace.AddressPrefixes) == 0 {
+			return network, fmt.Errorf("VNet '%s' has no address space", args.VnetID)
+		}
+		// Carve the node subnet out of the first address prefix of each family, skipping existing subnets.
+		// The node subnet k3a added on an earlier run keeps its prefixes.
+		var used, ownV4, ownV6 []string
+		for _, subnet := range vnet.Properties.Subnets {
+			if subnet.Name != nil && *subnet.Name == clusternet.NodeSubnetName {
+				ownV4, ownV6 = splitFamilies(clusternet.SubnetPrefixes(subnet.Properties))
+				continue
+			}
+			used = append(used, clusternet.SubnetPrefixes(subnet.Properties)...)
+		}
+		var spaces []string
+		for _, prefix := range vnet.Properties.AddressSpace.AddressPrefixes {
+			spaces = append(spaces, *prefix)
+		}
+		v4Spaces, v6Spaces := splitFamilies(spaces)
+		if len(v4Spaces) == 0 {
+			return network, fmt.Errorf("VNet '%s' has no IPv4 address space", args.VnetID)
+		}
+		var prefix string
+		if len(ownV4) > 0 {
+			prefix = ownV4[0]
+		} else if prefix, err = deriveSubnetPrefix(v4Spaces[0], used); err != nil {
+			return network, fmt.Errorf("failed to find a free node subnet in VNet '%s' (use --subnet-id): %w", args.VnetID, err)
+		}
+		network = nodeNetwork{
+			VnetID:       vnetResourceID.String(),
+			SubnetID:     vnetResourceID.String() + "/subnets/" + clusternet.NodeSubnetName,
+			SubnetPrefix: prefix,
+			AddressSpace: v4Spaces[0],
+			Existing:     true,
+			CreateSubnet: true,
+		}
+		if dualStack {
+			if len(v6Spaces) == 0 {
+				return network, fmt.Errorf("VNet '%s' has no IPv6 address space, which a dual-stack cluster needs", args.VnetID)
+			}
+			if len(ownV6) > 0 {
+				network.SubnetPrefixV6 = ownV6[0]
+			} else {
+				prefixV6, err := cidr.NextFree(v6Spaces[0], 64, used)
+				if err != nil {
+					return network, fmt.Errorf("failed to find a free IPv6 node subnet in VNet '%s' (use --subnet-id): %w", args.VnetID, err)
+				}
+				network.SubnetPrefixV6 = prefixV6
+			}
+			network.AddressSpaceV6 = v6Spaces[0]
+		}
+
+	default:
+		vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", subscriptionID, cluster, vnetName)
+		network = nodeNetwork{
+			VnetID:       vnetID,
+			SubnetID:     vnetID + "/subnets/default",
+			AddressSpace: args.VnetAddressSpace,
+		}
+		// Keep the subnet of a VNet k3a already created so re-running create doesn't try to move it
+		vnetClient, err := armnetwork.NewVirtualNetworksClient(subscriptionID, cred, nil)
+		if err != nil {
+			return network, fmt.Errorf("failed to create VNet client: %w", err)
+		}
+		if existing, err := vnetClient.Get(ctx, cluster, vnetName, nil); err == nil && existing.Properties != nil {
+			vnet = &existing.VirtualNetwork
+			for _, subnet := range vnet.Properties.Subnets {
+				if subnet.Name != nil && *subnet.Name == "default" {
+					v4, v6 := splitFamilies(clusternet.SubnetPrefixes(subnet.Properties))
+					if len(v4) > 0 {
+						network.SubnetPrefix = v4[0]
+					}
+					if dualStack && len(v6) > 0 {
+						network.SubnetPrefixV6 = v6[0]
+					}
+				}
+			}
+		}
+		if network.SubnetPrefix == "" {
+			prefix, err := deriveSubnetPrefix(args.VnetAddressSpace, nil)
+			if err != nil {
+				return network, err
+			}
+			network.SubnetPrefix = prefix
+		}
+		if dualStack {
+			network.AddressSpaceV6 = cidr.VnetIPv6AddressSpace
+			if network.SubnetPrefixV6 == "" {
+				prefixV6, err := cidr.NextFree(cidr.VnetIPv6AddressSpace, 64, nil)
+				if err != nil {
+					return network, err
+				}
+				network.SubnetPrefixV6 = prefixV6
+			}
+		}
+	}
+
+	ranges := []cidr.Range{
+		{Name: "node subnet", CIDR: network.SubnetPrefix},
+		{Name: "pod CIDR", CIDR: cidr.PodCIDR},
+		{Name: "service CIDR", CIDR: cidr.ServiceCIDR},
+	}
+	if dualStack {
+		ranges = append(ranges,
+			cidr.Range{Name: "IPv6 node subnet", CIDR: network.SubnetPrefixV6},
+			cidr.Range{Name: "IPv6 pod CIDR", CIDR: cidr.PodCIDRv6},
+			cidr.Range{Name: "IPv6 service CIDR", CIDR: cidr.ServiceCIDRv6},
+		)
+	}
+	if vnet != nil && vnet.Properties != nil {
+		for _, peering := range vnet.Properties.VirtualNetworkPeerings {
+			if peering.Properties == nil || peering.Properties.RemoteAddressSpace == nil {
+				continue
+			}
+			for _, prefix := range peering.Properties.RemoteAddressSpace.AddressPrefixes {
+				ranges = append(ranges, cidr.Range{Name: fmt.Sprintf("peered range (%s)", *peering.Name), CIDR: *prefix})
+			}
+		}
+	}
+	if err := cidr.ValidateNoOverlap(ranges); err != nil {
+		return network, fmt.Errorf("invalid cluster network: %w", err)
+	}
+
+	return network, nil
+}
+
+// deriveSubnetPrefix picks the first free node subnet in the address space: a /16 in larger spaces
+// and a quarter of a /16 or smaller space, but no smaller than a /24, so pool subnets still fit
+func deriveSubnetPrefix(space string, used []string) (string, error) {
+	prefixLen, err := cidr.PrefixLen(space)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case prefixLen < 16:
+		prefixLen = 16
+	case prefixLen+2 <= 24:
+		prefixLen += 2
+	case prefixLen < 24:
+		prefixLen = 24
+	}
+	return cidr.NextFree(space, prefixLen, used)
+}
+
+// splitFamilies separates IPv4 and IPv6 CIDRs
+func splitFamilies(cidrs []string) (v4, v6 []string) {
+	for _, c := range cidrs {
+		if cidr.IsIPv6(c) {
+			v6 = append(v6, c)
+		} else {
+			v4 = append(v4, c)
+		}
+	}
+	return v4, v6
+}
+
+// subnetProperties returns the address settings for the node subnet, using AddressPrefixes when it is dual-stack
+func (n nodeNetwork) subnetProperties(nsgID string) *armnetwork.SubnetPropertiesFormat {
+	props := &armnetwork.SubnetPropertiesFormat{
+		NetworkSecurityGroup: &armnetwork.SecurityGroup{ID: to.Ptr(nsgID)},
+	}
+	if n.NATGatewayID != "" {
+		props.NatGateway = &armnetwork.SubResource{ID: to.Ptr(n.NATGatewayID)}
+	}
+	if n.SubnetPrefixV6 != "" {
+		props.AddressPrefixes = []*string{to.Ptr(n.SubnetPrefix), to.Ptr(n.SubnetPrefixV6)}
+	} else {
+		props.AddressPrefix = to.Ptr(n.SubnetPrefix)
+	}
+	return props
+}
+
+func getVirtualNetwork(ctx context.Context, id *arm.ResourceID, cred *azidentity.DefaultAzureCredential) (*armnetwork.VirtualNetwork, error) {
+	vnetClient, err := armnetwork.NewVirtualNetworksClient(id.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VNet client: %w", err)
+	}
+	vnet, err := vnetClient.Get(ctx, id.ResourceGroupName, id.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VNet '%s': %w", id.String(), err)
+	}
+	return &vnet.VirtualNetwork, nil
+}
+
+// attachSubnet adds k3a's default subnet to a user VNet, or attaches the k3a NSG (when the subnet has none)
+// and the NAT gateway to a user subnet
+func attachSubnet(ctx context.Context, network nodeNetwork, nsgID string, cred *azidentity.DefaultAzureCredential) error {
+	subnetResourceID, err := arm.ParseResourceID(network.SubnetID)
+	if err != nil {
+		return fmt.Errorf("invalid subnet ID '%s': %w", network.SubnetID, err)
+	}
+	subnetClient, err := armnetwork.NewSubnetsClient(subnetResourceID.SubscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet client: %w", err)
+	}
+
+	subnet := armnetwork.Subnet{
+		Properties: network.subnetProperties(nsgID),
+	}
+	if !network.CreateSubnet {
+		existing, err := subnetClient.Get(ctx, subnetResourceID.ResourceGroupName, subnetResourceID.Parent.Name, subnetResourceID.Name, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get subnet: %w", err)
+		}
+		subnet = existing.Subnet
+		if subnet.Properties == nil {
+			subnet.Properties = &armnetwork.SubnetPropertiesFormat{}
+		}
+		changed := false
+		if subnet.Properties.NetworkSecurityGroup != nil {
+			fmt.Printf("Subnet '%s' already has an NSG, leaving it in place (k3a nsg commands manage k3a-nsg only)\n", subnetResourceID.Name)
+		} else {
+			subnet.Properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: to.Ptr(nsgID)}
+			changed = true
+		}
+		if network.NATGatewayID != "" {
+			if subnet.Properties.NatGateway != nil && subnet.Properties.NatGateway.ID != nil && !strings.EqualFold(*subnet.Properties.NatGateway.ID, network.NATGatewayID) {
+				return fmt.Errorf("subnet '%s' already uses NAT gateway '%s'", subnetResourceID.Name, *subnet.Properties.NatGateway.ID)
+			}
+			subnet.Properties.NatGateway = &armnetwork.SubResource{ID: to.Ptr(network.NATGatewayID)}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+	}
+
+	poller, err := subnetClient.BeginCreateOrUpdate(ctx, subnetResourceID.ResourceGroupName, subnetResourceID.Parent.Name, subnetResourceID.Name, subnet, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update subnet '%s': %w", subnetResourceID.Name, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to complete subnet update: %w", err)
+	}
+	return nil
+}
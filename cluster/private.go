@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/privatedns/armprivatedns"
+)
+
+// privateDNSZoneName returns the private DNS zone used for a private cluster's API server
+func privateDNSZoneName(cluster string) string {
+	return fmt.Sprintf("%s.k3a.internal", cluster)
+}
+
+// createInternalLoadBalancer provisions the internal Standard Load Balancer that carries the API server
+// (port 6443) and the SSH NAT pool of a private cluster. It returns the frontend's private IP.
+func createInternalLoadBalancer(ctx context.Context, subscriptionID, resourceGroup, location, lbName, subnetID string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create load balancer client: %w", err)
+	}
+	frontendIPConfigName := "LoadBalancerFrontend"
+
+	// Keep backend pools added by pool create if the LB already exists
+	existingBackendPools := []*armnetwork.BackendAddressPool{}
+	getLB, err := lbClient.Get(ctx, resourceGroup, lbName, nil)
+	if err == nil && getLB.LoadBalancer.Properties != nil && getLB.LoadBalancer.Properties.BackendAddressPools != nil {
+		existingBackendPools = getLB.LoadBalancer.Properties.BackendAddressPools
+	}
+
+	poller, err := lbClient.BeginCreateOrUpdate(ctx, resourceGroup, lbName, armnetwork.LoadBalancer{
+		Location: to.Ptr(location),
+		SKU: &armnetwork.LoadBalancerSKU{
+			Name: to.Ptr(armnetwork.LoadBalancerSKUNameStandard),
+		},
+		Properties: &armnetwork.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: []*armnetwork.FrontendIPConfiguration{
+				{
+					Name: to.Ptr(frontendIPConfigName),
+					Properties: &armnetwork.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodDynamic),
+						Subnet:                    &armnetwork.Subnet{ID: to.Ptr(subnetID)},
+					},
+				},
+			},
+			BackendAddressPools: existingBackendPools,
+			InboundNatPools: []*armnetwork.InboundNatPool{
+				{
+					Name: to.Ptr("ssh"),
+					Properties: &armnetwork.InboundNatPoolPropertiesFormat{
+						FrontendIPConfiguration: &armnetwork.SubResource{
+							ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", subscriptionID, resourceGroup, lbName, frontendIPConfigName)),
+						},
+						Protocol:               to.Ptr(armnetwork.TransportProtocolTCP),
+						FrontendPortRangeStart: to.Ptr[int32](50000),
+						FrontendPortRangeEnd:   to.Ptr[int32](50100),
+						BackendPort:            to.Ptr[int32](22),
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create internal load balancer: %w", err)
+	}
+	resp, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to complete internal load balancer creation: %w", err)
+	}
+
+	for _, frontend := range resp.Properties.FrontendIPConfigurations {
+		if frontend.Properties != nil && frontend.Properties.PrivateIPAddress != nil {
+			return *frontend.Properties.PrivateIPAddress, nil
+		}
+	}
+	return "", fmt.Errorf("internal load balancer '%s' has no private frontend IP", lbName)
+}
+
+// createPrivateDNSZone creates the cluster's private DNS zone, links it to the VNet and points the api record at the internal LB
+func createPrivateDNSZone(ctx context.Context, subscriptionID, resourceGroup, zoneName, vnetID, apiIP string, cred *azidentity.DefaultAzureCredential) error {
+	zonesClient, err := armprivatedns.NewPrivateZonesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create private DNS zones client: %w", err)
+	}
+	zonePoller, err := zonesClient.BeginCreateOrUpdate(ctx, resourceGroup, zoneName, armprivatedns.PrivateZone{
+		Location: to.Ptr("global"),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create private DNS zone: %w", err)
+	}
+	if _, err := zonePoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to complete private DNS zone creation: %w", err)
+	}
+
+	linksClient, err := armprivatedns.NewVirtualNetworkLinksClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create private DNS VNet links client: %w", err)
+	}
+	linkPoller, err := linksClient.BeginCreateOrUpdate(ctx, resourceGroup, zoneName, "k3a-vnet-link", armprivatedns.VirtualNetworkLink{
+		Location: to.Ptr("global"),
+		Properties: &armprivatedns.VirtualNetworkLinkProperties{
+			VirtualNetwork:      &armprivatedns.SubResource{ID: to.Ptr(vnetID)},
+			RegistrationEnabled: to.Ptr(false),
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to link private DNS zone to VNet: %w", err)
+	}
+	if _, err := linkPoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to complete private DNS zone VNet link: %w", err)
+	}
+
+	recordsClient, err := armprivatedns.NewRecordSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create private DNS record sets client: %w", err)
+	}
+	_, err = recordsClient.CreateOrUpdate(ctx, resourceGroup, zoneName, armprivatedns.RecordTypeA, "api", armprivatedns.RecordSet{
+		Properties: &armprivatedns.RecordSetProperties{
+			TTL:      to.Ptr[int64](300),
+			ARecords: []*armprivatedns.ARecord{{IPv4Address: to.Ptr(apiIP)}},
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create API server DNS record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jwilder/k3a/pkg/protect"
+)
+
+type ProtectArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Lock           bool
+}
+
+// Protect tags the cluster resource group k3a-protected=true and, with Lock, adds a CanNotDelete lock
+func Protect(args ProtectArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	if err := protect.Set(context.Background(), args.SubscriptionID, protect.ResourceGroupID(args.SubscriptionID, args.Cluster), args.Lock, cred); err != nil {
+		return err
+	}
+	fmt.Printf("Cluster '%s' is protected from deletion.\n", args.Cluster)
+	return nil
+}
+
+// Unprotect removes the protection tag and the k3a lock from the cluster resource group
+func Unprotect(args ProtectArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	if err := protect.Clear(context.Background(), args.SubscriptionID, protect.ResourceGroupID(args.SubscriptionID, args.Cluster), cred); err != nil {
+		return err
+	}
+	fmt.Printf("Cluster '%s' is no longer protected from deletion.\n", args.Cluster)
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jwilder/k3a/addon"
+	"github.com/spf13/cobra"
+)
+
+var addonCmd = &cobra.Command{
+	Use:   "addon",
+	Short: "Manage cluster addons",
+}
+
+var listAddonsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available and installed addons",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster, _ := cmd.Flags().GetString("cluster")
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		return addon.List(addon.ListArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+		})
+	},
+}
+
+var installAddonCmd = &cobra.Command{
+	Use:   "install <name>",
+	Short: "Install or upgrade an addon",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster, _ := cmd.Flags().GetString("cluster")
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		set, _ := cmd.Flags().GetStringToString("set")
+		return addon.Install(addon.InstallArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			Name:           args[0],
+			Set:            set,
+		})
+	},
+}
+
+var removeAddonCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove an installed addon",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster, _ := cmd.Flags().GetString("cluster")
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		return addon.Remove(addon.RemoveArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			Name:           args[0],
+		})
+	},
+}
+
+func init() {
+	clusterDefault := ""
+	if v := os.Getenv("K3A_CLUSTER"); v != "" {
+		clusterDefault = v
+	}
+
+	listAddonsCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+
+	installAddonCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	installAddonCmd.Flags().StringToString("set", nil, "Addon setting as key=value (repeatable)")
+
+	removeAddonCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+
+	addonCmd.AddCommand(listAddonsCmd, installAddonCmd, removeAddonCmd)
+	rootCmd.AddCommand(addonCmd)
+}
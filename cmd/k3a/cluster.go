@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/jwilder/k3a/cluster"
 	"github.com/jwilder/k3a/pkg/spinner"
+	"github.com/jwilder/k3a/pool"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +29,15 @@ var createClusterCmd = &cobra.Command{
 		}
 		region, _ := cmd.Flags().GetString("region")
 		vnetAddressSpace, _ := cmd.Flags().GetString("vnet-address-space")
+		vnetID, _ := cmd.Flags().GetString("vnet-id")
+		subnetID, _ := cmd.Flags().GetString("subnet-id")
+		private, _ := cmd.Flags().GetBool("private")
+		ipFamily, _ := cmd.Flags().GetString("ip-family")
+		egress, _ := cmd.Flags().GetString("egress")
+		allowedSources, _ := cmd.Flags().GetStringArray("allowed-source")
+		outboundIPs, _ := cmd.Flags().GetInt("outbound-ips")
+		snatPorts, _ := cmd.Flags().GetInt("snat-ports-per-instance")
+		deletedKeyVault, _ := cmd.Flags().GetString("deleted-keyvault")
 
 		done := spinner.Spinner(fmt.Sprintf("Creating cluster '%s' in region '%s'...", clusterName, region))
 		defer done()
@@ -36,6 +47,15 @@ var createClusterCmd = &cobra.Command{
 			Cluster:          clusterName,
 			Location:         region,
 			VnetAddressSpace: vnetAddressSpace,
+			VnetID:           vnetID,
+			SubnetID:         subnetID,
+			Private:          private,
+			IPFamily:         ipFamily,
+			Egress:           egress,
+			OutboundIPs:      outboundIPs,
+			SNATPorts:        snatPorts,
+			AllowedSources:   allowedSources,
+			DeletedKeyVault:  deletedKeyVault,
 		}); err != nil {
 			return fmt.Errorf("failed to create cluster: %w", err)
 		}
@@ -44,6 +64,32 @@ var createClusterCmd = &cobra.Command{
 	},
 }
 
+var accessRangesCmd = &cobra.Command{
+	Use:   "access-ranges",
+	Short: "Manage the sources allowed to reach the API server and SSH",
+}
+
+var setAccessRangesCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Replace the sources allowed to reach the API server and SSH",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		allowedSources, _ := cmd.Flags().GetStringArray("allowed-source")
+		return cluster.SetAccessRanges(cluster.SetAccessRangesArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+			Sources:        allowedSources,
+		})
+	},
+}
+
 var listClustersCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List cluster deployments",
@@ -70,12 +116,22 @@ var deleteClusterCmd = &cobra.Command{
 		if subscriptionID == "" {
 			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
 		}
-		done := spinner.Spinner(fmt.Sprintf("Deleting cluster '%s'...", clusterName))
-		defer done()
-		if err := cluster.Delete(cluster.DeleteArgs{
+		purge, _ := cmd.Flags().GetBool("purge")
+		deleteArgs := cluster.DeleteArgs{
 			SubscriptionID: subscriptionID,
 			Cluster:        clusterName,
-		}); err != nil {
+			Purge:          purge,
+		}
+		plan, err := cluster.DeletePlan(deleteArgs)
+		if err != nil {
+			return err
+		}
+		if err := confirmDelete(cmd, plan); err != nil {
+			return err
+		}
+		done := spinner.Spinner(fmt.Sprintf("Deleting cluster '%s'...", clusterName))
+		defer done()
+		if err := cluster.Delete(deleteArgs); err != nil {
 			return fmt.Errorf("failed to delete cluster: %w", err)
 		}
 		fmt.Printf("Cluster '%s' deleted successfully\n", clusterName)
@@ -83,19 +139,188 @@ var deleteClusterCmd = &cobra.Command{
 	},
 }
 
+var protectClusterCmd = &cobra.Command{
+	Use:   "protect",
+	Short: "Protect a cluster from deletion",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		lock, _ := cmd.Flags().GetBool("lock")
+		return cluster.Protect(cluster.ProtectArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+			Lock:           lock,
+		})
+	},
+}
+
+var unprotectClusterCmd = &cobra.Command{
+	Use:   "unprotect",
+	Short: "Remove deletion protection from a cluster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		return cluster.Unprotect(cluster.ProtectArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+		})
+	},
+}
+
+var describeClusterCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Show how a cluster and its pools were created",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		return cluster.Describe(cluster.DescribeArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+		})
+	},
+}
+
+var rotateJoinClusterCmd = &cobra.Command{
+	Use:   "rotate-join",
+	Short: "Mint a new join token and certificate key and update the join secrets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		return pool.RotateJoin(pool.RotateJoinArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+		})
+	},
+}
+
+var backupClusterCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up etcd to the cluster storage account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			return cluster.ListBackups(cluster.ListBackupsArgs{
+				SubscriptionID: subscriptionID,
+				Cluster:        clusterName,
+			})
+		}
+		retain, _ := cmd.Flags().GetInt("retain")
+		return cluster.Backup(cluster.BackupArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+			Retain:         retain,
+		})
+	},
+}
+
+var restoreClusterCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore the control plane from an etcd snapshot",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName, _ := cmd.Flags().GetString("cluster")
+		if clusterName == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		snapshot, _ := cmd.Flags().GetString("snapshot")
+		force, _ := cmd.Flags().GetBool("force")
+		return cluster.Restore(cluster.RestoreArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        clusterName,
+			Snapshot:       snapshot,
+			Force:          force,
+		})
+	},
+}
+
 func init() {
 	// Cluster create flags
 	createClusterCmd.Flags().String("cluster", "", "Cluster name (or set K3A_CLUSTER) (required)")
 	createClusterCmd.Flags().String("region", "", "Azure region for the cluster (e.g., canadacentral) (required)")
 	createClusterCmd.Flags().String("vnet-address-space", "10.0.0.0/8", "VNet address space (CIDR, e.g. 10.0.0.0/8)")
+	createClusterCmd.Flags().String("vnet-id", "", "Existing VNet resource ID; k3a adds (or reuses) a 'k3a-nodes' node subnet carved from its address space")
+	createClusterCmd.Flags().String("subnet-id", "", "Existing subnet resource ID to place nodes in")
+	createClusterCmd.Flags().StringArray("allowed-source", nil, "CIDR, IP or service tag allowed to reach the API server and SSH (can be specified multiple times; default: your public IP)")
+	createClusterCmd.Flags().String("egress", "loadbalancer", "Outbound connectivity: loadbalancer (outbound rule) or nat-gateway")
+	createClusterCmd.Flags().Int("outbound-ips", 5, "Number of public IPs for outbound traffic")
+	createClusterCmd.Flags().Int("snat-ports-per-instance", 192, "SNAT ports allocated to each instance by the load balancer outbound rule (multiple of 8)")
+	createClusterCmd.Flags().String("ip-family", "ipv4", "IP family of the cluster network: ipv4 or dual (IPv4/IPv6 dual-stack)")
+	createClusterCmd.Flags().Bool("private", false, "Create a private cluster: API server and SSH only reachable inside the VNet through an internal load balancer")
+	createClusterCmd.Flags().String("deleted-keyvault", "recover", "What to do with a soft-deleted Key Vault left by a previous cluster of the same name: recover or purge")
 	_ = createClusterCmd.MarkFlagRequired("region")
 
 	// Cluster delete flags
 	deleteClusterCmd.Flags().String("cluster", "", "Cluster name (required)")
+	deleteClusterCmd.Flags().Bool("yes", false, "Delete without asking for confirmation")
+	deleteClusterCmd.Flags().Bool("purge", false, "Purge the soft-deleted Key Vault and its secrets so the cluster name can be reused")
 	_ = deleteClusterCmd.MarkFlagRequired("cluster")
+	noContext(deleteClusterCmd, "cluster")
+
+	// Cluster access-ranges flags
+	clusterDefault := ""
+	if v := os.Getenv("K3A_CLUSTER"); v != "" {
+		clusterDefault = v
+	}
+	setAccessRangesCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	setAccessRangesCmd.Flags().StringArray("allowed-source", nil, "CIDR, IP or service tag allowed to reach the API server and SSH (can be specified multiple times; default: your public IP)")
+	accessRangesCmd.AddCommand(setAccessRangesCmd)
+
+	// Cluster protect flags
+	protectClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	protectClusterCmd.Flags().Bool("lock", false, "Also add a CanNotDelete Azure resource lock to the resource group")
+	unprotectClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+
+	// Cluster describe flags
+	describeClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+
+	// Cluster rotate-join flags
+	rotateJoinClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+
+	// Cluster backup and restore flags
+	backupClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	backupClusterCmd.Flags().Int("retain", 7, "Number of snapshots to keep (0 keeps all)")
+	backupClusterCmd.Flags().Bool("list", false, "List snapshots instead of taking one")
+	restoreClusterCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	restoreClusterCmd.Flags().String("snapshot", "", "Snapshot to restore, as shown by 'k3a cluster backup --list' (required)")
+	restoreClusterCmd.Flags().Bool("force", false, "Restore on one control-plane member even though others exist; stops etcd and the API server on the others")
+	_ = restoreClusterCmd.MarkFlagRequired("snapshot")
 
 	// Add all subcommands to clusterCmd at once
-	clusterCmd.AddCommand(createClusterCmd, listClustersCmd, deleteClusterCmd)
+	clusterCmd.AddCommand(createClusterCmd, listClustersCmd, deleteClusterCmd, protectClusterCmd, unprotectClusterCmd, describeClusterCmd, accessRangesCmd, rotateJoinClusterCmd, backupClusterCmd, restoreClusterCmd)
 
 	// Register clusterCmd with rootCmd
 	rootCmd.AddCommand(clusterCmd)
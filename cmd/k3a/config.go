@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jwilder/k3a/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// contextFlags maps flag names to the context setting and environment variable that provide their
+// default. Flags the user sets win, then the environment variable, then the current context.
+var contextFlags = map[string]struct{ key, env string }{
+	"subscription": {"subscription", "K3A_SUBSCRIPTION"},
+	"cluster":      {"cluster", "K3A_CLUSTER"},
+	"region":       {"region", ""},
+	"sku":          {"sku", ""},
+	"ssh-key":      {"ssh-key", ""},
+}
+
+// contextEnv maps context settings that aren't flags to the environment variables they provide
+var contextEnv = map[string]string{
+	"tenant":          "AZURE_TENANT_ID",
+	"ssh-private-key": "K3A_SSH_PRIVATE_KEY",
+}
+
+// noContextAnnotation marks a flag that must be given explicitly, such as the cluster to delete
+const noContextAnnotation = "k3a-no-context"
+
+func noContext(cmd *cobra.Command, name string) {
+	_ = cmd.Flags().SetAnnotation(name, noContextAnnotation, []string{"true"})
+}
+
+// applyContext fills in flags the user didn't set from their environment variable or the current context
+func applyContext(cmd *cobra.Command) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	current := cfg.Current()
+	if cfg.CurrentContext != "" && current == nil {
+		return fmt.Errorf("current context '%s' does not exist; use 'k3a config use-context' to pick another", cfg.CurrentContext)
+	}
+
+	for key, env := range contextEnv {
+		if os.Getenv(env) != "" {
+			continue
+		}
+		if value, _ := current.Get(key); value != "" {
+			_ = os.Setenv(env, value)
+		}
+	}
+
+	var setErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		source, ok := contextFlags[f.Name]
+		if !ok || f.Changed || f.Annotations[noContextAnnotation] != nil {
+			return
+		}
+		value := ""
+		if source.env != "" {
+			value = os.Getenv(source.env)
+		}
+		if value == "" {
+			value, _ = current.Get(source.key)
+		}
+		if value == "" {
+			return
+		}
+		if err := cmd.Flags().Set(f.Name, value); err != nil && setErr == nil {
+			setErr = fmt.Errorf("invalid --%s from context '%s': %w", f.Name, cfg.CurrentContext, err)
+		}
+	})
+	return setErr
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage named contexts in ~/.k3a/config.yaml",
+}
+
+var setConfigCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a context setting (empty value unsets it)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		name, _ := cmd.Flags().GetString("context")
+		if name == "" {
+			name = cfg.CurrentContext
+		}
+		if name == "" {
+			return fmt.Errorf("no current context; pass --context to name one")
+		}
+		if cfg.Contexts == nil {
+			cfg.Contexts = make(map[string]*config.Context)
+		}
+		ctx, ok := cfg.Contexts[name]
+		if !ok {
+			ctx = &config.Context{}
+			cfg.Contexts[name] = ctx
+		}
+		if err := ctx.Set(args[0], args[1]); err != nil {
+			return err
+		}
+		if cfg.CurrentContext == "" {
+			cfg.CurrentContext = name
+			fmt.Printf("Switched to context '%s'.\n", name)
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in context '%s'.\n", args[0], name)
+		return nil
+	},
+}
+
+var useContextConfigCmd = &cobra.Command{
+	Use:   "use-context <name>",
+	Short: "Switch the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Contexts[args[0]]; !ok {
+			return fmt.Errorf("context '%s' does not exist; create it with 'k3a config set --context %s <key> <value>'", args[0], args[0])
+		}
+		cfg.CurrentContext = args[0]
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to context '%s'.\n", args[0])
+		return nil
+	},
+}
+
+var viewConfigCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		if len(cfg.Contexts) == 0 {
+			path, _ := config.Path()
+			fmt.Printf("No contexts in %s.\n", path)
+			return nil
+		}
+		data, err := cfg.YAML()
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+func init() {
+	setConfigCmd.Flags().String("context", "", "Context to change (default: the current context; created if missing)")
+
+	configCmd.AddCommand(setConfigCmd, useContextConfigCmd, viewConfigCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// confirmDelete lists what a delete command will destroy and asks for confirmation unless --yes is set.
+// Without a terminal to ask on, it refuses so scripts have to opt in with --yes.
+func confirmDelete(cmd *cobra.Command, plan []string) error {
+	fmt.Println("The following will be permanently deleted:")
+	for _, item := range plan {
+		fmt.Printf("  - %s\n", item)
+	}
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("refusing to delete without confirmation; pass --yes to run non-interactively")
+	}
+	fmt.Print("Continue? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jwilder/k3a/image"
+	"github.com/jwilder/k3a/pkg/spinner"
+	"github.com/spf13/cobra"
+)
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Manage pre-baked node images",
+}
+
+var buildImageCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build a pre-baked node image into the cluster Shared Image Gallery",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		cluster, _ := cmd.Flags().GetString("cluster")
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		k8sVersion, _ := cmd.Flags().GetString("k8s-version")
+		sku, _ := cmd.Flags().GetString("sku")
+		sshKeyPath, _ := cmd.Flags().GetString("ssh-key")
+		galleryName, _ := cmd.Flags().GetString("gallery")
+		imageVersion, _ := cmd.Flags().GetString("image-version")
+
+		stopSpinner := spinner.Spinner("Building node image...")
+		defer stopSpinner()
+
+		return image.Build(image.BuildArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			K8sVersion:     k8sVersion,
+			SKU:            sku,
+			SSHKeyPath:     sshKeyPath,
+			GalleryName:    galleryName,
+			ImageVersion:   imageVersion,
+		})
+	},
+}
+
+func init() {
+	clusterDefault := ""
+	if v := os.Getenv("K3A_CLUSTER"); v != "" {
+		clusterDefault = v
+	}
+
+	buildImageCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	buildImageCmd.Flags().String("k8s-version", "v1.33.1", "Kubernetes version to bake into the image (e.g. v1.33.1)")
+	buildImageCmd.Flags().String("sku", "Standard_D2s_v3", "VM SKU for the temporary build VM")
+	buildImageCmd.Flags().String("ssh-key", os.ExpandEnv("$HOME/.ssh/id_rsa.pub"), "Path to the SSH public key file")
+	buildImageCmd.Flags().String("gallery", "", "Shared Image Gallery name (default: k3agallery<hash>)")
+	buildImageCmd.Flags().String("image-version", "", "Image version in X.Y.Z format (default: derived from the current time)")
+
+	imageCmd.AddCommand(buildImageCmd)
+	rootCmd.AddCommand(imageCmd)
+}
@@ -6,8 +6,7 @@ import (
 	"os"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
-	kstrings "github.com/jwilder/k3a/pkg/strings"
+	"github.com/jwilder/k3a/pkg/kube"
 	"github.com/spf13/cobra"
 )
 
@@ -22,34 +21,22 @@ var kubeconfigCmd = &cobra.Command{
 			return fmt.Errorf("--cluster flag is required")
 		}
 
-		// Compute secret name from cluster name
-		kubeconfigSecretName := fmt.Sprintf("%s-kubeconfig", kubeconfigCluster)
-
-		// Compute keyvault name from cluster name
-		clusterHash := kstrings.UniqueString(kubeconfigCluster)
-		kubeconfigKeyVault := fmt.Sprintf("k3akv%s", clusterHash)
 		ctx := context.Background()
 		cred, err := azidentity.NewDefaultAzureCredential(nil)
 		if err != nil {
 			return fmt.Errorf("failed to get Azure credential: %w", err)
 		}
-		vaultUrl := fmt.Sprintf("https://%s.vault.azure.net/", kubeconfigKeyVault)
-		client, err := azsecrets.NewClient(vaultUrl, cred, nil)
-		if err != nil {
-			return fmt.Errorf("failed to create Key Vault client: %w", err)
-		}
-		resp, err := client.GetSecret(ctx, kubeconfigSecretName, "", nil)
+		kubeconfigValue, err := kube.GetKubeconfig(ctx, kubeconfigCluster, cred)
 		if err != nil {
-			return fmt.Errorf("failed to get secret '%s' from Key Vault: %w", kubeconfigSecretName, err)
+			return err
 		}
-		kubeconfigValue := *resp.Value
 		// Write kubeconfig to ~/.kube/config
 		kubeDir := os.ExpandEnv("$HOME/.kube")
 		if err := os.MkdirAll(kubeDir, 0700); err != nil {
 			return fmt.Errorf("failed to create ~/.kube directory: %w", err)
 		}
 		kubeconfigPath := kubeDir + "/config"
-		if err := os.WriteFile(kubeconfigPath, []byte(kubeconfigValue), 0600); err != nil {
+		if err := os.WriteFile(kubeconfigPath, kubeconfigValue, 0600); err != nil {
 			return fmt.Errorf("failed to write kubeconfig to %s: %w", kubeconfigPath, err)
 		}
 		fmt.Printf("Kubeconfig written to %s\n", kubeconfigPath)
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/jwilder/k3a/loadbalancer"
+	"github.com/jwilder/k3a/loadbalancer/controller"
 	"github.com/jwilder/k3a/loadbalancer/rule"
 	"github.com/jwilder/k3a/pkg/spinner"
 	kstrings "github.com/jwilder/k3a/pkg/strings"
@@ -32,6 +34,55 @@ var listLoadBalancersCmd = &cobra.Command{
 	},
 }
 
+var showLoadBalancerCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a load balancer's frontends, backends, NAT, outbound and load balancing rules",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster, _ := cmd.Flags().GetString("cluster")
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+
+		lbName, _ := cmd.Flags().GetString("lb-name")
+		if lbName == "" {
+			lbName = fmt.Sprintf("k3alb%s", kstrings.UniqueString(cluster)) // Default LB name based on cluster
+		}
+		return loadbalancer.Show(loadbalancer.ShowLoadBalancerArgs{
+			SubscriptionID: subscriptionID,
+			ResourceGroup:  cluster,
+			LBName:         lbName,
+		})
+	},
+}
+
+var syncLoadBalancerCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Run a controller that exposes Services of type LoadBalancer through the cluster load balancer",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster, _ := cmd.Flags().GetString("cluster")
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		resync, _ := cmd.Flags().GetDuration("resync")
+		once, _ := cmd.Flags().GetBool("once")
+
+		return controller.Sync(controller.SyncArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			ResyncPeriod:   resync,
+			Once:           once,
+		})
+	},
+}
+
 var ruleCmd = &cobra.Command{
 	Use:   "rule",
 	Short: "Manage load balancer rules",
@@ -57,17 +108,37 @@ var ruleCreateCmd = &cobra.Command{
 		lbRuleName, _ := cmd.Flags().GetString("rule-name")
 		lbFrontendPort, _ := cmd.Flags().GetInt("frontend-port")
 		lbBackendPort, _ := cmd.Flags().GetInt("backend-port")
+		protocol, _ := cmd.Flags().GetString("protocol")
+		probeProtocol, _ := cmd.Flags().GetString("probe-protocol")
+		probePath, _ := cmd.Flags().GetString("probe-path")
+		probePort, _ := cmd.Flags().GetInt("probe-port")
+		backendPool, _ := cmd.Flags().GetString("backend-pool")
+		frontend, _ := cmd.Flags().GetString("frontend")
+		idleTimeout, _ := cmd.Flags().GetInt("idle-timeout")
+		floatingIP, _ := cmd.Flags().GetBool("floating-ip")
+		sessionPersistence, _ := cmd.Flags().GetString("session-persistence")
+		tcpReset, _ := cmd.Flags().GetBool("tcp-reset")
 
 		done := spinner.Spinner(fmt.Sprintf("Deploying rule '%s' to load balancer '%s'...", lbRuleName, lbName))
 		defer done()
 
 		if err := rule.Create(rule.CreateRuleArgs{
-			SubscriptionID: subscriptionID,
-			ResourceGroup:  cluster,
-			LBName:         lbName,
-			RuleName:       lbRuleName,
-			FrontendPort:   lbFrontendPort,
-			BackendPort:    lbBackendPort,
+			SubscriptionID:     subscriptionID,
+			ResourceGroup:      cluster,
+			LBName:             lbName,
+			RuleName:           lbRuleName,
+			FrontendPort:       lbFrontendPort,
+			BackendPort:        lbBackendPort,
+			Protocol:           protocol,
+			ProbeProtocol:      probeProtocol,
+			ProbePath:          probePath,
+			ProbePort:          probePort,
+			BackendPool:        backendPool,
+			Frontend:           frontend,
+			IdleTimeoutMinutes: idleTimeout,
+			FloatingIP:         floatingIP,
+			SessionPersistence: sessionPersistence,
+			TCPReset:           tcpReset,
 		}); err != nil {
 			return fmt.Errorf("failed to create load balancer rule '%s' in load balancer '%s': %w", lbRuleName, lbName, err)
 		}
@@ -145,12 +216,31 @@ func init() {
 	// List load balancers flags
 	listLoadBalancersCmd.Flags().String("cluster", clusterDefault, "Azure resource group name (or set K3A_CLUSTER) (required)")
 
+	// Show load balancer flags
+	showLoadBalancerCmd.Flags().String("cluster", clusterDefault, "Azure resource group name (or set K3A_CLUSTER) (required)")
+	showLoadBalancerCmd.Flags().String("lb-name", "", "Load balancer name (default the cluster's load balancer)")
+
+	// Sync flags
+	syncLoadBalancerCmd.Flags().String("cluster", clusterDefault, "Azure resource group name (or set K3A_CLUSTER) (required)")
+	syncLoadBalancerCmd.Flags().Duration("resync", 5*time.Minute, "How often to reconcile all services and clean up leftovers")
+	syncLoadBalancerCmd.Flags().Bool("once", false, "Sync all services once and exit")
+
 	// Rule create flags
 	ruleCreateCmd.Flags().String("cluster", clusterDefault, "Azure resource group name (or set K3A_CLUSTER) (required)")
 	ruleCreateCmd.Flags().String("lb-name", "", "Load balancer name (required)")
 	ruleCreateCmd.Flags().String("rule-name", "", "Load balancer rule name (required)")
 	ruleCreateCmd.Flags().Int("frontend-port", 0, "Frontend port (required)")
 	ruleCreateCmd.Flags().Int("backend-port", 0, "Backend port (required)")
+	ruleCreateCmd.Flags().String("protocol", "Tcp", "Rule protocol: Tcp, Udp or All (All is for internal load balancers and needs ports 0 and --probe-port)")
+	ruleCreateCmd.Flags().String("probe-protocol", "tcp", "Health probe protocol: tcp, http or https")
+	ruleCreateCmd.Flags().String("probe-path", "", "Health probe request path for http and https probes (default /)")
+	ruleCreateCmd.Flags().Int("probe-port", 0, "Health probe port (default the backend port)")
+	ruleCreateCmd.Flags().String("backend-pool", "", "k3a pool to send traffic to (required when the load balancer has several pools)")
+	ruleCreateCmd.Flags().String("frontend", "", "Frontend IP configuration name (default the cluster's inbound frontend)")
+	ruleCreateCmd.Flags().Int("idle-timeout", 0, "TCP idle timeout in minutes, 4-30 (default Azure's 4)")
+	ruleCreateCmd.Flags().Bool("floating-ip", false, "Enable floating IP (direct server return)")
+	ruleCreateCmd.Flags().String("session-persistence", "None", "Session persistence: None, SourceIP or SourceIPProtocol")
+	ruleCreateCmd.Flags().Bool("tcp-reset", false, "Send TCP resets when idle connections time out")
 	_ = ruleCreateCmd.MarkFlagRequired("rule-name")
 	_ = ruleCreateCmd.MarkFlagRequired("frontend-port")
 	_ = ruleCreateCmd.MarkFlagRequired("backend-port")
@@ -169,5 +259,7 @@ func init() {
 	ruleCmd.AddCommand(ruleCreateCmd, ruleListCmd, ruleDeleteCmd)
 	loadBalancerCmd.AddCommand(ruleCmd)
 	loadBalancerCmd.AddCommand(listLoadBalancersCmd)
+	loadBalancerCmd.AddCommand(showLoadBalancerCmd)
+	loadBalancerCmd.AddCommand(syncLoadBalancerCmd)
 	rootCmd.AddCommand(loadBalancerCmd)
 }
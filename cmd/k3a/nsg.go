@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/jwilder/k3a/nsg"
+	"github.com/jwilder/k3a/nsg/rules"
 	"github.com/spf13/cobra"
 )
 
@@ -36,7 +37,80 @@ var nsgListCmd = &cobra.Command{
 	},
 }
 
+var nsgApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Make an NSG's rules match a rules file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		cluster, _ := cmd.Flags().GetString("cluster")
+		nsgName, _ := cmd.Flags().GetString("nsg-name")
+		file, _ := cmd.Flags().GetString("file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription is required")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster is required")
+		}
+		if file == "" {
+			return fmt.Errorf("--file is required")
+		}
+
+		return rules.Apply(rules.ApplyArgs{
+			SubscriptionID: subscriptionID,
+			ResourceGroup:  cluster,
+			NSGName:        nsgName,
+			File:           file,
+			DryRun:         dryRun,
+		})
+	},
+}
+
+var nsgExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write an NSG's rules as a rules file for nsg apply",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		cluster, _ := cmd.Flags().GetString("cluster")
+		nsgName, _ := cmd.Flags().GetString("nsg-name")
+		output, _ := cmd.Flags().GetString("output")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription is required")
+		}
+		if cluster == "" {
+			return fmt.Errorf("--cluster is required")
+		}
+
+		out := os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer f.Close()
+			out = f
+		}
+		return rules.Export(rules.ExportArgs{
+			SubscriptionID: subscriptionID,
+			ResourceGroup:  cluster,
+			NSGName:        nsgName,
+			Output:         out,
+		})
+	},
+}
+
 func init() {
+	nsgApplyCmd.Flags().String("cluster", os.Getenv("K3A_CLUSTER"), "Cluster name (resource group) (or set K3A_CLUSTER)")
+	nsgApplyCmd.Flags().String("nsg-name", "k3a-nsg", "Azure NSG name")
+	nsgApplyCmd.Flags().StringP("file", "f", "", "Rules file (YAML) describing the desired rules (required)")
+	nsgApplyCmd.Flags().Bool("dry-run", false, "Print the planned changes without applying them")
+	nsgCmd.AddCommand(nsgApplyCmd)
+
+	nsgExportCmd.Flags().String("cluster", os.Getenv("K3A_CLUSTER"), "Cluster name (resource group) (or set K3A_CLUSTER)")
+	nsgExportCmd.Flags().String("nsg-name", "k3a-nsg", "Azure NSG name")
+	nsgExportCmd.Flags().StringP("output", "o", "", "File to write the rules to (default stdout)")
+	nsgCmd.AddCommand(nsgExportCmd)
+
 	nsgListCmd.Flags().String("cluster", os.Getenv("K3A_CLUSTER"), "Cluster (Azure Resource Group, or set AZURE_RESOURCE_GROUP)")
 	nsgCmd.AddCommand(nsgListCmd)
 	rootCmd.AddCommand(nsgCmd)
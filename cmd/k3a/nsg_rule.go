@@ -175,8 +175,37 @@ var nsgRuleDeleteCmd = &cobra.Command{
 	},
 }
 
+var nsgRuleLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check NSG rules for conflicts, shadowed rules and risky allows",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nsgName, _ := cmd.Flags().GetString("nsg-name")
+		file, _ := cmd.Flags().GetString("file")
+
+		if file == "" {
+			if subscriptionID == "" {
+				return errors.New("Flag --subscription-id is required (or set K3A_SUBSCRIPTION)")
+			}
+			if clusterDefault == "" {
+				return errors.New("Flag --cluster is required (or set K3A_CLUSTER)")
+			}
+		}
+		if nsgName == "" {
+			nsgName = "k3a-nsg"
+		}
+
+		return rules.LintRules(rules.LintArgs{
+			SubscriptionID: subscriptionID,
+			ResourceGroup:  clusterDefault,
+			NSGName:        nsgName,
+			File:           file,
+		})
+	},
+}
+
 func init() {
 	nsgCmd.AddCommand(nsgRuleCmd)
+	nsgRuleCmd.AddCommand(nsgRuleLintCmd)
 	nsgRuleCmd.AddCommand(nsgRuleCreateCmd)
 	nsgRuleCmd.AddCommand(nsgRuleListCmd)
 	nsgRuleCmd.AddCommand(nsgRuleDeleteCmd)
@@ -201,6 +230,10 @@ func init() {
 	nsgRuleCreateCmd.Flags().StringSlice("dest", []string{"*"}, "Destination address prefix (required)")
 	nsgRuleCreateCmd.Flags().StringSlice("dest-port", []string{"*"}, "Destination port range (required)")
 
+	nsgRuleLintCmd.Flags().StringVar(&clusterDefault, "cluster", clusterDefault, "Cluster name (resource group) (or set K3A_CLUSTER)")
+	nsgRuleLintCmd.Flags().String("nsg-name", "", "Azure NSG name")
+	nsgRuleLintCmd.Flags().StringP("file", "f", "", "Lint a rules file offline instead of the live NSG")
+
 	nsgRuleDeleteCmd.Flags().String("nsg-name", "", "Azure NSG name")
 	nsgRuleDeleteCmd.Flags().String("name", "", "Rule name to delete (required)")
 }
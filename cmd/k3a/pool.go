@@ -11,7 +11,7 @@ import (
 
 var poolCmd = &cobra.Command{
 	Use:   "pool",
-	Short: "Manage VMSS pools (list, create, delete, scale)",
+	Short: "Manage VMSS pools (list, create, update, delete, scale)",
 }
 
 var listPoolsCmd = &cobra.Command{
@@ -57,6 +57,26 @@ var createPoolCmd = &cobra.Command{
 
 		// Accept one or more MSI resource IDs
 		msiIDs, _ := cmd.Flags().GetStringArray("msi")
+		imageID, _ := cmd.Flags().GetString("image-id")
+		// Without an explicit --k8s-version, pools from a pre-baked image take the image's version
+		if imageID != "" && !cmd.Flags().Changed("k8s-version") {
+			k8sVersion = ""
+		}
+		labels, _ := cmd.Flags().GetStringArray("labels")
+		taints, _ := cmd.Flags().GetStringArray("taints")
+		osDiskSKU, _ := cmd.Flags().GetString("os-disk-sku")
+		ephemeralOS, _ := cmd.Flags().GetBool("ephemeral-os-disk")
+		mountDataDisk, _ := cmd.Flags().GetBool("mount-data-disk")
+		dataDiskSpecs, _ := cmd.Flags().GetStringArray("data-disk")
+		subnetPrefix, _ := cmd.Flags().GetString("subnet-prefix")
+		var dataDisks []pool.DataDisk
+		for _, spec := range dataDiskSpecs {
+			disk, err := pool.ParseDataDisk(spec)
+			if err != nil {
+				return err
+			}
+			dataDisks = append(dataDisks, disk)
+		}
 
 		// Add spinner for pool creation
 		stopSpinner := spinner.Spinner("Creating VMSS pool...")
@@ -74,10 +94,120 @@ var createPoolCmd = &cobra.Command{
 			SKU:            sku,
 			OSDiskSizeGB:   osDiskSize,
 			MSIIDs:         msiIDs,
+			ImageID:        imageID,
+			Labels:         labels,
+			Taints:         taints,
+			OSDiskSKU:      osDiskSKU,
+			EphemeralOS:    ephemeralOS,
+			DataDisks:      dataDisks,
+			MountDataDisk:  mountDataDisk,
+			SubnetPrefix:   subnetPrefix,
 		})
 	},
 }
 
+var updatePoolCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the VMSS model of an existing pool.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		cluster, _ := cmd.Flags().GetString("cluster")
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		name, _ := cmd.Flags().GetString("name")
+		if name == "" {
+			return fmt.Errorf("--name flag is required")
+		}
+		sku, _ := cmd.Flags().GetString("sku")
+		osDiskSize, _ := cmd.Flags().GetInt("os-disk-size")
+		msiIDs, _ := cmd.Flags().GetStringArray("msi")
+		k8sVersion, _ := cmd.Flags().GetString("k8s-version")
+		imageID, _ := cmd.Flags().GetString("image-id")
+
+		// Add spinner for pool update
+		stopSpinner := spinner.Spinner("Updating VMSS pool...")
+		defer stopSpinner()
+
+		return pool.Update(pool.UpdatePoolArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			Name:           name,
+			SKU:            sku,
+			OSDiskSizeGB:   osDiskSize,
+			MSIIDs:         msiIDs,
+			K8sVersion:     k8sVersion,
+			ImageID:        imageID,
+		})
+	},
+}
+
+var rolloutPoolCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Roll instances that are not on the latest model, draining and waiting for each node to be Ready.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rolloutArgs, err := getRolloutArgs(cmd)
+		if err != nil {
+			return err
+		}
+		return pool.Rollout(rolloutArgs)
+	},
+}
+
+var pauseRolloutPoolCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause a pool rollout after its current batch.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rolloutArgs, err := getRolloutArgs(cmd)
+		if err != nil {
+			return err
+		}
+		return pool.PauseRollout(rolloutArgs)
+	},
+}
+
+var resumeRolloutPoolCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused pool rollout.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rolloutArgs, err := getRolloutArgs(cmd)
+		if err != nil {
+			return err
+		}
+		return pool.ResumeRollout(rolloutArgs)
+	},
+}
+
+func getRolloutArgs(cmd *cobra.Command) (pool.RolloutArgs, error) {
+	subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+	if subscriptionID == "" {
+		return pool.RolloutArgs{}, fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+	}
+	cluster, _ := cmd.Flags().GetString("cluster")
+	if cluster == "" {
+		return pool.RolloutArgs{}, fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+	}
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		return pool.RolloutArgs{}, fmt.Errorf("--name flag is required")
+	}
+	maxUnavailable, _ := cmd.Flags().GetInt("max-unavailable")
+	maxFailures, _ := cmd.Flags().GetInt("max-failures")
+	reimage, _ := cmd.Flags().GetBool("reimage")
+
+	return pool.RolloutArgs{
+		SubscriptionID: subscriptionID,
+		Cluster:        cluster,
+		Name:           name,
+		MaxUnavailable: maxUnavailable,
+		MaxFailures:    maxFailures,
+		Reimage:        reimage,
+	}, nil
+}
+
 var deletePoolCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete a VMSS pool.",
@@ -92,12 +222,66 @@ var deletePoolCmd = &cobra.Command{
 		}
 
 		name, _ := cmd.Flags().GetString("name")
+		force, _ := cmd.Flags().GetBool("force")
+		deleteArgs := pool.DeletePoolArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			Name:           name,
+			Force:          force,
+		}
+		plan, err := pool.DeletePlan(deleteArgs)
+		if err != nil {
+			return err
+		}
+		if err := confirmDelete(cmd, plan); err != nil {
+			return err
+		}
 
 		// Add spinner for pool deletion
 		stopSpinner := spinner.Spinner("Deleting VMSS pool...")
 		defer stopSpinner()
 
-		return pool.Delete(pool.DeletePoolArgs{
+		return pool.Delete(deleteArgs)
+	},
+}
+
+var protectPoolCmd = &cobra.Command{
+	Use:   "protect",
+	Short: "Protect a VMSS pool from deletion.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		cluster, _ := cmd.Flags().GetString("cluster")
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		name, _ := cmd.Flags().GetString("name")
+		lock, _ := cmd.Flags().GetBool("lock")
+		return pool.Protect(pool.ProtectArgs{
+			SubscriptionID: subscriptionID,
+			Cluster:        cluster,
+			Name:           name,
+			Lock:           lock,
+		})
+	},
+}
+
+var unprotectPoolCmd = &cobra.Command{
+	Use:   "unprotect",
+	Short: "Remove deletion protection from a VMSS pool.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subscriptionID, _ := cmd.Root().Flags().GetString("subscription")
+		if subscriptionID == "" {
+			return fmt.Errorf("--subscription flag is required (or set K3A_SUBSCRIPTION)")
+		}
+		cluster, _ := cmd.Flags().GetString("cluster")
+		if cluster == "" {
+			return fmt.Errorf("--cluster flag is required (or set K3A_CLUSTER)")
+		}
+		name, _ := cmd.Flags().GetString("name")
+		return pool.Unprotect(pool.ProtectArgs{
 			SubscriptionID: subscriptionID,
 			Cluster:        cluster,
 			Name:           name,
@@ -190,19 +374,62 @@ func init() {
 	createPoolCmd.Flags().String("region", "canadacentral", "Azure region for the pool")
 	createPoolCmd.Flags().Int("instance-count", 1, "Number of VMSS instances")
 	createPoolCmd.Flags().String("ssh-key", os.ExpandEnv("$HOME/.ssh/id_rsa.pub"), "Path to the SSH public key file")
-	createPoolCmd.Flags().String("k8s-version", "v1.33.1", "Kubernetes version (e.g. v1.33.1)")
+	createPoolCmd.Flags().String("k8s-version", "v1.33.1", "Kubernetes version (e.g. v1.33.1); with --image-id it defaults to, and must match, the image's version")
 	createPoolCmd.Flags().String("sku", "Standard_D2s_v3", "VM SKU type (default: Standard_D2s_v3)")
 	createPoolCmd.Flags().Int("os-disk-size", 30, "OS disk size in GB (default: 30)")
 	createPoolCmd.Flags().StringArray("msi", nil, "Additional user-assigned MSI resource IDs to add to the VMSS (can be specified multiple times)")
+	createPoolCmd.Flags().String("image-id", "", "Pre-baked node image resource ID from 'k3a image build' (default: CBL-Mariner marketplace image)")
+
+	createPoolCmd.Flags().StringArray("labels", nil, "Node labels in key=value form (can be specified multiple times)")
+	createPoolCmd.Flags().StringArray("taints", nil, "Node taints in key=value:Effect form (can be specified multiple times)")
+	createPoolCmd.Flags().String("os-disk-sku", "Standard_LRS", "OS disk SKU (Standard_LRS, StandardSSD_LRS or Premium_LRS)")
+	createPoolCmd.Flags().Bool("ephemeral-os-disk", false, "Use an ephemeral OS disk on the VM cache disk")
+	createPoolCmd.Flags().StringArray("data-disk", nil, "Data disk as size=GB[,sku=Premium_LRS][,caching=ReadOnly] (can be specified multiple times)")
+	createPoolCmd.Flags().String("subnet-prefix", "", "Give the pool its own subnet: a prefix length (e.g. /22) to take the next free block of the VNet, or an explicit CIDR")
+	createPoolCmd.Flags().Bool("mount-data-disk", false, "Partition the first data disk and mount it at /var/lib/containerd and /var/lib/kubelet")
 
 	_ = createPoolCmd.MarkFlagRequired("name")
 	_ = createPoolCmd.MarkFlagRequired("role")
 
+	// Pool update flags
+	updatePoolCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+	updatePoolCmd.Flags().String("name", "", "Name of the node pool (required)")
+	updatePoolCmd.Flags().String("sku", "", "New VM SKU type (default: unchanged)")
+	noContext(updatePoolCmd, "sku")
+	updatePoolCmd.Flags().Int("os-disk-size", 0, "New OS disk size in GB, can only grow (default: unchanged)")
+	updatePoolCmd.Flags().StringArray("msi", nil, "Additional user-assigned MSI resource IDs to add to the VMSS (can be specified multiple times)")
+	updatePoolCmd.Flags().String("k8s-version", "", "Kubernetes version for new or reimaged instances (default: unchanged); pools on a pre-baked image also need --image-id")
+	updatePoolCmd.Flags().String("image-id", "", "Pre-baked node image from 'k3a image build' for new or reimaged instances; sets the Kubernetes version (default: unchanged)")
+	_ = updatePoolCmd.MarkFlagRequired("name")
+
+	// Pool rollout flags (shared by pause and resume)
+	for _, c := range []*cobra.Command{rolloutPoolCmd, pauseRolloutPoolCmd, resumeRolloutPoolCmd} {
+		c.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+		c.Flags().String("name", "", "Name of the node pool (required)")
+		_ = c.MarkFlagRequired("name")
+	}
+	for _, c := range []*cobra.Command{rolloutPoolCmd, resumeRolloutPoolCmd} {
+		c.Flags().Int("max-unavailable", 1, "Maximum number of instances replaced at the same time")
+		c.Flags().Int("max-failures", 2, "Abort the rollout after this many failed instances")
+		c.Flags().Bool("reimage", false, "Reimage instances instead of updating them in place (worker pools only)")
+	}
+	rolloutPoolCmd.AddCommand(pauseRolloutPoolCmd, resumeRolloutPoolCmd)
+
 	// Pool delete flags
 	deletePoolCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
 	deletePoolCmd.Flags().String("name", "", "Name of the node pool (required)")
+	deletePoolCmd.Flags().Bool("yes", false, "Delete without asking for confirmation")
+	deletePoolCmd.Flags().Bool("force", false, "Delete the control-plane pool even while worker pools exist")
 	_ = deletePoolCmd.MarkFlagRequired("name")
 
+	// Pool protect flags
+	for _, c := range []*cobra.Command{protectPoolCmd, unprotectPoolCmd} {
+		c.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
+		c.Flags().String("name", "", "Name of the node pool (required)")
+		_ = c.MarkFlagRequired("name")
+	}
+	protectPoolCmd.Flags().Bool("lock", false, "Also add a CanNotDelete Azure resource lock to the VMSS")
+
 	// Pool scale flags
 	scalePoolCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
 	scalePoolCmd.Flags().String("name", "", "Name of the node pool (required)")
@@ -219,7 +446,7 @@ func init() {
 	_ = kubeadmInstallCmd.MarkFlagRequired("role")
 
 	poolCmd.AddCommand(instancesPoolCmd)
-	poolCmd.AddCommand(listPoolsCmd, createPoolCmd, deletePoolCmd, scalePoolCmd, kubeadmInstallCmd)
+	poolCmd.AddCommand(listPoolsCmd, createPoolCmd, updatePoolCmd, rolloutPoolCmd, deletePoolCmd, protectPoolCmd, unprotectPoolCmd, scalePoolCmd, kubeadmInstallCmd)
 
 	rootCmd.AddCommand(poolCmd)
 }
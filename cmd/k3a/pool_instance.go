@@ -82,13 +82,23 @@ var deleteInstancePoolCmd = &cobra.Command{
 		if instanceID == "" {
 			return fmt.Errorf("--instance-id flag is required")
 		}
-		done := spinner.Spinner("Deleting VMSS instance...")
-		err := pool.DeleteInstance(pool.DeleteInstanceArgs{
+		force, _ := cmd.Flags().GetBool("force")
+		deleteArgs := pool.DeleteInstanceArgs{
 			SubscriptionID: subscriptionID,
 			Cluster:        cluster,
 			PoolName:       poolName,
 			InstanceID:     instanceID,
-		})
+			Force:          force,
+		}
+		plan, err := pool.DeleteInstancePlan(deleteArgs)
+		if err != nil {
+			return err
+		}
+		if err := confirmDelete(cmd, plan); err != nil {
+			return err
+		}
+		done := spinner.Spinner("Deleting VMSS instance...")
+		err = pool.DeleteInstance(deleteArgs)
 		done()
 		return err
 	},
@@ -167,6 +177,8 @@ func init() {
 	deleteInstancePoolCmd.Flags().String("cluster", clusterDefault, "Cluster name (or set K3A_CLUSTER) (required)")
 	deleteInstancePoolCmd.Flags().String("name", "", "Name of the node pool (required)")
 	deleteInstancePoolCmd.Flags().String("instance-id", "", "ID of the VMSS instance to delete (required)")
+	deleteInstancePoolCmd.Flags().Bool("yes", false, "Delete without asking for confirmation")
+	deleteInstancePoolCmd.Flags().Bool("force", false, "Skip the etcd member and quorum checks for control-plane instances left out of 'k3a cluster restore --force'")
 	_ = deleteInstancePoolCmd.MarkFlagRequired("name")
 	_ = deleteInstancePoolCmd.MarkFlagRequired("instance-id")
 
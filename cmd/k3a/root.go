@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jwilder/k3a/pkg/version"
 	"github.com/spf13/cobra"
 )
 
@@ -13,6 +14,13 @@ var rootCmd = &cobra.Command{
 	Use:               "k3a",
 	Short:             "Kubernetes deployment and management tool for Azure",
 	CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// config commands must work even when the config file points at a missing context
+		if cmd.Parent() == configCmd {
+			return nil
+		}
+		return applyContext(cmd)
+	},
 }
 
 func main() {
@@ -24,6 +32,10 @@ func main() {
 
 func init() {
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
+	rootCmd.Version = version.Get()
+	if rootCmd.Version == "" {
+		rootCmd.Version = "dev"
+	}
 	// Set subscriptionID from env if present
 	if v := os.Getenv("K3A_SUBSCRIPTION"); v != "" {
 		subscriptionID = v
@@ -0,0 +1,372 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/jwilder/k3a/pkg/kube"
+	"github.com/jwilder/k3a/pkg/storage"
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+	"github.com/jwilder/k3a/pool"
+)
+
+type BuildArgs struct {
+	SubscriptionID string
+	Cluster        string
+	K8sVersion     string // Kubernetes version baked into the image (e.g. v1.33.1)
+	SKU            string // VM SKU used for the temporary build VM
+	SSHKeyPath     string
+	GalleryName    string // Optional, defaults to k3agallery<hash>
+	ImageVersion   string // Optional, defaults to a timestamp based version
+}
+
+// Build boots a temporary VM in the cluster resource group, provisions it with the node cloud-init,
+// generalizes it and captures it into a Shared Image Gallery version that `pool create --image-id` can consume.
+func Build(args BuildArgs) error {
+	subscriptionID := args.SubscriptionID
+	cluster := args.Cluster
+	if args.K8sVersion == "" {
+		return fmt.Errorf("--k8s-version flag is required")
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+
+	clusterHash := kstrings.UniqueString(cluster)
+	galleryName := args.GalleryName
+	if galleryName == "" {
+		galleryName = fmt.Sprintf("k3agallery%s", clusterHash)
+	}
+	imageDefinitionName := fmt.Sprintf("k3a-node-%s", pool.K8sRepoVersion(args.K8sVersion))
+	imageVersion := args.ImageVersion
+	if imageVersion == "" {
+		now := time.Now().UTC()
+		imageVersion = fmt.Sprintf("%d.%d.%d", now.Year(), int(now.Month())*100+now.Day(), now.Hour()*10000+now.Minute()*100+now.Second())
+	}
+	vmName := fmt.Sprintf("k3a-image-%s", strings.ReplaceAll(imageVersion, ".", "-"))
+
+	// The build VM lives in the cluster's node subnet so it shares the cluster's outbound connectivity
+	rgClient, err := armresources.NewResourceGroupsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create resource groups client: %w", err)
+	}
+	rg, err := rgClient.Get(ctx, cluster, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get resource group '%s': %w", cluster, err)
+	}
+	location := *rg.Location
+	subnet, err := pool.GetNodeSubnet(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+
+	sshKeyPath := args.SSHKeyPath
+	if sshKeyPath == "" {
+		sshKeyPath = os.ExpandEnv("$HOME/.ssh/id_rsa.pub")
+	}
+	sshKey, err := os.ReadFile(sshKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH public key from %s: %w", sshKeyPath, err)
+	}
+
+	// Render the same cloud-init used by pool nodes; the "image" role skips the worker join service
+	customData, err := pool.CloudInitData(map[string]string{
+		"KeyVaultName":       kube.KeyVaultName(cluster),
+		"Role":               "image",
+		"StorageAccountName": storage.AccountName(cluster),
+		"ResourceGroup":      cluster,
+		"ExternalIP":         "",
+		"K8sVersion":         args.K8sVersion,
+		"K8sRepoVersion":     pool.K8sRepoVersion(args.K8sVersion),
+		"MSIClientID":        "",
+		"PrebakedImage":      "false",
+		"NodeLabels":         "",
+		"NodeTaints":         "",
+		"MountDataDisk":      "false",
+	})
+	if err != nil {
+		return err
+	}
+
+	vmClient, err := armcompute.NewVirtualMachinesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VM client: %w", err)
+	}
+	nicClient, err := armnetwork.NewInterfacesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create network interface client: %w", err)
+	}
+	diskClient, err := armcompute.NewDisksClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create disk client: %w", err)
+	}
+	imagesClient, err := armcompute.NewImagesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create images client: %w", err)
+	}
+
+	nicName := vmName + "-nic"
+	osDiskName := vmName + "-osdisk"
+	managedImageName := vmName + "-image"
+
+	// Always remove the temporary build resources, even when the build fails part way
+	defer cleanupBuildResources(ctx, cluster, vmName, nicName, osDiskName, managedImageName, vmClient, nicClient, diskClient, imagesClient)
+
+	fmt.Printf("Creating temporary build VM '%s'...\n", vmName)
+	nicPoller, err := nicClient.BeginCreateOrUpdate(ctx, cluster, nicName, armnetwork.Interface{
+		Location: to.Ptr(location),
+		Properties: &armnetwork.InterfacePropertiesFormat{
+			IPConfigurations: []*armnetwork.InterfaceIPConfiguration{
+				{
+					Name: to.Ptr("ipconfig"),
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+						Subnet:                    &armnetwork.Subnet{ID: subnet.ID},
+						PrivateIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodDynamic),
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start NIC creation: %w", err)
+	}
+	nic, err := nicPoller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create NIC: %w", err)
+	}
+
+	sku := args.SKU
+	if sku == "" {
+		sku = "Standard_D2s_v3"
+	}
+	vmPoller, err := vmClient.BeginCreateOrUpdate(ctx, cluster, vmName, armcompute.VirtualMachine{
+		Location: to.Ptr(location),
+		Tags: map[string]*string{
+			"k3a": to.Ptr("image-build"),
+		},
+		Properties: &armcompute.VirtualMachineProperties{
+			HardwareProfile: &armcompute.HardwareProfile{
+				VMSize: to.Ptr(armcompute.VirtualMachineSizeTypes(sku)),
+			},
+			StorageProfile: &armcompute.StorageProfile{
+				ImageReference: &armcompute.ImageReference{
+					Publisher: to.Ptr("MicrosoftCblMariner"),
+					Offer:     to.Ptr("Cbl-Mariner"),
+					SKU:       to.Ptr("cbl-mariner-2-gen2"),
+					Version:   to.Ptr("latest"),
+				},
+				OSDisk: &armcompute.OSDisk{
+					Name:         to.Ptr(osDiskName),
+					CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesFromImage),
+					ManagedDisk: &armcompute.ManagedDiskParameters{
+						StorageAccountType: to.Ptr(armcompute.StorageAccountTypesStandardLRS),
+					},
+				},
+			},
+			OSProfile: &armcompute.OSProfile{
+				ComputerName:  to.Ptr(vmName),
+				AdminUsername: to.Ptr("azureuser"),
+				CustomData:    to.Ptr(customData),
+				LinuxConfiguration: &armcompute.LinuxConfiguration{
+					DisablePasswordAuthentication: to.Ptr(true),
+					SSH: &armcompute.SSHConfiguration{
+						PublicKeys: []*armcompute.SSHPublicKey{
+							{
+								Path:    to.Ptr("/home/azureuser/.ssh/authorized_keys"),
+								KeyData: to.Ptr(string(sshKey)),
+							},
+						},
+					},
+				},
+			},
+			NetworkProfile: &armcompute.NetworkProfile{
+				NetworkInterfaces: []*armcompute.NetworkInterfaceReference{
+					{
+						ID: nic.ID,
+						Properties: &armcompute.NetworkInterfaceReferenceProperties{
+							Primary: to.Ptr(true),
+						},
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start build VM creation: %w", err)
+	}
+	vm, err := vmPoller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create build VM: %w", err)
+	}
+
+	// The image cloud-init deprovisions the VM and powers it off as its last step
+	fmt.Println("Waiting for cloud-init to provision and deprovision the build VM...")
+	if err := waitForVMStopped(ctx, vmClient, cluster, vmName, 60*time.Minute); err != nil {
+		return err
+	}
+	fmt.Println("Generalizing build VM...")
+	deallocatePoller, err := vmClient.BeginDeallocate(ctx, cluster, vmName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start build VM deallocation: %w", err)
+	}
+	if _, err := deallocatePoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to deallocate build VM: %w", err)
+	}
+	if _, err := vmClient.Generalize(ctx, cluster, vmName, nil); err != nil {
+		return fmt.Errorf("failed to generalize build VM: %w", err)
+	}
+
+	// Capture the generalized VM as a managed image, which is then published into the gallery
+	fmt.Println("Capturing image...")
+	imagePoller, err := imagesClient.BeginCreateOrUpdate(ctx, cluster, managedImageName, armcompute.Image{
+		Location: to.Ptr(location),
+		Properties: &armcompute.ImageProperties{
+			SourceVirtualMachine: &armcompute.SubResource{ID: vm.ID},
+			HyperVGeneration:     to.Ptr(armcompute.HyperVGenerationTypesV2),
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start managed image creation: %w", err)
+	}
+	managedImage, err := imagePoller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create managed image: %w", err)
+	}
+
+	imageVersionID, err := publishGalleryImageVersion(ctx, subscriptionID, cluster, location, galleryName, imageDefinitionName, imageVersion, *managedImage.ID, args.K8sVersion, cred)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Image version created: %s\n", imageVersionID)
+	fmt.Printf("Use it with: k3a pool create --image-id %s ...\n", imageVersionID)
+	return nil
+}
+
+// publishGalleryImageVersion ensures the gallery and image definition exist and creates a new version from a managed image
+func publishGalleryImageVersion(ctx context.Context, subscriptionID, resourceGroup, location, galleryName, imageDefinitionName, imageVersion, sourceImageID, k8sVersion string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	galleriesClient, err := armcompute.NewGalleriesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gallery client: %w", err)
+	}
+	galleryPoller, err := galleriesClient.BeginCreateOrUpdate(ctx, resourceGroup, galleryName, armcompute.Gallery{
+		Location: to.Ptr(location),
+		Properties: &armcompute.GalleryProperties{
+			Description: to.Ptr("k3a pre-baked node images"),
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start gallery creation: %w", err)
+	}
+	if _, err := galleryPoller.PollUntilDone(ctx, nil); err != nil {
+		return "", fmt.Errorf("failed to create gallery: %w", err)
+	}
+
+	galleryImagesClient, err := armcompute.NewGalleryImagesClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gallery images client: %w", err)
+	}
+	definitionPoller, err := galleryImagesClient.BeginCreateOrUpdate(ctx, resourceGroup, galleryName, imageDefinitionName, armcompute.GalleryImage{
+		Location: to.Ptr(location),
+		Properties: &armcompute.GalleryImageProperties{
+			Identifier: &armcompute.GalleryImageIdentifier{
+				Publisher: to.Ptr("k3a"),
+				Offer:     to.Ptr("k3a-node"),
+				SKU:       to.Ptr(imageDefinitionName),
+			},
+			OSType:           to.Ptr(armcompute.OperatingSystemTypesLinux),
+			OSState:          to.Ptr(armcompute.OperatingSystemStateTypesGeneralized),
+			HyperVGeneration: to.Ptr(armcompute.HyperVGenerationV2),
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start image definition creation: %w", err)
+	}
+	if _, err := definitionPoller.PollUntilDone(ctx, nil); err != nil {
+		return "", fmt.Errorf("failed to create image definition: %w", err)
+	}
+
+	fmt.Printf("Publishing image version %s to gallery '%s' (this can take a while)...\n", imageVersion, galleryName)
+	galleryImageVersionsClient, err := armcompute.NewGalleryImageVersionsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gallery image versions client: %w", err)
+	}
+	versionPoller, err := galleryImageVersionsClient.BeginCreateOrUpdate(ctx, resourceGroup, galleryName, imageDefinitionName, imageVersion, armcompute.GalleryImageVersion{
+		Location: to.Ptr(location),
+		Tags: map[string]*string{
+			pool.K8sVersionTag: to.Ptr(k8sVersion),
+		},
+		Properties: &armcompute.GalleryImageVersionProperties{
+			StorageProfile: &armcompute.GalleryImageVersionStorageProfile{
+				Source: &armcompute.GalleryArtifactVersionSource{ID: to.Ptr(sourceImageID)},
+			},
+			PublishingProfile: &armcompute.GalleryImageVersionPublishingProfile{
+				TargetRegions: []*armcompute.TargetRegion{
+					{Name: to.Ptr(location), RegionalReplicaCount: to.Ptr[int32](1)},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start image version creation: %w", err)
+	}
+	version, err := versionPoller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create image version: %w", err)
+	}
+	return *version.ID, nil
+}
+
+// waitForVMStopped polls the VM's power state until it is stopped or the timeout expires
+func waitForVMStopped(ctx context.Context, vmClient *armcompute.VirtualMachinesClient, resourceGroup, vmName string, timeout time.Duration) error {
+	start := time.Now()
+	for time.Since(start) < timeout {
+		view, err := vmClient.InstanceView(ctx, resourceGroup, vmName, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get build VM instance view: %w", err)
+		}
+		for _, status := range view.Statuses {
+			if status != nil && status.Code != nil && *status.Code == "PowerState/stopped" {
+				return nil
+			}
+		}
+		time.Sleep(30 * time.Second)
+	}
+	return fmt.Errorf("build VM '%s' did not stop within %v; its cloud-init provisioning failed or is still running", vmName, timeout)
+}
+
+// cleanupBuildResources removes the temporary VM, NIC, OS disk and managed image created during a build
+func cleanupBuildResources(ctx context.Context, resourceGroup, vmName, nicName, osDiskName, managedImageName string, vmClient *armcompute.VirtualMachinesClient, nicClient *armnetwork.InterfacesClient, diskClient *armcompute.DisksClient, imagesClient *armcompute.ImagesClient) {
+	fmt.Println("Cleaning up temporary build resources...")
+	if poller, err := vmClient.BeginDelete(ctx, resourceGroup, vmName, nil); err == nil {
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			fmt.Printf("Warning: failed to delete build VM '%s': %v\n", vmName, err)
+		}
+	}
+	if poller, err := nicClient.BeginDelete(ctx, resourceGroup, nicName, nil); err == nil {
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			fmt.Printf("Warning: failed to delete build NIC '%s': %v\n", nicName, err)
+		}
+	}
+	if poller, err := diskClient.BeginDelete(ctx, resourceGroup, osDiskName, nil); err == nil {
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			fmt.Printf("Warning: failed to delete build OS disk '%s': %v\n", osDiskName, err)
+		}
+	}
+	if poller, err := imagesClient.BeginDelete(ctx, resourceGroup, managedImageName, nil); err == nil {
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			fmt.Printf("Warning: failed to delete managed image '%s': %v\n", managedImageName, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/jwilder/k3a/pkg/kube"
+	"github.com/jwilder/k3a/pool"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// gcKey is queued to remove Azure resources left behind by deleted Services or ports
+const gcKey = "\x00gc"
+
+type SyncArgs struct {
+	SubscriptionID string
+	Cluster        string
+	ResyncPeriod   time.Duration // How often every Service is reconciled and leftovers are collected
+	Once           bool          // Reconcile all Services once and exit instead of watching
+}
+
+// controller reconciles Services of type LoadBalancer with the cluster's Azure load balancer
+type controller struct {
+	subscriptionID string
+	cluster        string
+	cred           *azidentity.DefaultAzureCredential
+	client         kubernetes.Interface
+	network        pool.ServiceNetwork
+	lister         listersv1.ServiceLister
+	queue          workqueue.TypedRateLimitingInterface[string]
+}
+
+// Sync watches Services of type LoadBalancer and gives each port a frontend, rule and probe on the cluster's
+// load balancer, writing the frontend IP back to the Service status. It runs until interrupted.
+func Sync(args SyncArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, _, err := kube.NewClient(ctx, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	network, err := pool.GetServiceNetwork(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	if args.ResyncPeriod <= 0 {
+		args.ResyncPeriod = 5 * time.Minute
+	}
+
+	factory := informers.NewSharedInformerFactory(client, args.ResyncPeriod)
+	informer := factory.Core().V1().Services()
+	c := &controller{
+		subscriptionID: args.SubscriptionID,
+		cluster:        args.Cluster,
+		cred:           cred,
+		client:         client,
+		network:        network,
+		lister:         informer.Lister(),
+		queue:          workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+	}
+	defer c.queue.ShutDown()
+
+	if _, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(gcKey) },
+	}); err != nil {
+		return fmt.Errorf("failed to watch services: %w", err)
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync service cache")
+	}
+
+	if args.Once {
+		services, err := c.lister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+		for _, svc := range services {
+			if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+				if err := c.ensure(ctx, svc); err != nil {
+					return fmt.Errorf("failed to sync service %s/%s: %w", svc.Namespace, svc.Name, err)
+				}
+			}
+		}
+		return c.collect(ctx)
+	}
+
+	log.Printf("Syncing LoadBalancer services of cluster '%s' to load balancer '%s'", args.Cluster, network.LBName)
+	c.queue.Add(gcKey)
+	go func() {
+		ticker := time.NewTicker(args.ResyncPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.queue.Add(gcKey)
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		c.queue.ShutDown()
+	}()
+
+	// A single worker keeps load balancer updates, which replace the whole resource, from racing
+	for c.processNext(ctx) {
+	}
+	log.Printf("Stopped syncing LoadBalancer services")
+	return nil
+}
+
+func (c *controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Printf("Failed to get key for service: %v", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *controller) processNext(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	var err error
+	if key == gcKey {
+		err = c.collect(ctx)
+	} else {
+		err = c.reconcile(ctx, key)
+	}
+	if err != nil {
+		if key == gcKey {
+			log.Printf("Failed to clean up load balancer resources: %v", err)
+		} else {
+			log.Printf("Failed to sync service %s: %v", key, err)
+		}
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile syncs one Service. Services that are gone or no longer of type LoadBalancer are cleaned up
+// by the collector.
+func (c *controller) reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+	svc, err := c.lister.Services(namespace).Get(name)
+	if err != nil || svc.Spec.Type != corev1.ServiceTypeLoadBalancer || svc.DeletionTimestamp != nil {
+		c.queue.Add(gcKey)
+		return nil
+	}
+	if err := c.ensure(ctx, svc); err != nil {
+		return err
+	}
+	// Ports removed from the Service leave rules behind
+	c.queue.Add(gcKey)
+	return nil
+}
@@ -0,0 +1,628 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/loadbalancer/rule"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// resourcePrefix marks load balancer frontends, rules, public IPs and NSG rules owned by the controller
+	resourcePrefix = clusternet.ServiceResourcePrefix
+	// serviceTag records which Service a public IP was created for
+	serviceTag = "k3a-service"
+	// poolAnnotation picks the k3a pool that receives a Service's traffic
+	poolAnnotation = "k3a.io/pool"
+	nsgName        = "k3a-nsg"
+	// Service NSG rules get priorities from this range, clear of user rules and the k3a access rules
+	nsgPriorityStart = 3000
+	nsgPriorityEnd   = 3999
+	// kubeProxyHealthPort serves kube-proxy's /healthz, used to probe UDP ports that can't be probed directly
+	kubeProxyHealthPort = 10256
+)
+
+// serviceResourceName returns the name shared by a Service's frontend and NSG rule, and the prefix of its LB rules.
+// The hash suffix keeps apart Services whose joined names match, like a-b/c and a/b-c.
+func serviceResourceName(namespace, name string) string {
+	base := resourcePrefix + namespace + "-" + name
+	if len(base) > 45 {
+		base = base[:45]
+	}
+	return base + "-" + kstrings.UniqueString(namespace, "/", name)
+}
+
+func ruleName(base string, port corev1.ServicePort) string {
+	return fmt.Sprintf("%s-%s-%d", base, strings.ToLower(string(port.Protocol)), port.Port)
+}
+
+// supportedPorts returns the ports the load balancer can carry, skipping SCTP and ports without a node port
+func supportedPorts(svc *corev1.Service) []corev1.ServicePort {
+	var ports []corev1.ServicePort
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort == 0 || (port.Protocol != corev1.ProtocolTCP && port.Protocol != corev1.ProtocolUDP) {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// ensure creates or updates the frontend, rules, probes and NSG rule for a Service and publishes its IP
+func (c *controller) ensure(ctx context.Context, svc *corev1.Service) error {
+	base := serviceResourceName(svc.Namespace, svc.Name)
+	poolName, err := c.servicePool(ctx, svc)
+	if err != nil {
+		return err
+	}
+	ip, err := c.ensureFrontend(ctx, svc, base)
+	if err != nil {
+		return err
+	}
+	if err := c.ensureRules(ctx, svc, base, poolName); err != nil {
+		return err
+	}
+	if !c.network.Private {
+		if err := c.ensureNSGRule(ctx, svc, base); err != nil {
+			return err
+		}
+	}
+
+	current := svc.Status.LoadBalancer.Ingress
+	if len(current) == 1 && current[0].IP == ip {
+		return nil
+	}
+	updated := svc.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: ip}}
+	if _, err := c.client.CoreV1().Services(svc.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update service status: %w", err)
+	}
+	log.Printf("Service %s/%s is reachable at %s", svc.Namespace, svc.Name, ip)
+	return nil
+}
+
+// servicePool returns the k3a pool whose backend pool receives the Service's traffic: the pool named by the
+// k3a.io/pool annotation, or the cluster's only worker pool
+func (c *controller) servicePool(ctx context.Context, svc *corev1.Service) (string, error) {
+	if name := svc.Annotations[poolAnnotation]; name != "" {
+		return name, nil
+	}
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	var workers []string
+	pager := vmssClient.NewListPager(c.cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list VMSS: %w", err)
+		}
+		for _, vmss := range page.Value {
+			if vmss.Name == nil || !strings.HasSuffix(*vmss.Name, "-vmss") {
+				continue
+			}
+			if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+				continue
+			}
+			workers = append(workers, strings.TrimSuffix(*vmss.Name, "-vmss"))
+		}
+	}
+	switch len(workers) {
+	case 0:
+		return "", fmt.Errorf("cluster has no worker pool to send traffic to")
+	case 1:
+		return workers[0], nil
+	}
+	sort.Strings(workers)
+	return "", fmt.Errorf("cluster has several worker pools (%s), pick one with the %s annotation", strings.Join(workers, ", "), poolAnnotation)
+}
+
+// ensureFrontend returns the IP of the Service's frontend, creating the frontend first if needed
+func (c *controller) ensureFrontend(ctx context.Context, svc *corev1.Service, base string) (string, error) {
+	lbClient, err := armnetwork.NewLoadBalancersClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return "", err
+	}
+	lb, err := lbClient.Get(ctx, c.cluster, c.network.LBName, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get load balancer '%s': %w", c.network.LBName, err)
+	}
+	if lb.Properties == nil {
+		lb.Properties = &armnetwork.LoadBalancerPropertiesFormat{}
+	}
+	for _, fe := range lb.Properties.FrontendIPConfigurations {
+		if fe != nil && fe.Name != nil && *fe.Name == base {
+			return c.frontendIP(ctx, fe)
+		}
+	}
+
+	frontend := &armnetwork.FrontendIPConfiguration{
+		Name:       to.Ptr(base),
+		Properties: &armnetwork.FrontendIPConfigurationPropertiesFormat{},
+	}
+	if c.network.Private {
+		frontend.Properties.Subnet = &armnetwork.Subnet{ID: to.Ptr(c.network.SubnetID)}
+		frontend.Properties.PrivateIPAllocationMethod = to.Ptr(armnetwork.IPAllocationMethodDynamic)
+		if svc.Spec.LoadBalancerIP != "" {
+			frontend.Properties.PrivateIPAllocationMethod = to.Ptr(armnetwork.IPAllocationMethodStatic)
+			frontend.Properties.PrivateIPAddress = to.Ptr(svc.Spec.LoadBalancerIP)
+		}
+	} else {
+		publicIPID, err := c.ensurePublicIP(ctx, svc, base, lb.Location)
+		if err != nil {
+			return "", err
+		}
+		frontend.Properties.PublicIPAddress = &armnetwork.PublicIPAddress{ID: publicIPID}
+	}
+	lb.Properties.FrontendIPConfigurations = append(lb.Properties.FrontendIPConfigurations, frontend)
+
+	poller, err := lbClient.BeginCreateOrUpdate(ctx, c.cluster, c.network.LBName, armnetwork.LoadBalancer{
+		Location:   lb.Location,
+		SKU:        lb.SKU,
+		Tags:       lb.Tags,
+		Properties: lb.Properties,
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to add frontend '%s': %w", base, err)
+	}
+	resp, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to add frontend '%s': %w", base, err)
+	}
+	log.Printf("Created frontend '%s' for service %s/%s", base, svc.Namespace, svc.Name)
+	for _, fe := range resp.Properties.FrontendIPConfigurations {
+		if fe != nil && fe.Name != nil && *fe.Name == base {
+			return c.frontendIP(ctx, fe)
+		}
+	}
+	return "", fmt.Errorf("frontend '%s' missing after update", base)
+}
+
+// ensurePublicIP returns the public IP for a Service's frontend. A spec.loadBalancerIP reuses an existing
+// public IP in the cluster resource group, otherwise the controller creates one.
+func (c *controller) ensurePublicIP(ctx context.Context, svc *corev1.Service, base string, location *string) (*string, error) {
+	client, err := armnetwork.NewPublicIPAddressesClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create public IP client: %w", err)
+	}
+	if svc.Spec.LoadBalancerIP != "" {
+		pager := client.NewListPager(c.cluster, nil)
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list public IPs: %w", err)
+			}
+			for _, pip := range page.Value {
+				if pip.Properties != nil && pip.Properties.IPAddress != nil && *pip.Properties.IPAddress == svc.Spec.LoadBalancerIP {
+					return pip.ID, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("no public IP with address %s in resource group '%s'", svc.Spec.LoadBalancerIP, c.cluster)
+	}
+
+	ipName := base + "-ip"
+	if existing, err := client.Get(ctx, c.cluster, ipName, nil); err == nil {
+		return existing.ID, nil
+	}
+	// Keep the address of a public IP created for this Service under an earlier name
+	owner := svc.Namespace + "/" + svc.Name
+	pager := client.NewListPager(c.cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list public IPs: %w", err)
+		}
+		for _, pip := range page.Value {
+			if tag, ok := pip.Tags[serviceTag]; ok && tag != nil && *tag == owner {
+				return pip.ID, nil
+			}
+		}
+	}
+	poller, err := client.BeginCreateOrUpdate(ctx, c.cluster, ipName, armnetwork.PublicIPAddress{
+		Location: location,
+		SKU: &armnetwork.PublicIPAddressSKU{
+			Name: to.Ptr(armnetwork.PublicIPAddressSKUNameStandard),
+		},
+		Properties: &armnetwork.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: to.Ptr(armnetwork.IPAllocationMethodStatic),
+		},
+		Tags: map[string]*string{
+			serviceTag: to.Ptr(owner),
+		},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create public IP '%s': %w", ipName, err)
+	}
+	resp, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create public IP '%s': %w", ipName, err)
+	}
+	return resp.ID, nil
+}
+
+// frontendIP returns the address of a frontend IP configuration
+func (c *controller) frontendIP(ctx context.Context, fe *armnetwork.FrontendIPConfiguration) (string, error) {
+	if fe.Properties == nil {
+		return "", fmt.Errorf("frontend '%s' has no properties", *fe.Name)
+	}
+	if fe.Properties.PrivateIPAddress != nil && *fe.Properties.PrivateIPAddress != "" {
+		return *fe.Properties.PrivateIPAddress, nil
+	}
+	if fe.Properties.PublicIPAddress == nil || fe.Properties.PublicIPAddress.ID == nil {
+		return "", fmt.Errorf("frontend '%s' has no IP address", *fe.Name)
+	}
+	client, err := armnetwork.NewPublicIPAddressesClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return "", err
+	}
+	id := *fe.Properties.PublicIPAddress.ID
+	pip, err := client.Get(ctx, c.cluster, id[strings.LastIndex(id, "/")+1:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get public IP of frontend '%s': %w", *fe.Name, err)
+	}
+	if pip.Properties == nil || pip.Properties.IPAddress == nil {
+		return "", fmt.Errorf("public IP of frontend '%s' has no address yet", *fe.Name)
+	}
+	return *pip.Properties.IPAddress, nil
+}
+
+// ensureRules creates a rule and probe per Service port, skipping rules that are already up to date
+func (c *controller) ensureRules(ctx context.Context, svc *corev1.Service, base, poolName string) error {
+	lbClient, err := armnetwork.NewLoadBalancersClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return err
+	}
+	lb, err := lbClient.Get(ctx, c.cluster, c.network.LBName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer '%s': %w", c.network.LBName, err)
+	}
+	existing := make(map[string]*armnetwork.LoadBalancingRule)
+	if lb.Properties != nil {
+		for _, r := range lb.Properties.LoadBalancingRules {
+			if r != nil && r.Name != nil {
+				existing[*r.Name] = r
+			}
+		}
+	}
+
+	for _, port := range supportedPorts(svc) {
+		args := rule.CreateRuleArgs{
+			SubscriptionID: c.subscriptionID,
+			ResourceGroup:  c.cluster,
+			LBName:         c.network.LBName,
+			RuleName:       ruleName(base, port),
+			FrontendPort:   int(port.Port),
+			BackendPort:    int(port.NodePort),
+			Protocol:       string(port.Protocol),
+			ProbeProtocol:  "tcp",
+			ProbePort:      int(port.NodePort),
+			BackendPool:    poolName,
+			Frontend:       base,
+			TCPReset:       port.Protocol == corev1.ProtocolTCP,
+		}
+		switch {
+		case svc.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal && svc.Spec.HealthCheckNodePort != 0:
+			// Only nodes running an endpoint pass kube-proxy's per-Service health check
+			args.ProbeProtocol, args.ProbePath, args.ProbePort = "http", "/healthz", int(svc.Spec.HealthCheckNodePort)
+		case port.Protocol == corev1.ProtocolUDP:
+			args.ProbeProtocol, args.ProbePath, args.ProbePort = "http", "/healthz", kubeProxyHealthPort
+		}
+		if svc.Spec.SessionAffinity == corev1.ServiceAffinityClientIP {
+			args.SessionPersistence = "SourceIP"
+		}
+		if ruleUpToDate(existing[args.RuleName], args) {
+			continue
+		}
+		if err := rule.Create(args); err != nil {
+			return fmt.Errorf("failed to create rule '%s': %w", args.RuleName, err)
+		}
+		log.Printf("Synced rule '%s' for service %s/%s (%s %d -> node port %d)", args.RuleName, svc.Namespace, svc.Name, port.Protocol, port.Port, port.NodePort)
+	}
+	return nil
+}
+
+// ruleUpToDate reports whether an existing rule already matches the rule args
+func ruleUpToDate(r *armnetwork.LoadBalancingRule, args rule.CreateRuleArgs) bool {
+	if r == nil || r.Properties == nil {
+		return false
+	}
+	p := r.Properties
+	return p.FrontendPort != nil && int(*p.FrontendPort) == args.FrontendPort &&
+		p.BackendPort != nil && int(*p.BackendPort) == args.BackendPort &&
+		p.Protocol != nil && strings.EqualFold(string(*p.Protocol), args.Protocol) &&
+		idName(p.FrontendIPConfiguration) == args.Frontend &&
+		idName(p.BackendAddressPool) == rule.BackendPoolName(args.BackendPool) &&
+		idName(p.Probe) == rule.ProbeName(args.ProbeProtocol, args.ProbePort) &&
+		(args.SessionPersistence == "") == (p.LoadDistribution == nil || *p.LoadDistribution == armnetwork.LoadDistributionDefault)
+}
+
+// ensureNSGRule allows the Service's source ranges, or the internet, to reach its node ports. NSG rules see
+// traffic after the load balancer has translated it to the node port.
+func (c *controller) ensureNSGRule(ctx context.Context, svc *corev1.Service, base string) error {
+	ports := supportedPorts(svc)
+	if len(ports) == 0 {
+		return nil
+	}
+	var nodePorts []string
+	protocols := make(map[corev1.Protocol]bool)
+	for _, port := range ports {
+		nodePorts = append(nodePorts, strconv.Itoa(int(port.NodePort)))
+		protocols[port.Protocol] = true
+	}
+	protocol := armnetwork.SecurityRuleProtocolAsterisk
+	if len(protocols) == 1 {
+		if protocols[corev1.ProtocolTCP] {
+			protocol = armnetwork.SecurityRuleProtocolTCP
+		} else {
+			protocol = armnetwork.SecurityRuleProtocolUDP
+		}
+	}
+	sources := svc.Spec.LoadBalancerSourceRanges
+	if len(sources) == 0 {
+		sources = []string{"Internet"}
+	}
+
+	rulesClient, err := armnetwork.NewSecurityRulesClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create security rules client: %w", err)
+	}
+	used := make(map[int32]bool)
+	var priority int32
+	pager := rulesClient.NewListPager(c.cluster, nsgName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list NSG rules: %w", err)
+		}
+		for _, r := range page.Value {
+			if r.Properties == nil || r.Properties.Priority == nil || r.Properties.Direction == nil || *r.Properties.Direction != armnetwork.SecurityRuleDirectionInbound {
+				continue
+			}
+			if r.Name != nil && *r.Name == base {
+				if nsgRuleUpToDate(r.Properties, protocol, sources, nodePorts) {
+					return nil
+				}
+				priority = *r.Properties.Priority
+				continue
+			}
+			used[*r.Properties.Priority] = true
+		}
+	}
+	for p := int32(nsgPriorityStart); priority == 0 && p <= nsgPriorityEnd; p++ {
+		if !used[p] {
+			priority = p
+		}
+	}
+	if priority == 0 {
+		return fmt.Errorf("no free NSG priority between %d and %d", nsgPriorityStart, nsgPriorityEnd)
+	}
+
+	props := &armnetwork.SecurityRulePropertiesFormat{
+		Priority:                 to.Ptr(priority),
+		Direction:                to.Ptr(armnetwork.SecurityRuleDirectionInbound),
+		Access:                   to.Ptr(armnetwork.SecurityRuleAccessAllow),
+		Protocol:                 to.Ptr(protocol),
+		SourcePortRange:          to.Ptr("*"),
+		DestinationAddressPrefix: to.Ptr("*"),
+		DestinationPortRanges:    to.SliceOfPtrs(nodePorts...),
+	}
+	// Service tags such as Internet are only accepted in the singular field
+	if len(sources) == 1 {
+		props.SourceAddressPrefix = to.Ptr(sources[0])
+	} else {
+		props.SourceAddressPrefixes = to.SliceOfPtrs(sources...)
+	}
+	poller, err := rulesClient.BeginCreateOrUpdate(ctx, c.cluster, nsgName, base, armnetwork.SecurityRule{
+		Name:       to.Ptr(base),
+		Properties: props,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set NSG rule '%s': %w", base, err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to set NSG rule '%s': %w", base, err)
+	}
+	log.Printf("Allowed %s to reach node ports %s of service %s/%s", strings.Join(sources, ", "), strings.Join(nodePorts, ", "), svc.Namespace, svc.Name)
+	return nil
+}
+
+func nsgRuleUpToDate(p *armnetwork.SecurityRulePropertiesFormat, protocol armnetwork.SecurityRuleProtocol, sources, ports []string) bool {
+	return p.Protocol != nil && *p.Protocol == protocol &&
+		sameStrings(ptrStrings(p.SourceAddressPrefix, p.SourceAddressPrefixes), sources) &&
+		sameStrings(ptrStrings(p.DestinationPortRange, p.DestinationPortRanges), ports)
+}
+
+// collect removes the frontends, rules, probes, public IPs and NSG rules of Services that are gone,
+// no longer of type LoadBalancer, or have dropped ports
+func (c *controller) collect(ctx context.Context) error {
+	services, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	wantFrontends := make(map[string]bool)
+	wantRules := make(map[string]bool)
+	wantServices := make(map[string]bool)
+	for _, svc := range services {
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer || svc.DeletionTimestamp != nil {
+			continue
+		}
+		base := serviceResourceName(svc.Namespace, svc.Name)
+		wantFrontends[base] = true
+		wantServices[svc.Namespace+"/"+svc.Name] = true
+		for _, port := range supportedPorts(svc) {
+			wantRules[ruleName(base, port)] = true
+		}
+	}
+
+	lbClient, err := armnetwork.NewLoadBalancersClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return err
+	}
+	lb, err := lbClient.Get(ctx, c.cluster, c.network.LBName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer '%s': %w", c.network.LBName, err)
+	}
+	if lb.Properties == nil {
+		return nil
+	}
+	for _, r := range lb.Properties.LoadBalancingRules {
+		if r == nil || r.Name == nil || !strings.HasPrefix(*r.Name, resourcePrefix) || wantRules[*r.Name] {
+			continue
+		}
+		// rule.Delete also drops the rule's probe once nothing else uses it
+		if err := rule.Delete(rule.DeleteRuleArgs{
+			SubscriptionID: c.subscriptionID,
+			ResourceGroup:  c.cluster,
+			LBName:         c.network.LBName,
+			RuleName:       *r.Name,
+		}); err != nil {
+			return fmt.Errorf("failed to delete rule '%s': %w", *r.Name, err)
+		}
+		log.Printf("Deleted rule '%s'", *r.Name)
+	}
+
+	// Frontends go once their rules are gone
+	lb, err = lbClient.Get(ctx, c.cluster, c.network.LBName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer '%s': %w", c.network.LBName, err)
+	}
+	var frontends []*armnetwork.FrontendIPConfiguration
+	var removed []string
+	for _, fe := range lb.Properties.FrontendIPConfigurations {
+		if fe != nil && fe.Name != nil && strings.HasPrefix(*fe.Name, resourcePrefix) && !wantFrontends[*fe.Name] {
+			removed = append(removed, *fe.Name)
+			continue
+		}
+		frontends = append(frontends, fe)
+	}
+	if len(removed) > 0 {
+		lb.Properties.FrontendIPConfigurations = frontends
+		poller, err := lbClient.BeginCreateOrUpdate(ctx, c.cluster, c.network.LBName, armnetwork.LoadBalancer{
+			Location:   lb.Location,
+			SKU:        lb.SKU,
+			Tags:       lb.Tags,
+			Properties: lb.Properties,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to remove frontends: %w", err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("failed to remove frontends: %w", err)
+		}
+		log.Printf("Deleted frontends %s", strings.Join(removed, ", "))
+	}
+
+	// Public IPs the controller created for Services that are gone
+	pipClient, err := armnetwork.NewPublicIPAddressesClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return err
+	}
+	pipPager := pipClient.NewListPager(c.cluster, nil)
+	for pipPager.More() {
+		page, err := pipPager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list public IPs: %w", err)
+		}
+		for _, pip := range page.Value {
+			owner, ok := pip.Tags[serviceTag]
+			if !ok || owner == nil || wantServices[*owner] || pip.Name == nil {
+				continue
+			}
+			if pip.Properties != nil && pip.Properties.IPConfiguration != nil {
+				// Still attached, e.g. to a frontend removed by a concurrent change; retry on the next pass
+				continue
+			}
+			poller, err := pipClient.BeginDelete(ctx, c.cluster, *pip.Name, nil)
+			if err != nil {
+				return fmt.Errorf("failed to delete public IP '%s': %w", *pip.Name, err)
+			}
+			if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+				return fmt.Errorf("failed to delete public IP '%s': %w", *pip.Name, err)
+			}
+			log.Printf("Deleted public IP '%s' of service %s", *pip.Name, *owner)
+		}
+	}
+
+	// NSG rules of Services that are gone
+	rulesClient, err := armnetwork.NewSecurityRulesClient(c.subscriptionID, c.cred, nil)
+	if err != nil {
+		return err
+	}
+	nsgPager := rulesClient.NewListPager(c.cluster, nsgName, nil)
+	for nsgPager.More() {
+		page, err := nsgPager.NextPage(ctx)
+		if err != nil {
+			var respErr *azcore.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == 404 {
+				return nil
+			}
+			return fmt.Errorf("failed to list NSG rules: %w", err)
+		}
+		for _, r := range page.Value {
+			if r.Name == nil || !strings.HasPrefix(*r.Name, resourcePrefix) || wantFrontends[*r.Name] {
+				continue
+			}
+			poller, err := rulesClient.BeginDelete(ctx, c.cluster, nsgName, *r.Name, nil)
+			if err != nil {
+				return fmt.Errorf("failed to delete NSG rule '%s': %w", *r.Name, err)
+			}
+			if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+				return fmt.Errorf("failed to delete NSG rule '%s': %w", *r.Name, err)
+			}
+			log.Printf("Deleted NSG rule '%s'", *r.Name)
+		}
+	}
+	return nil
+}
+
+func idName(sr *armnetwork.SubResource) string {
+	if sr == nil || sr.ID == nil {
+		return ""
+	}
+	return (*sr.ID)[strings.LastIndex(*sr.ID, "/")+1:]
+}
+
+func ptrStrings(single *string, multiple []*string) []string {
+	var out []string
+	if single != nil && *single != "" {
+		out = append(out, *single)
+	}
+	for _, v := range multiple {
+		if v != nil {
+			out = append(out, *v)
+		}
+	}
+	return out
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,19 +3,47 @@ package rule
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 )
 
+// Names of the load balancer pieces k3a creates for egress, which user rules never target
+const (
+	defaultFrontendName = "LoadBalancerFrontend"
+	outboundPrefix      = "outbound-"
+)
+
 type CreateRuleArgs struct {
-	SubscriptionID string
-	ResourceGroup  string
-	LBName         string
-	RuleName       string
-	FrontendPort   int
-	BackendPort    int
+	SubscriptionID     string
+	ResourceGroup      string
+	LBName             string
+	RuleName           string
+	FrontendPort       int
+	BackendPort        int
+	Protocol           string // "Tcp", "Udp" or "All"; defaults to Tcp
+	ProbeProtocol      string // "tcp", "http" or "https"; defaults to tcp
+	ProbePath          string // Request path for http and https probes; defaults to /
+	ProbePort          int    // Defaults to the backend port
+	BackendPool        string // k3a pool whose backend pool receives the traffic
+	Frontend           string // Frontend IP configuration name; defaults to the cluster's inbound frontend
+	IdleTimeoutMinutes int    // 4-30, 0 keeps the Azure default
+	FloatingIP         bool
+	SessionPersistence string // "None", "SourceIP" or "SourceIPProtocol"
+	TCPReset           bool
+}
+
+// BackendPoolName returns the load balancer backend pool that a k3a pool's VMSS joins
+func BackendPoolName(poolName string) string {
+	return fmt.Sprintf("%s-backend-pool", poolName)
+}
+
+// BackendPoolNameIPv6 returns the backend pool that a control-plane pool's IPv6 NIC config joins on a
+// dual-stack cluster, since a load balancing rule can't mix IP versions
+func BackendPoolNameIPv6(poolName string) string {
+	return BackendPoolName(poolName) + "-ipv6"
 }
 
 func Create(args CreateRuleArgs) error {
@@ -25,6 +53,9 @@ func Create(args CreateRuleArgs) error {
 	ruleName := args.RuleName
 	frontendPort := args.FrontendPort
 	backendPort := args.BackendPort
+	if err := args.validate(); err != nil {
+		return err
+	}
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
 		return err
@@ -50,74 +81,75 @@ func Create(args CreateRuleArgs) error {
 			Name: to.Ptr(armnetwork.LoadBalancerSKUNameStandard),
 		}
 	}
+	if props == nil {
+		props = &armnetwork.LoadBalancerPropertiesFormat{}
+	}
 
 	// Prepare the new rule, preserving existing rules
 	existingRules := []*armnetwork.LoadBalancingRule{}
-	var frontendIPConfigID *string
-	if props != nil && props.LoadBalancingRules != nil {
+	if props.LoadBalancingRules != nil {
 		existingRules = props.LoadBalancingRules
 	}
-	if props != nil && props.FrontendIPConfigurations != nil && len(props.FrontendIPConfigurations) > 0 {
-		frontendIPConfigID = props.FrontendIPConfigurations[0].ID
-	}
-	if frontendIPConfigID == nil {
-		return fmt.Errorf("No frontend IP configuration found on load balancer '%s'", lbName)
+	frontendIPConfigID, err := findFrontend(props.FrontendIPConfigurations, args.Frontend, lbName)
+	if err != nil {
+		return err
 	}
-	var backendPoolID *string
-	if props != nil && props.BackendAddressPools != nil && len(props.BackendAddressPools) > 0 {
-		for _, pool := range props.BackendAddressPools {
-			if pool != nil && pool.Name != nil && *pool.Name != "outbound-pool" {
-				backendPoolID = pool.ID
-				break
-			}
-		}
+	// Azure only allows HA ports rules on internal load balancers
+	if args.Protocol == string(armnetwork.TransportProtocolAll) && isPublicFrontend(props.FrontendIPConfigurations, *frontendIPConfigID) {
+		return fmt.Errorf("--protocol All (HA ports) needs an internal load balancer, but load balancer '%s' uses a public frontend", lbName)
 	}
-	if backendPoolID == nil {
-		return fmt.Errorf("No suitable backend address pool found on load balancer '%s' (excluding 'outbound-rule')", lbName)
+	backendPoolID, err := findBackendPool(props.BackendAddressPools, args.BackendPool, lbName)
+	if err != nil {
+		return err
 	}
 
-	// Ensure a TCP health probe exists for the backend port
-	probeName := fmt.Sprintf("probe-%d", backendPort)
-	probeExists := false
+	// Ensure a health probe exists for the backend port, replacing a stale one with the same name
+	probe := newProbe(args)
 	probes := []*armnetwork.Probe{}
-	if props != nil && props.Probes != nil {
-		probes = props.Probes
-		for _, p := range probes {
-			if p != nil && p.Name != nil && *p.Name == probeName {
-				probeExists = true
-				break
+	probeExists := false
+	for _, p := range props.Probes {
+		if p != nil && p.Name != nil && *p.Name == *probe.Name {
+			// Other rules share the probe, so changing its path would change their health checks too
+			if current := probePath(p); current != probePath(probe) && probeUsedByOthers(existingRules, p, ruleName) {
+				return fmt.Errorf("probe '%s' already checks path %s for other rules; use --probe-path %s or a different --probe-port", *p.Name, current, current)
 			}
+			probes = append(probes, probe)
+			probeExists = true
+			continue
 		}
+		probes = append(probes, p)
 	}
 	if !probeExists {
-		probes = append(probes, &armnetwork.Probe{
-			Name: to.Ptr(probeName),
-			Properties: &armnetwork.ProbePropertiesFormat{
-				Protocol:          to.Ptr(armnetwork.ProbeProtocolTCP),
-				Port:              to.Ptr(int32(backendPort)),
-				IntervalInSeconds: to.Ptr[int32](5),
-				NumberOfProbes:    to.Ptr[int32](2),
-			},
-		})
+		probes = append(probes, probe)
 	}
 
 	// Add or update the rule
-	newRule := &armnetwork.LoadBalancingRule{
-		Name: &ruleName,
-		Properties: &armnetwork.LoadBalancingRulePropertiesFormat{
-			FrontendPort: to.Ptr(int32(frontendPort)),
-			BackendPort:  to.Ptr(int32(backendPort)),
-			FrontendIPConfiguration: &armnetwork.SubResource{
-				ID: frontendIPConfigID,
-			},
-			BackendAddressPool: &armnetwork.SubResource{
-				ID: backendPoolID,
-			},
-			Probe: &armnetwork.SubResource{
-				ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s", subscriptionID, resourceGroup, lbName, probeName)),
-			},
-			DisableOutboundSnat: to.Ptr(true),
+	ruleProps := &armnetwork.LoadBalancingRulePropertiesFormat{
+		Protocol:     to.Ptr(armnetwork.TransportProtocol(args.Protocol)),
+		FrontendPort: to.Ptr(int32(frontendPort)),
+		BackendPort:  to.Ptr(int32(backendPort)),
+		FrontendIPConfiguration: &armnetwork.SubResource{
+			ID: frontendIPConfigID,
+		},
+		BackendAddressPool: &armnetwork.SubResource{
+			ID: backendPoolID,
 		},
+		Probe: &armnetwork.SubResource{
+			ID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s", subscriptionID, resourceGroup, lbName, *probe.Name)),
+		},
+		DisableOutboundSnat: to.Ptr(true),
+		EnableFloatingIP:    to.Ptr(args.FloatingIP),
+		LoadDistribution:    to.Ptr(loadDistribution(args.SessionPersistence)),
+	}
+	if args.IdleTimeoutMinutes > 0 {
+		ruleProps.IdleTimeoutInMinutes = to.Ptr(int32(args.IdleTimeoutMinutes))
+	}
+	if args.Protocol != string(armnetwork.TransportProtocolUDP) {
+		ruleProps.EnableTCPReset = to.Ptr(args.TCPReset)
+	}
+	newRule := &armnetwork.LoadBalancingRule{
+		Name:       &ruleName,
+		Properties: ruleProps,
 	}
 	// Replace if rule exists, else append
 	replaced := false
@@ -132,18 +164,15 @@ func Create(args CreateRuleArgs) error {
 		existingRules = append(existingRules, newRule)
 	}
 
-	// Wait for the rule creation to complete
 	// Preserve all existing properties while updating rules and probes
 	updatedLB := armnetwork.LoadBalancer{
 		Location:   location,
 		SKU:        sku,
+		Tags:       lb.LoadBalancer.Tags,
 		Properties: props, // Start with all existing properties
 	}
 
 	// Update only the rules and probes
-	if updatedLB.Properties == nil {
-		updatedLB.Properties = &armnetwork.LoadBalancerPropertiesFormat{}
-	}
 	updatedLB.Properties.LoadBalancingRules = existingRules
 	updatedLB.Properties.Probes = probes
 
@@ -158,3 +187,202 @@ func Create(args CreateRuleArgs) error {
 	}
 	return nil
 }
+
+// validate fills in defaults and rejects option combinations Azure doesn't allow
+func (args *CreateRuleArgs) validate() error {
+	switch strings.ToLower(args.Protocol) {
+	case "", "tcp":
+		args.Protocol = string(armnetwork.TransportProtocolTCP)
+	case "udp":
+		args.Protocol = string(armnetwork.TransportProtocolUDP)
+	case "all":
+		args.Protocol = string(armnetwork.TransportProtocolAll)
+		if args.FrontendPort != 0 || args.BackendPort != 0 {
+			return fmt.Errorf("--protocol All is an HA ports rule and needs --frontend-port 0 and --backend-port 0")
+		}
+	default:
+		return fmt.Errorf("invalid protocol: %s (must be Tcp, Udp or All)", args.Protocol)
+	}
+	if args.Protocol != string(armnetwork.TransportProtocolAll) {
+		if args.FrontendPort < 1 || args.FrontendPort > 65534 || args.BackendPort < 1 || args.BackendPort > 65535 {
+			return fmt.Errorf("frontend port must be between 1 and 65534 and backend port between 1 and 65535")
+		}
+	}
+
+	switch strings.ToLower(args.ProbeProtocol) {
+	case "", "tcp":
+		args.ProbeProtocol = string(armnetwork.ProbeProtocolTCP)
+		if args.ProbePath != "" {
+			return fmt.Errorf("--probe-path needs --probe-protocol http or https")
+		}
+	case "http":
+		args.ProbeProtocol = string(armnetwork.ProbeProtocolHTTP)
+	case "https":
+		args.ProbeProtocol = string(armnetwork.ProbeProtocolHTTPS)
+	default:
+		return fmt.Errorf("invalid probe protocol: %s (must be tcp, http or https)", args.ProbeProtocol)
+	}
+	if args.ProbeProtocol != string(armnetwork.ProbeProtocolTCP) {
+		if args.ProbePath == "" {
+			args.ProbePath = "/"
+		}
+		if !strings.HasPrefix(args.ProbePath, "/") {
+			return fmt.Errorf("--probe-path must start with /")
+		}
+	}
+	if args.ProbePort == 0 {
+		if args.Protocol == string(armnetwork.TransportProtocolAll) {
+			return fmt.Errorf("--probe-port is required for HA ports rules")
+		}
+		args.ProbePort = args.BackendPort
+	}
+	if args.ProbePort < 1 || args.ProbePort > 65535 {
+		return fmt.Errorf("--probe-port must be between 1 and 65535")
+	}
+
+	if args.IdleTimeoutMinutes != 0 && (args.IdleTimeoutMinutes < 4 || args.IdleTimeoutMinutes > 30) {
+		return fmt.Errorf("--idle-timeout must be between 4 and 30 minutes")
+	}
+	if args.TCPReset && args.Protocol == string(armnetwork.TransportProtocolUDP) {
+		return fmt.Errorf("--tcp-reset can't be used with UDP rules")
+	}
+	switch strings.ToLower(args.SessionPersistence) {
+	case "", "none":
+		args.SessionPersistence = "None"
+	case "sourceip":
+		args.SessionPersistence = "SourceIP"
+	case "sourceipprotocol":
+		args.SessionPersistence = "SourceIPProtocol"
+	default:
+		return fmt.Errorf("invalid session persistence: %s (must be None, SourceIP or SourceIPProtocol)", args.SessionPersistence)
+	}
+	return nil
+}
+
+// loadDistribution maps a session persistence mode to the Azure load distribution setting
+func loadDistribution(persistence string) armnetwork.LoadDistribution {
+	switch persistence {
+	case "SourceIP":
+		return armnetwork.LoadDistributionSourceIP
+	case "SourceIPProtocol":
+		return armnetwork.LoadDistributionSourceIPProtocol
+	default:
+		return armnetwork.LoadDistributionDefault
+	}
+}
+
+// newProbe builds the rule's health probe. Probes are named after their protocol and port so rules
+// probing the same port share them.
+func newProbe(args CreateRuleArgs) *armnetwork.Probe {
+	props := &armnetwork.ProbePropertiesFormat{
+		Protocol:          to.Ptr(armnetwork.ProbeProtocol(args.ProbeProtocol)),
+		Port:              to.Ptr(int32(args.ProbePort)),
+		IntervalInSeconds: to.Ptr[int32](5),
+		NumberOfProbes:    to.Ptr[int32](2),
+	}
+	if args.ProbeProtocol != string(armnetwork.ProbeProtocolTCP) {
+		props.RequestPath = to.Ptr(args.ProbePath)
+	}
+	return &armnetwork.Probe{Name: to.Ptr(ProbeName(args.ProbeProtocol, args.ProbePort)), Properties: props}
+}
+
+// probePath returns the request path of an http or https probe, empty for tcp probes
+func probePath(p *armnetwork.Probe) string {
+	if p.Properties == nil || p.Properties.RequestPath == nil {
+		return ""
+	}
+	return *p.Properties.RequestPath
+}
+
+// probeUsedByOthers reports whether a rule other than ruleName references the probe
+func probeUsedByOthers(rules []*armnetwork.LoadBalancingRule, probe *armnetwork.Probe, ruleName string) bool {
+	for _, r := range rules {
+		if r == nil || r.Name == nil || strings.EqualFold(*r.Name, ruleName) {
+			continue
+		}
+		if r.Properties != nil && r.Properties.Probe != nil && r.Properties.Probe.ID != nil && probe.ID != nil &&
+			strings.EqualFold(*r.Properties.Probe.ID, *probe.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeName returns the name of the shared probe for a protocol and port
+func ProbeName(protocol string, port int) string {
+	if strings.EqualFold(protocol, string(armnetwork.ProbeProtocolTCP)) || protocol == "" {
+		return fmt.Sprintf("probe-%d", port)
+	}
+	return fmt.Sprintf("probe-%s-%d", strings.ToLower(protocol), port)
+}
+
+// findFrontend returns the named frontend IP configuration, or the cluster's inbound frontend
+func findFrontend(frontends []*armnetwork.FrontendIPConfiguration, name, lbName string) (*string, error) {
+	var fallback *string
+	for _, fe := range frontends {
+		if fe == nil || fe.Name == nil {
+			continue
+		}
+		if name != "" {
+			if *fe.Name == name {
+				return fe.ID, nil
+			}
+			continue
+		}
+		if *fe.Name == defaultFrontendName {
+			return fe.ID, nil
+		}
+		if fallback == nil && !strings.HasPrefix(*fe.Name, outboundPrefix) {
+			fallback = fe.ID
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("frontend IP configuration '%s' not found on load balancer '%s'", name, lbName)
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("no inbound frontend IP configuration found on load balancer '%s'", lbName)
+	}
+	return fallback, nil
+}
+
+// isPublicFrontend reports whether the frontend IP configuration with the given ID has a public IP
+func isPublicFrontend(frontends []*armnetwork.FrontendIPConfiguration, id string) bool {
+	for _, fe := range frontends {
+		if fe != nil && fe.ID != nil && strings.EqualFold(*fe.ID, id) {
+			return fe.Properties != nil && fe.Properties.PublicIPAddress != nil
+		}
+	}
+	return false
+}
+
+// findBackendPool returns the backend pool of the named k3a pool. Without a name the load balancer
+// must have exactly one node pool backend, since guessing could send traffic to the wrong pool.
+func findBackendPool(pools []*armnetwork.BackendAddressPool, poolName, lbName string) (*string, error) {
+	var candidates []*armnetwork.BackendAddressPool
+	for _, bp := range pools {
+		if bp == nil || bp.Name == nil || strings.HasPrefix(*bp.Name, outboundPrefix) {
+			continue
+		}
+		if poolName != "" && (*bp.Name == BackendPoolName(poolName) || *bp.Name == poolName) {
+			return bp.ID, nil
+		}
+		if strings.HasSuffix(*bp.Name, BackendPoolNameIPv6("")) {
+			continue
+		}
+		candidates = append(candidates, bp)
+	}
+	if poolName != "" {
+		return nil, fmt.Errorf("backend pool for pool '%s' not found on load balancer '%s'", poolName, lbName)
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no node pool backend found on load balancer '%s'", lbName)
+	case 1:
+		return candidates[0].ID, nil
+	}
+	var names []string
+	for _, bp := range candidates {
+		names = append(names, strings.TrimSuffix(*bp.Name, "-backend-pool"))
+	}
+	return nil, fmt.Errorf("load balancer '%s' has several node pools (%s), pick one with --backend-pool", lbName, strings.Join(names, ", "))
+}
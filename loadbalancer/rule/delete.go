@@ -2,6 +2,7 @@ package rule
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -33,20 +34,26 @@ func Delete(args DeleteRuleArgs) error {
 	if err != nil {
 		return err
 	}
+	if lb.Properties == nil {
+		return fmt.Errorf("rule '%s' not found on load balancer '%s'", ruleName, lbName)
+	}
 	var probeIDToDelete *string
-	if lb.Properties != nil && lb.Properties.LoadBalancingRules != nil {
-		for i, rule := range lb.Properties.LoadBalancingRules {
-			if *rule.Name == ruleName {
-				if rule.Properties != nil && rule.Properties.Probe != nil && rule.Properties.Probe.ID != nil {
-					probeIDToDelete = rule.Properties.Probe.ID
-				}
-				lb.Properties.LoadBalancingRules = append((lb.Properties.LoadBalancingRules)[:i], (lb.Properties.LoadBalancingRules)[i+1:]...)
-				break
+	found := false
+	for i, rule := range lb.Properties.LoadBalancingRules {
+		if rule != nil && rule.Name != nil && *rule.Name == ruleName {
+			if rule.Properties != nil && rule.Properties.Probe != nil && rule.Properties.Probe.ID != nil {
+				probeIDToDelete = rule.Properties.Probe.ID
 			}
+			lb.Properties.LoadBalancingRules = append(lb.Properties.LoadBalancingRules[:i], lb.Properties.LoadBalancingRules[i+1:]...)
+			found = true
+			break
 		}
 	}
-	// Remove the associated probe if it exists
-	if probeIDToDelete != nil && lb.Properties != nil && lb.Properties.Probes != nil {
+	if !found {
+		return fmt.Errorf("rule '%s' not found on load balancer '%s'", ruleName, lbName)
+	}
+	// Remove the rule's probe once no remaining rule uses it, since probes are shared between rules on the same port
+	if probeIDToDelete != nil && !probeInUse(lb.Properties.LoadBalancingRules, *probeIDToDelete) {
 		probeName := (*probeIDToDelete)[strings.LastIndex(*probeIDToDelete, "/")+1:]
 		for i, probe := range lb.Properties.Probes {
 			if probe != nil && probe.Name != nil && *probe.Name == probeName {
@@ -72,3 +79,14 @@ func Delete(args DeleteRuleArgs) error {
 	}
 	return nil
 }
+
+// probeInUse reports whether any of the rules references the probe
+func probeInUse(rules []*armnetwork.LoadBalancingRule, probeID string) bool {
+	for _, r := range rules {
+		if r != nil && r.Properties != nil && r.Properties.Probe != nil && r.Properties.Probe.ID != nil &&
+			strings.EqualFold(*r.Properties.Probe.ID, probeID) {
+			return true
+		}
+	}
+	return false
+}
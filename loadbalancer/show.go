@@ -0,0 +1,303 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"github.com/rodaine/table"
+)
+
+type ShowLoadBalancerArgs struct {
+	SubscriptionID string
+	ResourceGroup  string
+	LBName         string
+}
+
+// Show prints a load balancer's frontends, backend pools and their members, inbound NAT pools and
+// rules, outbound rules with their SNAT allocation, and load balancing rules with their probes
+func Show(args ShowLoadBalancerArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client, err := armnetwork.NewLoadBalancersClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(ctx, args.ResourceGroup, args.LBName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer '%s': %w", args.LBName, err)
+	}
+	lb := resp.LoadBalancer
+	props := lb.Properties
+	if props == nil {
+		props = &armnetwork.LoadBalancerPropertiesFormat{}
+	}
+	sku := ""
+	if lb.SKU != nil && lb.SKU.Name != nil {
+		sku = string(*lb.SKU.Name)
+	}
+	fmt.Printf("Load balancer: %s (%s, %s)\n", args.LBName, safeString(lb.Location), sku)
+
+	// Frontends
+	publicIPClient, err := armnetwork.NewPublicIPAddressesClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("\nFrontends:")
+	frontendTable := table.New("NAME", "IP", "FQDN", "PUBLIC IP / SUBNET")
+	for _, fe := range props.FrontendIPConfigurations {
+		if fe == nil || fe.Properties == nil {
+			continue
+		}
+		ip, fqdn, source := "", "", ""
+		switch {
+		case fe.Properties.PublicIPAddress != nil && fe.Properties.PublicIPAddress.ID != nil:
+			source = resourceName(*fe.Properties.PublicIPAddress.ID)
+			ip, fqdn = getPublicIP(ctx, publicIPClient, *fe.Properties.PublicIPAddress.ID)
+		case fe.Properties.PrivateIPAddress != nil:
+			ip = *fe.Properties.PrivateIPAddress
+			if fe.Properties.Subnet != nil && fe.Properties.Subnet.ID != nil {
+				source = resourceName(*fe.Properties.Subnet.ID)
+			}
+		}
+		frontendTable.AddRow(safeString(fe.Name), ip, fqdn, source)
+	}
+	frontendTable.Print()
+
+	// Backend pools and the VMSS instances in them
+	fmt.Println("\nBackend pools:")
+	poolSizes := make(map[string]int)
+	backendTable := table.New("POOL", "VMSS", "INSTANCES")
+	for _, bp := range props.BackendAddressPools {
+		if bp == nil {
+			continue
+		}
+		members := make(map[string][]string)
+		if bp.Properties != nil {
+			for _, ipConfig := range bp.Properties.BackendIPConfigurations {
+				if ipConfig == nil || ipConfig.ID == nil {
+					continue
+				}
+				vmss, instance := instanceFromIPConfig(*ipConfig.ID)
+				members[vmss] = append(members[vmss], instance)
+				poolSizes[strings.ToLower(safeString(bp.ID))]++
+			}
+		}
+		if len(members) == 0 {
+			backendTable.AddRow(safeString(bp.Name), "-", "")
+			continue
+		}
+		for _, vmss := range sortedKeys(members) {
+			instances := members[vmss]
+			sort.Strings(instances)
+			backendTable.AddRow(safeString(bp.Name), vmss, strings.Join(instances, ", "))
+		}
+	}
+	backendTable.Print()
+
+	// Inbound NAT pools and the per-instance NAT rules Azure derives from them
+	if len(props.InboundNatPools) > 0 || len(props.InboundNatRules) > 0 {
+		fmt.Println("\nInbound NAT pools:")
+		natPoolTable := table.New("NAME", "FRONTEND", "PROTOCOL", "FRONTEND PORTS", "BACKEND PORT")
+		for _, np := range props.InboundNatPools {
+			if np == nil || np.Properties == nil {
+				continue
+			}
+			natPoolTable.AddRow(safeString(np.Name), subResourceName(np.Properties.FrontendIPConfiguration), protocolString(np.Properties.Protocol),
+				fmt.Sprintf("%d-%d", safeInt32(np.Properties.FrontendPortRangeStart), safeInt32(np.Properties.FrontendPortRangeEnd)), safeInt32(np.Properties.BackendPort))
+		}
+		natPoolTable.Print()
+
+		fmt.Println("\nInbound NAT rules:")
+		natRuleTable := table.New("NAME", "FRONTEND", "FRONTEND PORT", "VMSS", "INSTANCE", "BACKEND PORT")
+		natRules := props.InboundNatRules
+		sort.Slice(natRules, func(i, j int) bool {
+			return natFrontendPort(natRules[i]) < natFrontendPort(natRules[j])
+		})
+		for _, nr := range natRules {
+			if nr == nil || nr.Properties == nil {
+				continue
+			}
+			vmss, instance := "-", "-"
+			if nr.Properties.BackendIPConfiguration != nil && nr.Properties.BackendIPConfiguration.ID != nil {
+				vmss, instance = instanceFromIPConfig(*nr.Properties.BackendIPConfiguration.ID)
+			}
+			natRuleTable.AddRow(safeString(nr.Name), subResourceName(nr.Properties.FrontendIPConfiguration), natFrontendPort(nr), vmss, instance, safeInt32(nr.Properties.BackendPort))
+		}
+		natRuleTable.Print()
+	}
+
+	// Outbound rules with their SNAT port budget
+	if len(props.OutboundRules) > 0 {
+		fmt.Println("\nOutbound rules:")
+		outboundTable := table.New("NAME", "PROTOCOL", "BACKEND POOL", "IPS", "PORTS/INSTANCE", "INSTANCES", "SNAT USED", "IDLE TIMEOUT")
+		for _, or := range props.OutboundRules {
+			if or == nil || or.Properties == nil {
+				continue
+			}
+			ipCount := len(or.Properties.FrontendIPConfigurations)
+			ports := int(safeInt32(or.Properties.AllocatedOutboundPorts))
+			instances := 0
+			if or.Properties.BackendAddressPool != nil {
+				instances = poolSizes[strings.ToLower(safeString(or.Properties.BackendAddressPool.ID))]
+			}
+			portsLabel, used := "auto", "-"
+			if ports > 0 {
+				portsLabel = fmt.Sprintf("%d", ports)
+				capacity := ipCount * clusternet.PortsPerFrontendIP
+				used = fmt.Sprintf("%d/%d (max %d instances)", ports*instances, capacity, capacity/ports)
+			}
+			outboundTable.AddRow(safeString(or.Name), protocolString(or.Properties.Protocol), subResourceName(or.Properties.BackendAddressPool),
+				ipCount, portsLabel, instances, used, fmt.Sprintf("%dm", safeInt32(or.Properties.IdleTimeoutInMinutes)))
+		}
+		outboundTable.Print()
+	}
+
+	// Load balancing rules with their probes
+	probes := make(map[string]*armnetwork.Probe)
+	for _, p := range props.Probes {
+		if p != nil && p.ID != nil {
+			probes[strings.ToLower(*p.ID)] = p
+		}
+	}
+	fmt.Println("\nRules:")
+	ruleTable := table.New("NAME", "PROTOCOL", "FRONTEND", "FRONTEND PORT", "BACKEND POOL", "BACKEND PORT", "PROBE", "OPTIONS")
+	for _, r := range props.LoadBalancingRules {
+		if r == nil || r.Properties == nil {
+			continue
+		}
+		probe := "-"
+		if r.Properties.Probe != nil && r.Properties.Probe.ID != nil {
+			probe = probeString(probes[strings.ToLower(*r.Properties.Probe.ID)], *r.Properties.Probe.ID)
+		}
+		ruleTable.AddRow(safeString(r.Name), protocolString(r.Properties.Protocol), subResourceName(r.Properties.FrontendIPConfiguration),
+			safeInt32(r.Properties.FrontendPort), subResourceName(r.Properties.BackendAddressPool), safeInt32(r.Properties.BackendPort), probe, ruleOptions(r.Properties))
+	}
+	ruleTable.Print()
+	return nil
+}
+
+// getPublicIP returns the address and FQDN of a public IP, or empty strings if it can't be read
+func getPublicIP(ctx context.Context, client *armnetwork.PublicIPAddressesClient, id string) (string, string) {
+	rid, err := arm.ParseResourceID(id)
+	if err != nil {
+		return "", ""
+	}
+	resp, err := client.Get(ctx, rid.ResourceGroupName, rid.Name, nil)
+	if err != nil || resp.Properties == nil {
+		return "", ""
+	}
+	fqdn := ""
+	if resp.Properties.DNSSettings != nil {
+		fqdn = safeString(resp.Properties.DNSSettings.Fqdn)
+	}
+	return safeString(resp.Properties.IPAddress), fqdn
+}
+
+// instanceFromIPConfig extracts the VMSS name and instance ID from a VMSS NIC IP configuration ID
+// (.../virtualMachineScaleSets/<vmss>/virtualMachines/<id>/networkInterfaces/<nic>/ipConfigurations/<name>)
+func instanceFromIPConfig(id string) (string, string) {
+	parts := strings.Split(id, "/")
+	vmss, instance := "", ""
+	for i := 0; i+1 < len(parts); i++ {
+		switch strings.ToLower(parts[i]) {
+		case "virtualmachinescalesets":
+			vmss = parts[i+1]
+		case "virtualmachines":
+			instance = parts[i+1]
+		case "networkinterfaces":
+			if vmss == "" {
+				// A standalone NIC rather than a VMSS instance
+				vmss = parts[i+1]
+			}
+		}
+	}
+	if vmss == "" {
+		return resourceName(id), ""
+	}
+	return vmss, instance
+}
+
+func natFrontendPort(nr *armnetwork.InboundNatRule) int32 {
+	if nr == nil || nr.Properties == nil {
+		return 0
+	}
+	return safeInt32(nr.Properties.FrontendPort)
+}
+
+func probeString(p *armnetwork.Probe, id string) string {
+	if p == nil || p.Properties == nil {
+		return resourceName(id)
+	}
+	s := fmt.Sprintf("%s (%s:%d", safeString(p.Name), strings.ToLower(protocolString(p.Properties.Protocol)), safeInt32(p.Properties.Port))
+	if p.Properties.RequestPath != nil {
+		s += *p.Properties.RequestPath
+	}
+	return s + ")"
+}
+
+func ruleOptions(props *armnetwork.LoadBalancingRulePropertiesFormat) string {
+	var opts []string
+	if props.IdleTimeoutInMinutes != nil {
+		opts = append(opts, fmt.Sprintf("idle=%dm", *props.IdleTimeoutInMinutes))
+	}
+	if props.EnableFloatingIP != nil && *props.EnableFloatingIP {
+		opts = append(opts, "floating-ip")
+	}
+	if props.EnableTCPReset != nil && *props.EnableTCPReset {
+		opts = append(opts, "tcp-reset")
+	}
+	if props.LoadDistribution != nil && *props.LoadDistribution != armnetwork.LoadDistributionDefault {
+		opts = append(opts, "persistence="+string(*props.LoadDistribution))
+	}
+	return strings.Join(opts, ", ")
+}
+
+func subResourceName(sr *armnetwork.SubResource) string {
+	if sr == nil || sr.ID == nil {
+		return "-"
+	}
+	return resourceName(*sr.ID)
+}
+
+func resourceName(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+func protocolString[T ~string](p *T) string {
+	if p == nil {
+		return ""
+	}
+	return string(*p)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func safeString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func safeInt32(i *int32) int32 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
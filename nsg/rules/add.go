@@ -3,6 +3,7 @@ package rules
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -30,11 +31,48 @@ func AddRule(args AddRuleArgs) error {
 		return err
 	}
 	ctx := context.Background()
+
+	// Check the rule against the rest of the NSG before sending it to Azure
+	live, err := getRules(ctx, args.SubscriptionID, args.ResourceGroup, args.NSGName, cred)
+	if err != nil {
+		return err
+	}
+	rule := Rule{
+		Name:            args.RuleName,
+		Priority:        args.Priority,
+		Direction:       args.Direction,
+		Access:          args.Access,
+		Protocol:        args.Protocol,
+		Sources:         append([]string(nil), args.Sources...),
+		SourcePort:      append([]string(nil), args.SourcePort...),
+		Destination:     append([]string(nil), args.Destination...),
+		DestinationPort: append([]string(nil), args.DestinationPort...),
+	}
+	rule.normalize()
+	rules := []Rule{rule}
+	for key, r := range live {
+		if key != strings.ToLower(args.RuleName) {
+			rules = append(rules, r)
+		}
+	}
+	if err := checkRules(rules, args.RuleName); err != nil {
+		return err
+	}
+
 	client, err := armnetwork.NewSecurityRulesClient(args.SubscriptionID, cred, nil)
 	if err != nil {
 		return err
 	}
 
+	_, err = client.BeginCreateOrUpdate(ctx, args.ResourceGroup, args.NSGName, args.RuleName, securityRule(args), nil)
+	if err != nil {
+		return fmt.Errorf("failed to add NSG rule: %w", err)
+	}
+	return nil
+}
+
+// securityRule builds the ARM rule for args, using the singular prefix/range fields when there is one value
+func securityRule(args AddRuleArgs) armnetwork.SecurityRule {
 	ruleParams := armnetwork.SecurityRule{
 		Name: &args.RuleName,
 		Properties: &armnetwork.SecurityRulePropertiesFormat{
@@ -64,10 +102,5 @@ func AddRule(args AddRuleArgs) error {
 		ruleParams.Properties.DestinationPortRange = to.Ptr(args.DestinationPort[0])
 		ruleParams.Properties.DestinationPortRanges = nil // Clear if single port is used
 	}
-
-	_, err = client.BeginCreateOrUpdate(ctx, args.ResourceGroup, args.NSGName, args.RuleName, ruleParams, nil)
-	if err != nil {
-		return fmt.Errorf("failed to add NSG rule: %w", err)
-	}
-	return nil
+	return ruleParams
 }
@@ -0,0 +1,149 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"github.com/rodaine/table"
+)
+
+// systemRules are created and updated by k3a itself (cluster create and cluster access-ranges set).
+// apply leaves them alone unless the rules file lists them.
+var systemRules = map[string]bool{
+	"allowcorpnetpublic":    true,
+	"allowapiserverinbound": true,
+	"allowsshinbound":       true,
+}
+
+// managedRule reports whether k3a keeps a rule up to date itself: the system rules, and the Service rules
+// the LoadBalancer controller re-creates on every sync
+func managedRule(key string) bool {
+	return systemRules[key] || strings.HasPrefix(key, strings.ToLower(clusternet.ServiceResourcePrefix))
+}
+
+type ApplyArgs struct {
+	SubscriptionID string
+	ResourceGroup  string
+	NSGName        string
+	File           string
+	DryRun         bool // Only print the plan
+}
+
+// Change is one step of an apply plan
+type Change struct {
+	Action string // "add", "update" or "delete"
+	Rule   Rule
+}
+
+// Apply reconciles the NSG's rules with a rules file: it prints the adds, updates and deletes, then makes them
+func Apply(args ApplyArgs) error {
+	file, err := LoadFile(args.File)
+	if err != nil {
+		return err
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	live, err := getRules(ctx, args.SubscriptionID, args.ResourceGroup, args.NSGName, cred)
+	if err != nil {
+		return err
+	}
+
+	// Lint the rule set the NSG will end up with: the file plus the managed rules apply keeps
+	final := append([]Rule(nil), file.Rules...)
+	var names []string
+	for _, r := range file.Rules {
+		names = append(names, r.Name)
+	}
+	listed := make(map[string]bool)
+	for _, name := range names {
+		listed[strings.ToLower(name)] = true
+	}
+	for key, r := range live {
+		if managedRule(key) && !listed[key] {
+			final = append(final, r)
+		}
+	}
+	if err := checkRules(final, names...); err != nil {
+		return err
+	}
+
+	plan := Plan(file.Rules, live)
+	if len(plan) == 0 {
+		fmt.Printf("NSG '%s' already matches %s, nothing to do.\n", args.NSGName, args.File)
+		return nil
+	}
+
+	tbl := table.New("ACTION", "NAME", "PRIORITY", "DIRECTION", "ACCESS", "PROTOCOL", "SRC", "SRC PORT", "DEST", "DEST PORT")
+	for _, c := range plan {
+		r := c.Rule
+		tbl.AddRow(c.Action, r.Name, r.Priority, r.Direction, r.Access, r.Protocol,
+			strings.Join(r.Sources, ", "), strings.Join(r.SourcePort, ", "), strings.Join(r.Destination, ", "), strings.Join(r.DestinationPort, ", "))
+	}
+	tbl.Print()
+	if args.DryRun {
+		return nil
+	}
+
+	client, err := armnetwork.NewSecurityRulesClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return err
+	}
+	for _, c := range plan {
+		if c.Action == "delete" {
+			poller, err := client.BeginDelete(ctx, args.ResourceGroup, args.NSGName, c.Rule.Name, nil)
+			if err != nil {
+				return fmt.Errorf("failed to start deleting NSG rule '%s': %w", c.Rule.Name, err)
+			}
+			if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+				return fmt.Errorf("failed to delete NSG rule '%s': %w", c.Rule.Name, err)
+			}
+			continue
+		}
+		rule := securityRule(c.Rule.args(args.SubscriptionID, args.ResourceGroup, args.NSGName))
+		poller, err := client.BeginCreateOrUpdate(ctx, args.ResourceGroup, args.NSGName, c.Rule.Name, rule, nil)
+		if err != nil {
+			return fmt.Errorf("failed to %s NSG rule '%s': %w", c.Action, c.Rule.Name, err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("failed to %s NSG rule '%s': %w", c.Action, c.Rule.Name, err)
+		}
+	}
+	fmt.Printf("Applied %d change(s) to NSG '%s'.\n", len(plan), args.NSGName)
+	return nil
+}
+
+// Plan diffs the desired rules against the live ones. Deletes come first so freed priorities can be reused
+// by the adds and updates that follow. Live rules k3a manages that aren't desired are kept.
+func Plan(desired []Rule, live map[string]Rule) []Change {
+	var deletes, changes []Change
+	wanted := make(map[string]bool)
+	for _, r := range desired {
+		key := strings.ToLower(r.Name)
+		wanted[key] = true
+		current, ok := live[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: "add", Rule: r})
+		case !r.equal(current):
+			// Keep the live name's casing since ARM rule names are case-insensitive
+			r.Name = current.Name
+			changes = append(changes, Change{Action: "update", Rule: r})
+		}
+	}
+	for key, r := range live {
+		if !wanted[key] && !managedRule(key) {
+			deletes = append(deletes, Change{Action: "delete", Rule: r})
+		}
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Rule.Name < deletes[j].Rule.Name })
+	return append(deletes, changes...)
+}
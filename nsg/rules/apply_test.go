@@ -0,0 +1,22 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanKeepsManagedRules(t *testing.T) {
+	live := map[string]Rule{}
+	for _, r := range []Rule{
+		rule("AllowSSHInbound", 100, "Allow", "Tcp", []string{"203.0.113.0/24"}, []string{"22"}),
+		rule("k3a-svc-default-web-1a2b3c", 3000, "Allow", "Tcp", []string{"Internet"}, []string{"30080"}),
+		rule("stale", 300, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"80"}),
+	} {
+		live[strings.ToLower(r.Name)] = r
+	}
+
+	plan := Plan(nil, live)
+	if len(plan) != 1 || plan[0].Action != "delete" || plan[0].Rule.Name != "stale" {
+		t.Fatalf("expected only 'stale' to be deleted, got %+v", plan)
+	}
+}
@@ -0,0 +1,219 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleFile is the YAML document read by apply and written by export
+type RuleFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is one NSG rule in a rules file; the fields mirror AddRuleArgs
+type Rule struct {
+	Name            string   `yaml:"name"`
+	Priority        int32    `yaml:"priority"`
+	Direction       string   `yaml:"direction"`
+	Access          string   `yaml:"access"`
+	Protocol        string   `yaml:"protocol"`
+	Sources         []string `yaml:"sources"`
+	SourcePort      []string `yaml:"sourcePort"`
+	Destination     []string `yaml:"destination"`
+	DestinationPort []string `yaml:"destinationPort"`
+}
+
+// LoadFile reads a rules file, filling in "*" for omitted address and port lists
+func LoadFile(path string) (*RuleFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	var file RuleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i := range file.Rules {
+		r := &file.Rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d in %s has no name", i+1, path)
+		}
+		if seen[strings.ToLower(r.Name)] {
+			return nil, fmt.Errorf("rule '%s' is listed more than once in %s", r.Name, path)
+		}
+		seen[strings.ToLower(r.Name)] = true
+		r.normalize()
+	}
+	return &file, nil
+}
+
+// normalize fills in defaults and sorts lists so rules can be compared
+func (r *Rule) normalize() {
+	if r.Direction == "" {
+		r.Direction = "Inbound"
+	}
+	if r.Access == "" {
+		r.Access = "Allow"
+	}
+	if r.Protocol == "" {
+		r.Protocol = "*"
+	}
+	for _, list := range []*[]string{&r.Sources, &r.SourcePort, &r.Destination, &r.DestinationPort} {
+		if len(*list) == 0 {
+			*list = []string{"*"}
+		}
+		sort.Strings(*list)
+	}
+}
+
+// equal reports whether two normalized rules describe the same rule
+func (r Rule) equal(o Rule) bool {
+	return r.Priority == o.Priority &&
+		strings.EqualFold(r.Direction, o.Direction) &&
+		strings.EqualFold(r.Access, o.Access) &&
+		strings.EqualFold(r.Protocol, o.Protocol) &&
+		equalStrings(r.Sources, o.Sources) &&
+		equalStrings(r.SourcePort, o.SourcePort) &&
+		equalStrings(r.Destination, o.Destination) &&
+		equalStrings(r.DestinationPort, o.DestinationPort)
+}
+
+// args converts the rule to AddRuleArgs for the given NSG
+func (r Rule) args(subscriptionID, resourceGroup, nsgName string) AddRuleArgs {
+	return AddRuleArgs{
+		SubscriptionID:  subscriptionID,
+		ResourceGroup:   resourceGroup,
+		NSGName:         nsgName,
+		RuleName:        r.Name,
+		Priority:        r.Priority,
+		Direction:       r.Direction,
+		Access:          r.Access,
+		Protocol:        r.Protocol,
+		Sources:         r.Sources,
+		SourcePort:      r.SourcePort,
+		Destination:     r.Destination,
+		DestinationPort: r.DestinationPort,
+	}
+}
+
+// ruleFromSecurityRule converts a live NSG rule to the rules file form
+func ruleFromSecurityRule(sr *armnetwork.SecurityRule) Rule {
+	r := Rule{Name: safeString(sr.Name)}
+	props := sr.Properties
+	if props == nil {
+		r.normalize()
+		return r
+	}
+	r.Priority = safeInt32(props.Priority)
+	if props.Direction != nil {
+		r.Direction = string(*props.Direction)
+	}
+	if props.Access != nil {
+		r.Access = string(*props.Access)
+	}
+	if props.Protocol != nil {
+		r.Protocol = string(*props.Protocol)
+	}
+	r.Sources = prefixList(props.SourceAddressPrefix, props.SourceAddressPrefixes)
+	r.SourcePort = prefixList(props.SourcePortRange, props.SourcePortRanges)
+	r.Destination = prefixList(props.DestinationAddressPrefix, props.DestinationAddressPrefixes)
+	r.DestinationPort = prefixList(props.DestinationPortRange, props.DestinationPortRanges)
+	r.normalize()
+	return r
+}
+
+// prefixList merges the singular and plural forms ARM uses for prefixes and port ranges
+func prefixList(single *string, multiple []*string) []string {
+	var out []string
+	if single != nil && *single != "" {
+		out = append(out, *single)
+	}
+	for _, v := range multiple {
+		if v != nil {
+			out = append(out, *v)
+		}
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// getRules returns the NSG's rules, excluding Azure's default rules, by name
+func getRules(ctx context.Context, subscriptionID, resourceGroup, nsgName string, cred *azidentity.DefaultAzureCredential) (map[string]Rule, error) {
+	client, err := armnetwork.NewSecurityGroupsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NSG client: %w", err)
+	}
+	nsg, err := client.Get(ctx, resourceGroup, nsgName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NSG '%s': %w", nsgName, err)
+	}
+	live := make(map[string]Rule)
+	if nsg.Properties != nil {
+		for _, sr := range nsg.Properties.SecurityRules {
+			r := ruleFromSecurityRule(sr)
+			live[strings.ToLower(r.Name)] = r
+		}
+	}
+	return live, nil
+}
+
+type ExportArgs struct {
+	SubscriptionID string
+	ResourceGroup  string
+	NSGName        string
+	Output         io.Writer
+}
+
+// Export writes the NSG's rules as a rules file, ordered by direction and priority. The LoadBalancer
+// controller's Service rules are left out since they follow the Services, not the file.
+func Export(args ExportArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return err
+	}
+	live, err := getRules(context.Background(), args.SubscriptionID, args.ResourceGroup, args.NSGName, cred)
+	if err != nil {
+		return err
+	}
+	file := RuleFile{Rules: []Rule{}}
+	for key, r := range live {
+		if strings.HasPrefix(key, strings.ToLower(clusternet.ServiceResourcePrefix)) {
+			continue
+		}
+		file.Rules = append(file.Rules, r)
+	}
+	sort.Slice(file.Rules, func(i, j int) bool {
+		if file.Rules[i].Direction != file.Rules[j].Direction {
+			return file.Rules[i].Direction == "Inbound"
+		}
+		return file.Rules[i].Priority < file.Rules[j].Priority
+	})
+
+	enc := yaml.NewEncoder(args.Output)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return fmt.Errorf("failed to write rules: %w", err)
+	}
+	return enc.Close()
+}
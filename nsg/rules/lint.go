@@ -0,0 +1,446 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/rodaine/table"
+)
+
+// Severities of lint findings. Errors are rejected before a rule is sent to Azure.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// sensitivePorts are ports that should never be open to the whole internet
+var sensitivePorts = map[int]string{
+	22:   "SSH",
+	6443: "Kubernetes API",
+	2379: "etcd",
+}
+
+// broadSources are address prefixes that match any source on the internet
+var broadSources = map[string]bool{
+	"*":         true,
+	"internet":  true,
+	"any":       true,
+	"0.0.0.0/0": true,
+	"::/0":      true,
+}
+
+// serviceTagPattern matches service tags such as Internet, AzureLoadBalancer or Storage.WestUS
+var serviceTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z0-9]+)?$`)
+
+// Finding is a problem found in a rule set
+type Finding struct {
+	Severity string
+	Rule     string
+	Message  string
+}
+
+// Lint checks a rule set for invalid fields, duplicate priorities, shadowed rules and internet-wide
+// allows on sensitive ports. It works offline on normalized rules.
+func Lint(rules []Rule) []Finding {
+	var findings []Finding
+	add := func(severity string, r Rule, format string, a ...any) {
+		findings = append(findings, Finding{Severity: severity, Rule: r.Name, Message: fmt.Sprintf(format, a...)})
+	}
+
+	valid := make([]bool, len(rules))
+	for i, r := range rules {
+		valid[i] = true
+		for _, msg := range validateRule(r) {
+			add(SeverityError, r, "%s", msg)
+			valid[i] = false
+		}
+	}
+
+	// Duplicate priorities within a direction
+	byPriority := make(map[string][]string)
+	for _, r := range rules {
+		key := fmt.Sprintf("%s/%d", strings.ToLower(r.Direction), r.Priority)
+		byPriority[key] = append(byPriority[key], r.Name)
+	}
+	for _, r := range rules {
+		key := fmt.Sprintf("%s/%d", strings.ToLower(r.Direction), r.Priority)
+		if names := byPriority[key]; len(names) > 1 {
+			add(SeverityError, r, "priority %d is also used by %s in the %s direction", r.Priority, otherNames(names, r.Name), r.Direction)
+		}
+	}
+
+	// Shadowing only makes sense between rules that parsed cleanly
+	for i, r := range rules {
+		if !valid[i] {
+			continue
+		}
+		for j, s := range rules {
+			if i == j || !valid[j] || s.Priority >= r.Priority || !strings.EqualFold(s.Direction, r.Direction) {
+				continue
+			}
+			if covers(s, r) {
+				if strings.EqualFold(s.Access, r.Access) {
+					add(SeverityWarning, r, "redundant: all its traffic is already matched by higher-priority rule %s", s.Name)
+				} else {
+					verb := "allows"
+					if strings.EqualFold(s.Access, "Deny") {
+						verb = "denies"
+					}
+					add(SeverityWarning, r, "never takes effect: higher-priority rule %s %s all its traffic first", s.Name, verb)
+				}
+				break
+			}
+		}
+	}
+
+	// Internet-wide allows on sensitive ports
+	for i, r := range rules {
+		if !valid[i] || !strings.EqualFold(r.Direction, "Inbound") || !strings.EqualFold(r.Access, "Allow") {
+			continue
+		}
+		if strings.EqualFold(r.Protocol, "Udp") || strings.EqualFold(r.Protocol, "Icmp") {
+			continue
+		}
+		broad := ""
+		for _, src := range r.Sources {
+			if broadSources[strings.ToLower(src)] {
+				broad = src
+				break
+			}
+		}
+		if broad == "" {
+			continue
+		}
+		for _, port := range sortedSensitivePorts() {
+			if portsContain(r.DestinationPort, port) {
+				add(SeverityWarning, r, "allows %s (port %d) from %s; restrict the sources", sensitivePorts[port], port, broad)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity == SeverityError && findings[j].Severity != SeverityError
+	})
+	return findings
+}
+
+// validateRule returns why the rule would be rejected by Azure, if anything
+func validateRule(r Rule) []string {
+	var problems []string
+	if r.Priority < 100 || r.Priority > 4096 {
+		problems = append(problems, fmt.Sprintf("priority %d is outside 100-4096", r.Priority))
+	}
+	if !oneOf(r.Direction, "Inbound", "Outbound") {
+		problems = append(problems, fmt.Sprintf("invalid direction '%s' (must be Inbound or Outbound)", r.Direction))
+	}
+	if !oneOf(r.Access, "Allow", "Deny") {
+		problems = append(problems, fmt.Sprintf("invalid access '%s' (must be Allow or Deny)", r.Access))
+	}
+	if !oneOf(r.Protocol, "Tcp", "Udp", "Icmp", "Esp", "Ah", "*") {
+		problems = append(problems, fmt.Sprintf("invalid protocol '%s' (must be Tcp, Udp, Icmp, Esp, Ah or *)", r.Protocol))
+	}
+	for _, field := range []struct {
+		name  string
+		value []string
+	}{{"source", r.Sources}, {"destination", r.Destination}} {
+		for _, prefix := range field.value {
+			if err := validateAddressPrefix(prefix); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %s '%s': %v", field.name, prefix, err))
+			}
+		}
+		if len(field.value) > 1 && hasServiceTag(field.value) {
+			problems = append(problems, fmt.Sprintf("a service tag can't be combined with other %s prefixes", field.name))
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value []string
+	}{{"source port", r.SourcePort}, {"destination port", r.DestinationPort}} {
+		for _, ports := range field.value {
+			if _, _, err := parsePortRange(ports); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %s '%s': %v", field.name, ports, err))
+			}
+		}
+	}
+	return problems
+}
+
+// validateAddressPrefix accepts "*", an IP address, a CIDR or a service tag
+func validateAddressPrefix(prefix string) error {
+	if prefix == "*" {
+		return nil
+	}
+	if strings.Contains(prefix, "/") {
+		ip, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("not a valid CIDR")
+		}
+		if !ip.Equal(network.IP) {
+			return fmt.Errorf("host bits are set, use %s", network.String())
+		}
+		return nil
+	}
+	if net.ParseIP(prefix) != nil {
+		return nil
+	}
+	if strings.ContainsAny(prefix, ".:") && strings.Trim(prefix, "0123456789.:abcdefABCDEF") == "" {
+		return fmt.Errorf("not a valid IP address")
+	}
+	if !serviceTagPattern.MatchString(prefix) {
+		return fmt.Errorf("not an IP address, CIDR or service tag")
+	}
+	return nil
+}
+
+// parsePortRange parses "*", "N" or "N-M"
+func parsePortRange(ports string) (int, int, error) {
+	if ports == "*" {
+		return 0, 65535, nil
+	}
+	lo, hi, isRange := strings.Cut(ports, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("not a port or port range")
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return 0, 0, fmt.Errorf("not a port or port range")
+		}
+	}
+	if start < 0 || end > 65535 {
+		return 0, 0, fmt.Errorf("ports must be between 0 and 65535")
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("range start is greater than its end")
+	}
+	return start, end, nil
+}
+
+// covers reports whether every packet matched by r is also matched by s
+func covers(s, r Rule) bool {
+	if s.Protocol != "*" && !strings.EqualFold(s.Protocol, r.Protocol) {
+		return false
+	}
+	return addressesCover(s.Sources, r.Sources) &&
+		addressesCover(s.Destination, r.Destination) &&
+		portsCover(s.SourcePort, r.SourcePort) &&
+		portsCover(s.DestinationPort, r.DestinationPort)
+}
+
+// addressesCover reports whether each of inner's prefixes is contained in one of outer's
+func addressesCover(outer, inner []string) bool {
+	for _, in := range inner {
+		covered := false
+		for _, out := range outer {
+			if addressCovers(out, in) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func addressCovers(outer, inner string) bool {
+	if outer == "*" || strings.EqualFold(outer, inner) {
+		return true
+	}
+	_, outerNet, err := parsePrefix(outer)
+	if err != nil {
+		return false
+	}
+	innerIP, innerNet, err := parsePrefix(inner)
+	if err != nil {
+		return false
+	}
+	outerOnes, _ := outerNet.Mask.Size()
+	innerOnes, _ := innerNet.Mask.Size()
+	return outerNet.Contains(innerIP) && outerOnes <= innerOnes
+}
+
+// parsePrefix parses a CIDR or single IP address as a network
+func parsePrefix(prefix string) (net.IP, *net.IPNet, error) {
+	if !strings.Contains(prefix, "/") {
+		ip := net.ParseIP(prefix)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("not an IP address")
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return ip, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	return net.ParseCIDR(prefix)
+}
+
+// portsCover reports whether each of inner's ranges is contained in one of outer's
+func portsCover(outer, inner []string) bool {
+	for _, in := range inner {
+		inStart, inEnd, err := parsePortRange(in)
+		if err != nil {
+			return false
+		}
+		covered := false
+		for _, out := range outer {
+			outStart, outEnd, err := parsePortRange(out)
+			if err == nil && outStart <= inStart && inEnd <= outEnd {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func portsContain(ranges []string, port int) bool {
+	for _, ports := range ranges {
+		start, end, err := parsePortRange(ports)
+		if err == nil && start <= port && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+func hasServiceTag(prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != "*" && !strings.Contains(p, "/") && net.ParseIP(p) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func otherNames(names []string, self string) string {
+	var others []string
+	for _, n := range names {
+		if n != self {
+			others = append(others, n)
+		}
+	}
+	return strings.Join(others, ", ")
+}
+
+func sortedSensitivePorts() []int {
+	ports := make([]int, 0, len(sensitivePorts))
+	for p := range sensitivePorts {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// hasErrors reports whether any finding is an error
+func hasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// findingsFor returns the findings about the named rule
+func findingsFor(findings []Finding, name string) []Finding {
+	var out []Finding
+	for _, f := range findings {
+		if strings.EqualFold(f.Rule, name) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func printFindings(findings []Finding) {
+	tbl := table.New("SEVERITY", "RULE", "FINDING")
+	for _, f := range findings {
+		tbl.AddRow(f.Severity, f.Rule, f.Message)
+	}
+	tbl.Print()
+}
+
+type LintArgs struct {
+	SubscriptionID string
+	ResourceGroup  string
+	NSGName        string
+	File           string // Lint a rules file instead of the live NSG
+}
+
+// LintRules lints a rules file or the rules of a live NSG and prints the findings.
+// It returns an error if any finding is an error.
+func LintRules(args LintArgs) error {
+	var rules []Rule
+	if args.File != "" {
+		file, err := LoadFile(args.File)
+		if err != nil {
+			return err
+		}
+		rules = file.Rules
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return err
+		}
+		live, err := getRules(context.Background(), args.SubscriptionID, args.ResourceGroup, args.NSGName, cred)
+		if err != nil {
+			return err
+		}
+		for _, r := range live {
+			rules = append(rules, r)
+		}
+		sort.Slice(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+	}
+
+	findings := Lint(rules)
+	if len(findings) == 0 {
+		fmt.Printf("No problems found in %d rule(s).\n", len(rules))
+		return nil
+	}
+	printFindings(findings)
+	if hasErrors(findings) {
+		return fmt.Errorf("rule set has errors")
+	}
+	return nil
+}
+
+// checkRules lints the rule set that would result from a change and prints the findings about
+// the changed rules. It returns an error if any of them is an error.
+func checkRules(rules []Rule, changed ...string) error {
+	findings := Lint(rules)
+	var relevant []Finding
+	for _, name := range changed {
+		relevant = append(relevant, findingsFor(findings, name)...)
+	}
+	if len(relevant) == 0 {
+		return nil
+	}
+	printFindings(relevant)
+	if hasErrors(relevant) {
+		return fmt.Errorf("rule validation failed")
+	}
+	return nil
+}
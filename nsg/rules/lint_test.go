@@ -0,0 +1,210 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func rule(name string, priority int32, access, protocol string, sources, destPorts []string) Rule {
+	r := Rule{
+		Name:            name,
+		Priority:        priority,
+		Direction:       "Inbound",
+		Access:          access,
+		Protocol:        protocol,
+		Sources:         sources,
+		DestinationPort: destPorts,
+	}
+	r.normalize()
+	return r
+}
+
+func findingMessages(findings []Finding, name string) []string {
+	var out []string
+	for _, f := range findingsFor(findings, name) {
+		out = append(out, f.Severity+": "+f.Message)
+	}
+	return out
+}
+
+func hasFinding(findings []Finding, name, severity, substr string) bool {
+	for _, f := range findingsFor(findings, name) {
+		if f.Severity == severity && strings.Contains(f.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLintClean(t *testing.T) {
+	rules := []Rule{
+		rule("allow-https", 200, "Allow", "Tcp", []string{"Internet"}, []string{"443"}),
+		rule("allow-office-ssh", 210, "Allow", "Tcp", []string{"203.0.113.0/24"}, []string{"22"}),
+		rule("deny-all", 4000, "Deny", "*", []string{"10.1.0.0/16"}, []string{"*"}),
+	}
+	if findings := Lint(rules); len(findings) != 0 {
+		t.Fatalf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestLintDuplicatePriority(t *testing.T) {
+	rules := []Rule{
+		rule("a", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"80"}),
+		rule("b", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"443"}),
+	}
+	outbound := rule("c", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"443"})
+	outbound.Direction = "Outbound"
+	rules = append(rules, outbound)
+
+	findings := Lint(rules)
+	if !hasFinding(findings, "a", SeverityError, "also used by b") {
+		t.Errorf("expected duplicate priority error for a, got %v", findingMessages(findings, "a"))
+	}
+	if !hasFinding(findings, "b", SeverityError, "also used by a") {
+		t.Errorf("expected duplicate priority error for b, got %v", findingMessages(findings, "b"))
+	}
+	if msgs := findingMessages(findings, "c"); len(msgs) != 0 {
+		t.Errorf("outbound rule shouldn't collide with inbound rules, got %v", msgs)
+	}
+}
+
+func TestLintInvalidFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *Rule)
+		substr string
+	}{
+		{"bad cidr", func(r *Rule) { r.Sources = []string{"10.0.0.0/33"} }, "invalid source '10.0.0.0/33'"},
+		{"host bits", func(r *Rule) { r.Sources = []string{"10.0.0.1/24"} }, "use 10.0.0.0/24"},
+		{"bad ip", func(r *Rule) { r.Destination = []string{"10.0.0.300"} }, "not a valid IP address"},
+		{"bad tag", func(r *Rule) { r.Sources = []string{"not a tag"} }, "not an IP address, CIDR or service tag"},
+		{"tag with cidr", func(r *Rule) { r.Sources = []string{"10.0.0.0/8", "Internet"} }, "service tag can't be combined"},
+		{"port too high", func(r *Rule) { r.DestinationPort = []string{"70000"} }, "between 0 and 65535"},
+		{"reversed range", func(r *Rule) { r.DestinationPort = []string{"90-80"} }, "start is greater"},
+		{"not a port", func(r *Rule) { r.SourcePort = []string{"http"} }, "invalid source port 'http'"},
+		{"priority", func(r *Rule) { r.Priority = 50 }, "outside 100-4096"},
+		{"direction", func(r *Rule) { r.Direction = "Sideways" }, "invalid direction"},
+		{"access", func(r *Rule) { r.Access = "Maybe" }, "invalid access"},
+		{"protocol", func(r *Rule) { r.Protocol = "Sctp" }, "invalid protocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rule("r", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"80-90"})
+			tt.modify(&r)
+			findings := Lint([]Rule{r})
+			if !hasFinding(findings, "r", SeverityError, tt.substr) {
+				t.Errorf("expected error containing %q, got %v", tt.substr, findingMessages(findings, "r"))
+			}
+		})
+	}
+}
+
+func TestLintValidPrefixes(t *testing.T) {
+	for _, prefix := range []string{"*", "10.0.0.1", "10.0.0.0/8", "fd00::/48", "2001:db8::1", "Internet", "AzureLoadBalancer", "Storage.WestUS"} {
+		if err := validateAddressPrefix(prefix); err != nil {
+			t.Errorf("%s: unexpected error %v", prefix, err)
+		}
+	}
+}
+
+func TestLintShadowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		higher   Rule
+		lower    Rule
+		shadowed string // expected message fragment, empty if the lower rule isn't shadowed
+	}{
+		{
+			name:     "deny all hides allow",
+			higher:   rule("deny-all", 100, "Deny", "*", []string{"*"}, []string{"*"}),
+			lower:    rule("allow-web", 200, "Allow", "Tcp", []string{"Internet"}, []string{"443"}),
+			shadowed: "never takes effect: higher-priority rule deny-all denies",
+		},
+		{
+			name:     "wider allow makes allow redundant",
+			higher:   rule("allow-vnet", 100, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"1000-2000"}),
+			lower:    rule("allow-subnet", 200, "Allow", "Tcp", []string{"10.1.2.0/24", "10.3.0.5"}, []string{"1500", "1600-1700"}),
+			shadowed: "redundant",
+		},
+		{
+			name:   "narrower source",
+			higher: rule("deny-subnet", 100, "Deny", "*", []string{"10.1.0.0/16"}, []string{"*"}),
+			lower:  rule("allow-vnet", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"443"}),
+		},
+		{
+			name:   "partial port overlap",
+			higher: rule("deny-low", 100, "Deny", "Tcp", []string{"*"}, []string{"0-1000"}),
+			lower:  rule("allow-range", 200, "Allow", "Tcp", []string{"*"}, []string{"900-1100"}),
+		},
+		{
+			name:   "different protocol",
+			higher: rule("deny-udp", 100, "Deny", "Udp", []string{"*"}, []string{"*"}),
+			lower:  rule("allow-tcp", 200, "Allow", "Tcp", []string{"10.0.0.0/8"}, []string{"80"}),
+		},
+		{
+			name:   "different service tag",
+			higher: rule("deny-lb", 100, "Deny", "*", []string{"AzureLoadBalancer"}, []string{"*"}),
+			lower:  rule("allow-internet", 200, "Allow", "Tcp", []string{"Internet"}, []string{"80"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := Lint([]Rule{tt.higher, tt.lower})
+			if tt.shadowed == "" {
+				if msgs := findingMessages(findings, tt.lower.Name); len(msgs) != 0 {
+					t.Errorf("expected no findings, got %v", msgs)
+				}
+				return
+			}
+			if !hasFinding(findings, tt.lower.Name, SeverityWarning, tt.shadowed) {
+				t.Errorf("expected warning containing %q, got %v", tt.shadowed, findingMessages(findings, tt.lower.Name))
+			}
+			if msgs := findingMessages(findings, tt.higher.Name); len(msgs) != 0 {
+				t.Errorf("higher-priority rule shouldn't be flagged, got %v", msgs)
+			}
+		})
+	}
+}
+
+func TestLintSensitivePorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		ports []string
+	}{
+		{"ssh from anywhere", rule("r", 200, "Allow", "Tcp", []string{"*"}, []string{"22"}), []string{"SSH"}},
+		{"api from internet", rule("r", 200, "Allow", "*", []string{"Internet"}, []string{"6000-7000"}), []string{"Kubernetes API"}},
+		{"everything", rule("r", 200, "Allow", "Tcp", []string{"0.0.0.0/0"}, []string{"*"}), []string{"SSH", "etcd", "Kubernetes API"}},
+		{"scoped source", rule("r", 200, "Allow", "Tcp", []string{"203.0.113.7"}, []string{"22"}), nil},
+		{"deny", rule("r", 200, "Deny", "Tcp", []string{"*"}, []string{"22"}), nil},
+		{"udp", rule("r", 200, "Allow", "Udp", []string{"*"}, []string{"2379"}), nil},
+		{"other port", rule("r", 200, "Allow", "Tcp", []string{"*"}, []string{"443"}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := Lint([]Rule{tt.rule})
+			if len(findings) != len(tt.ports) {
+				t.Fatalf("expected %d findings, got %v", len(tt.ports), findingMessages(findings, "r"))
+			}
+			for _, port := range tt.ports {
+				if !hasFinding(findings, "r", SeverityWarning, "allows "+port) {
+					t.Errorf("expected warning for %s, got %v", port, findingMessages(findings, "r"))
+				}
+			}
+		})
+	}
+}
+
+func TestLintErrorsSortFirst(t *testing.T) {
+	rules := []Rule{
+		rule("open-ssh", 200, "Allow", "Tcp", []string{"*"}, []string{"22"}),
+		rule("bad", 300, "Allow", "Tcp", []string{"10.0.0.0/40"}, []string{"80"}),
+	}
+	findings := Lint(rules)
+	if len(findings) != 2 || findings[0].Severity != SeverityError {
+		t.Fatalf("expected the error first, got %+v", findings)
+	}
+	if !hasErrors(findings) {
+		t.Error("hasErrors should report the error")
+	}
+}
@@ -0,0 +1,198 @@
+// Package cidr validates and carves the IPv4 and IPv6 ranges used by k3a clusters.
+package cidr
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PodCIDR is the cluster pod network configured by kubeadm and flannel
+	PodCIDR = "16.0.0.0/5"
+	// ServiceCIDR is the cluster service network configured by kubeadm
+	ServiceCIDR = "172.20.0.0/16"
+
+	// VnetIPv6AddressSpace is the unique local range added to k3a-vnet for dual-stack clusters
+	VnetIPv6AddressSpace = "fd00:10::/48"
+	// PodCIDRv6 is the IPv6 pod network of dual-stack clusters, split into a /64 per node
+	PodCIDRv6 = "fd00:100::/48"
+	// ServiceCIDRv6 is the IPv6 service network of dual-stack clusters
+	ServiceCIDRv6 = "fd00:200::/108"
+	// NodeCIDRMaskSizeIPv6 is the size of each node's IPv6 pod range
+	NodeCIDRMaskSizeIPv6 = 64
+
+	maxBlocks = 1 << 20
+)
+
+// Range is a named CIDR used in overlap error messages
+type Range struct {
+	Name string
+	CIDR string
+}
+
+// Overlaps reports whether two CIDRs share any address
+func Overlaps(a, b string) (bool, error) {
+	_, netA, err := net.ParseCIDR(a)
+	if err != nil {
+		return false, fmt.Errorf("invalid CIDR '%s': %w", a, err)
+	}
+	_, netB, err := net.ParseCIDR(b)
+	if err != nil {
+		return false, fmt.Errorf("invalid CIDR '%s': %w", b, err)
+	}
+	return netA.Contains(netB.IP) || netB.Contains(netA.IP), nil
+}
+
+// ValidateNoOverlap returns an error naming the first pair of ranges that overlap
+func ValidateNoOverlap(ranges []Range) error {
+	for i := 0; i < len(ranges); i++ {
+		for j := i + 1; j < len(ranges); j++ {
+			overlap, err := Overlaps(ranges[i].CIDR, ranges[j].CIDR)
+			if err != nil {
+				return err
+			}
+			if overlap {
+				return fmt.Errorf("%s %s overlaps %s %s", ranges[i].Name, ranges[i].CIDR, ranges[j].Name, ranges[j].CIDR)
+			}
+		}
+	}
+	return nil
+}
+
+// NextFree returns the first /prefixLen block inside space that doesn't overlap any of the used CIDRs
+func NextFree(space string, prefixLen int, used []string) (string, error) {
+	_, spaceNet, err := net.ParseCIDR(space)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR '%s': %w", space, err)
+	}
+	spaceLen, bits := spaceNet.Mask.Size()
+	if prefixLen < spaceLen || prefixLen > bits {
+		return "", fmt.Errorf("a /%d block does not fit in %s", prefixLen, space)
+	}
+	ipLen := net.IPv4len
+	if bits == 128 {
+		ipLen = net.IPv6len
+	}
+
+	// Large IPv6 spaces hold more blocks than are worth scanning; the first free one is found long before the cap
+	blocks := maxBlocks
+	if prefixLen-spaceLen < 20 {
+		blocks = 1 << uint(prefixLen-spaceLen)
+	}
+	start := new(big.Int).SetBytes(spaceNet.IP)
+	step := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLen))
+	for i := 0; i < blocks; i++ {
+		addr := new(big.Int).Add(start, new(big.Int).Mul(step, big.NewInt(int64(i))))
+		ip := make(net.IP, ipLen)
+		addr.FillBytes(ip)
+		candidate := fmt.Sprintf("%s/%d", ip.String(), prefixLen)
+
+		free := true
+		for _, u := range used {
+			if IsIPv6(u) != (bits == 128) {
+				continue
+			}
+			overlap, err := Overlaps(candidate, u)
+			if err != nil {
+				return "", err
+			}
+			if overlap {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free /%d block left in %s", prefixLen, space)
+}
+
+// IsIPv6 reports whether a CIDR is an IPv6 range
+func IsIPv6(c string) bool {
+	return strings.Contains(c, ":")
+}
+
+// PrefixLen returns the prefix length of a CIDR
+func PrefixLen(c string) (int, error) {
+	_, n, err := net.ParseCIDR(c)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CIDR '%s': %w", c, err)
+	}
+	ones, _ := n.Mask.Size()
+	return ones, nil
+}
+
+// Contains reports whether inner lies entirely within outer
+func Contains(outer, inner string) (bool, error) {
+	_, outerNet, err := net.ParseCIDR(outer)
+	if err != nil {
+		return false, fmt.Errorf("invalid CIDR '%s': %w", outer, err)
+	}
+	_, innerNet, err := net.ParseCIDR(inner)
+	if err != nil {
+		return false, fmt.Errorf("invalid CIDR '%s': %w", inner, err)
+	}
+	outerLen, _ := outerNet.Mask.Size()
+	innerLen, _ := innerNet.Mask.Size()
+	return outerLen <= innerLen && outerNet.Contains(innerNet.IP), nil
+}
+
+// Allocate picks a block for request from the address spaces, avoiding the used CIDRs. The request is
+// either a prefix length such as "/22", which takes the first free block, or an explicit CIDR that
+// must fit inside one of the spaces without overlapping anything in use.
+func Allocate(spaces []string, request string, used []string) (string, error) {
+	if strings.HasPrefix(request, "/") {
+		prefixLen, err := strconv.Atoi(strings.TrimPrefix(request, "/"))
+		if err != nil {
+			return "", fmt.Errorf("invalid prefix length '%s'", request)
+		}
+		var lastErr error
+		for _, space := range spaces {
+			block, err := NextFree(space, prefixLen, used)
+			if err == nil {
+				return block, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no address space to allocate from")
+		}
+		return "", lastErr
+	}
+
+	_, requested, err := net.ParseCIDR(request)
+	if err != nil {
+		return "", fmt.Errorf("invalid CIDR '%s': %w", request, err)
+	}
+	if requested.String() != request {
+		return "", fmt.Errorf("'%s' is not a network address, did you mean '%s'?", request, requested.String())
+	}
+	inSpace := false
+	for _, space := range spaces {
+		ok, err := Contains(space, request)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			inSpace = true
+			break
+		}
+	}
+	if !inSpace {
+		return "", fmt.Errorf("%s is outside the address space %s", request, strings.Join(spaces, ", "))
+	}
+	for _, u := range used {
+		overlap, err := Overlaps(request, u)
+		if err != nil {
+			return "", err
+		}
+		if overlap {
+			return "", fmt.Errorf("%s overlaps %s, which is already in use", request, u)
+		}
+	}
+	return request, nil
+}
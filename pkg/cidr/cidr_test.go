@@ -0,0 +1,119 @@
+package cidr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    bool
+		wantErr bool
+	}{
+		{a: "10.0.0.0/16", b: "10.0.1.0/24", want: true},
+		{a: "10.0.1.0/24", b: "10.0.0.0/16", want: true},
+		{a: "10.0.0.0/24", b: "10.0.1.0/24", want: false},
+		{a: "10.0.0.0/24", b: "10.0.0.0/24", want: true},
+		{a: "16.0.0.0/5", b: "20.1.0.0/16", want: true},
+		{a: "172.20.0.0/16", b: "172.21.0.0/16", want: false},
+		{a: "fd00:10::/48", b: "fd00:10:0:1::/64", want: true},
+		{a: "fd00:10::/48", b: "fd00:100::/48", want: false},
+		{a: "10.0.0.0/8", b: "fd00:10::/48", want: false},
+		{a: "10.0.0.0", b: "10.0.0.0/8", wantErr: true},
+		{a: "10.0.0.0/8", b: "not-a-cidr", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Overlaps(tt.a, tt.b)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Overlaps(%s, %s) error = %v, wantErr %v", tt.a, tt.b, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Overlaps(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNextFree(t *testing.T) {
+	tests := []struct {
+		name      string
+		space     string
+		prefixLen int
+		used      []string
+		want      string
+		wantErr   string
+	}{
+		{name: "empty space", space: "10.0.0.0/8", prefixLen: 16, want: "10.0.0.0/16"},
+		{name: "skips used block", space: "10.0.0.0/8", prefixLen: 16, used: []string{"10.0.0.0/16"}, want: "10.1.0.0/16"},
+		{name: "skips partly used block", space: "10.1.0.0/16", prefixLen: 22, used: []string{"10.1.0.0/24", "10.1.5.0/24"}, want: "10.1.8.0/22"},
+		{name: "skips block inside larger used range", space: "10.0.0.0/8", prefixLen: 24, used: []string{"10.0.0.0/15"}, want: "10.2.0.0/24"},
+		{name: "whole space", space: "192.168.0.0/24", prefixLen: 24, want: "192.168.0.0/24"},
+		{name: "ignores other family", space: "10.0.0.0/16", prefixLen: 24, used: []string{"fd00:10::/48"}, want: "10.0.0.0/24"},
+		{name: "ipv6", space: "fd00:10::/48", prefixLen: 64, used: []string{"fd00:10::/64", "10.0.0.0/8"}, want: "fd00:10:0:1::/64"},
+		{name: "large ipv6 space", space: "fd00::/8", prefixLen: 64, want: "fd00::/64"},
+		{name: "full", space: "10.0.0.0/24", prefixLen: 25, used: []string{"10.0.0.0/25", "10.0.0.128/25"}, wantErr: "no free /25 block left"},
+		{name: "block larger than space", space: "10.0.0.0/16", prefixLen: 8, wantErr: "does not fit"},
+		{name: "block longer than address", space: "10.0.0.0/16", prefixLen: 33, wantErr: "does not fit"},
+		{name: "invalid space", space: "10.0.0.0", prefixLen: 16, wantErr: "invalid CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextFree(tt.space, tt.prefixLen, tt.used)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NextFree() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextFree() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NextFree() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	spaces := []string{"10.1.0.0/16", "10.2.0.0/16"}
+	tests := []struct {
+		name    string
+		spaces  []string
+		request string
+		used    []string
+		want    string
+		wantErr string
+	}{
+		{name: "prefix length", spaces: spaces, request: "/22", used: []string{"10.1.0.0/20"}, want: "10.1.16.0/22"},
+		{name: "prefix length falls through to next space", spaces: spaces, request: "/16", used: []string{"10.1.0.0/24"}, want: "10.2.0.0/16"},
+		{name: "prefix length with no room", spaces: spaces, request: "/16", used: spaces, wantErr: "no free /16 block left"},
+		{name: "prefix length without spaces", request: "/24", wantErr: "no address space"},
+		{name: "invalid prefix length", spaces: spaces, request: "/x", wantErr: "invalid prefix length"},
+		{name: "explicit cidr", spaces: spaces, request: "10.2.4.0/22", used: []string{"10.1.0.0/16"}, want: "10.2.4.0/22"},
+		{name: "explicit ipv6 cidr", spaces: []string{"fd00:10::/48"}, request: "fd00:10:0:2::/64", used: []string{"fd00:10::/64"}, want: "fd00:10:0:2::/64"},
+		{name: "explicit cidr overlapping used", spaces: spaces, request: "10.1.0.0/22", used: []string{"10.1.2.0/24"}, wantErr: "overlaps 10.1.2.0/24"},
+		{name: "explicit cidr outside spaces", spaces: spaces, request: "10.3.0.0/24", wantErr: "outside the address space"},
+		{name: "explicit cidr larger than space", spaces: spaces, request: "10.0.0.0/15", wantErr: "outside the address space"},
+		{name: "host address", spaces: spaces, request: "10.1.0.5/24", wantErr: "did you mean '10.1.0.0/24'"},
+		{name: "invalid cidr", spaces: spaces, request: "10.1.0.0", wantErr: "invalid CIDR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allocate(tt.spaces, tt.request, tt.used)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Allocate() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Allocate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package clusternet holds what cluster create records about a cluster's network and pools read back:
+// the resource group tags, and helpers for the subnets they point at.
+package clusternet
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+)
+
+// Resource group tags written by cluster create
+const (
+	// SubnetIDTag holds the ID of the node subnet; clusters created before it always use k3a-vnet/default
+	SubnetIDTag = "k3a-subnet-id"
+	// IPFamilyTag holds the cluster's IP family, IPFamilyIPv4 or IPFamilyDual
+	IPFamilyTag = "k3a-ip-family"
+	// EgressTag, OutboundIPsTag and SNATPortsTag record how nodes reach the internet
+	EgressTag      = "k3a-egress"
+	OutboundIPsTag = "k3a-outbound-ips"
+	SNATPortsTag   = "k3a-snat-ports"
+	// PrivateTag is "true" for private clusters, whose API server DNS name is in APIServerNameTag
+	PrivateTag       = "k3a-private"
+	APIServerNameTag = "k3a-api-server-name"
+)
+
+// NodeSubnetName is the node subnet cluster create adds to an existing VNet given with --vnet-id. A distinct
+// name keeps it from taking over a subnet the VNet already had, like the portal's "default".
+const NodeSubnetName = "k3a-nodes"
+
+// PoolSubnetTag is the VMSS tag holding the ID of a subnet created for a pool, removed with the pool
+const PoolSubnetTag = "k3a-pool-subnet-id"
+
+// IP families accepted by cluster create
+const (
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyDual = "dual"
+)
+
+// Egress modes accepted by cluster create and recorded in EgressTag
+const (
+	EgressLoadBalancer = "loadbalancer"
+	EgressNATGateway   = "nat-gateway"
+)
+
+const (
+	// NATGatewayName is the NAT gateway cluster create attaches to the node subnet for EgressNATGateway
+	NATGatewayName = "k3a-natgw"
+	// PortsPerFrontendIP is the number of SNAT ports an outbound rule can hand out per frontend IP
+	PortsPerFrontendIP = 64000
+	// OutboundFrontendIPv6 names the first IPv6 outbound frontend of a dual-stack cluster; the others add -2, -3, ...
+	OutboundFrontendIPv6 = "outbound-frontend-ipv6"
+)
+
+// ServiceResourcePrefix starts the names of the load balancer frontends, rules, public IPs and NSG rules
+// that the LoadBalancer controller creates for Services
+const ServiceResourcePrefix = "k3a-svc-"
+
+// Inbound IPv6 on a dual-stack public cluster's load balancer. The API server and SSH get their own
+// frontend and NAT pool since a rule can't mix IP versions.
+const (
+	// APIFrontendIPv6 is the frontend holding the IPv6 public IP, whose DNS label is the cluster name plus DNSLabelIPv6Suffix
+	APIFrontendIPv6    = "LoadBalancerFrontendIPv6"
+	DNSLabelIPv6Suffix = "-ipv6"
+	// SSHNATPoolIPv6 maps the same frontend ports as the IPv4 "ssh" NAT pool to port 22 over IPv6
+	SSHNATPoolIPv6 = "ssh-ipv6"
+)
+
+// NATGatewayID returns the ID of the cluster's NAT gateway
+func NATGatewayID(subscriptionID, cluster string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/natGateways/%s", subscriptionID, cluster, NATGatewayName)
+}
+
+// SubnetPrefixes returns every address prefix of a subnet; dual-stack subnets use AddressPrefixes instead of AddressPrefix
+func SubnetPrefixes(props *armnetwork.SubnetPropertiesFormat) []string {
+	if props == nil {
+		return nil
+	}
+	var prefixes []string
+	if props.AddressPrefix != nil {
+		prefixes = append(prefixes, *props.AddressPrefix)
+	}
+	for _, prefix := range props.AddressPrefixes {
+		if prefix != nil {
+			prefixes = append(prefixes, *prefix)
+		}
+	}
+	return prefixes
+}
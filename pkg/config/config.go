@@ -0,0 +1,152 @@
+// Package config reads and writes the k3a config file, ~/.k3a/config.yaml, which holds named
+// contexts of default settings.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys are the settings a context can hold, in the order they are listed
+var Keys = []string{"subscription", "tenant", "cluster", "region", "sku", "ssh-key", "ssh-private-key"}
+
+// Context holds default settings for commands run while it is current
+type Context struct {
+	Subscription  string `yaml:"subscription,omitempty"`
+	Tenant        string `yaml:"tenant,omitempty"`
+	Cluster       string `yaml:"cluster,omitempty"`
+	Region        string `yaml:"region,omitempty"`
+	SKU           string `yaml:"sku,omitempty"`
+	SSHKey        string `yaml:"ssh-key,omitempty"`         // SSH public key path for new VMs
+	SSHPrivateKey string `yaml:"ssh-private-key,omitempty"` // SSH private key path used to reach nodes
+}
+
+// Config is the contents of the config file
+type Config struct {
+	CurrentContext string              `yaml:"current-context,omitempty"`
+	Contexts       map[string]*Context `yaml:"contexts,omitempty"`
+}
+
+// Path returns the location of the config file
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".k3a", "config.yaml"), nil
+}
+
+// Load reads the config file. A missing file is an empty config.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Save writes the config file, readable only by the current user
+func (c *Config) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := c.YAML()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// YAML returns the config as it is stored in the config file
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Current returns the current context, or nil when none is set
+func (c *Config) Current() *Context {
+	if c.CurrentContext == "" {
+		return nil
+	}
+	return c.Contexts[c.CurrentContext]
+}
+
+// Get returns a setting by key. Paths starting with ~/ are expanded.
+func (ctx *Context) Get(key string) (string, error) {
+	if ctx == nil {
+		return "", nil
+	}
+	field, err := ctx.field(key)
+	if err != nil {
+		return "", err
+	}
+	value := *field
+	if (key == "ssh-key" || key == "ssh-private-key") && strings.HasPrefix(value, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			value = filepath.Join(home, value[2:])
+		}
+	}
+	return value, nil
+}
+
+// Set changes a setting by key; an empty value unsets it
+func (ctx *Context) Set(key, value string) error {
+	field, err := ctx.field(key)
+	if err != nil {
+		return err
+	}
+	*field = value
+	return nil
+}
+
+func (ctx *Context) field(key string) (*string, error) {
+	switch key {
+	case "subscription":
+		return &ctx.Subscription, nil
+	case "tenant":
+		return &ctx.Tenant, nil
+	case "cluster":
+		return &ctx.Cluster, nil
+	case "region":
+		return &ctx.Region, nil
+	case "sku":
+		return &ctx.SKU, nil
+	case "ssh-key":
+		return &ctx.SSHKey, nil
+	case "ssh-private-key":
+		return &ctx.SSHPrivateKey, nil
+	}
+	return nil, fmt.Errorf("unknown setting '%s' (must be one of: %s)", key, strings.Join(Keys, ", "))
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KeyVaultName returns the name of the Key Vault holding the cluster's secrets
+func KeyVaultName(cluster string) string {
+	return fmt.Sprintf("k3akv%s", kstrings.UniqueString(cluster))
+}
+
+// GetKubeconfig downloads the cluster's admin kubeconfig from its Key Vault
+func GetKubeconfig(ctx context.Context, cluster string, cred *azidentity.DefaultAzureCredential) ([]byte, error) {
+	secretName := fmt.Sprintf("%s-kubeconfig", cluster)
+	vaultURL := fmt.Sprintf("https://%s.vault.azure.net/", KeyVaultName(cluster))
+	client, err := azsecrets.NewClient(vaultURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+	resp, err := client.GetSecret(ctx, secretName, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret '%s' from Key Vault: %w", secretName, err)
+	}
+	if resp.Value == nil {
+		return nil, fmt.Errorf("secret '%s' has no value", secretName)
+	}
+	return []byte(*resp.Value), nil
+}
+
+// NewClient returns a Kubernetes client for the cluster. Inside a pod it uses the pod's service
+// account, otherwise the admin kubeconfig from the cluster's Key Vault.
+func NewClient(ctx context.Context, cluster string, cred *azidentity.DefaultAzureCredential) (kubernetes.Interface, *rest.Config, error) {
+	var config *rest.Config
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		c, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+		}
+		config = c
+	} else {
+		kubeconfig, err := GetKubeconfig(ctx, cluster, cred)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+		}
+		config = c
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return client, config, nil
+}
@@ -0,0 +1,139 @@
+// Package protect guards clusters and pools against deletion with a k3a-protected tag and,
+// optionally, an Azure CanNotDelete management lock.
+package protect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armlocks"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+)
+
+const (
+	// Tag marks a resource group or VMSS that k3a refuses to delete
+	Tag = "k3a-protected"
+	// LockName is the management lock created by Set with lock enabled
+	LockName = "k3a-protected"
+
+	lockSegment = "/providers/microsoft.authorization/locks/"
+)
+
+// ResourceGroupID returns the resource ID of a resource group, used as the scope of its tags and locks
+func ResourceGroupID(subscriptionID, resourceGroup string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", subscriptionID, resourceGroup)
+}
+
+// Protected reports whether tags carry k3a-protected=true
+func Protected(tags map[string]*string) bool {
+	v, ok := tags[Tag]
+	return ok && v != nil && strings.EqualFold(*v, "true")
+}
+
+// Set tags the resource at scope as protected and, with lock, adds a CanNotDelete lock on it
+func Set(ctx context.Context, subscriptionID, scope string, lock bool, cred *azidentity.DefaultAzureCredential) error {
+	tagsClient, err := armresources.NewTagsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create tags client: %w", err)
+	}
+	if _, err := tagsClient.UpdateAtScope(ctx, scope, armresources.TagsPatchResource{
+		Operation:  to.Ptr(armresources.TagsPatchOperationMerge),
+		Properties: &armresources.Tags{Tags: map[string]*string{Tag: to.Ptr("true")}},
+	}, nil); err != nil {
+		return fmt.Errorf("failed to set %s tag: %w", Tag, err)
+	}
+	if !lock {
+		return nil
+	}
+	locksClient, err := armlocks.NewManagementLocksClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create management locks client: %w", err)
+	}
+	if _, err := locksClient.CreateOrUpdateByScope(ctx, scope, LockName, armlocks.ManagementLockObject{
+		Properties: &armlocks.ManagementLockProperties{
+			Level: to.Ptr(armlocks.LockLevelCanNotDelete),
+			Notes: to.Ptr("Created by k3a. Remove with 'k3a cluster unprotect' or 'k3a pool unprotect'."),
+		},
+	}, nil); err != nil {
+		return fmt.Errorf("failed to create lock '%s': %w", LockName, err)
+	}
+	return nil
+}
+
+// Clear removes the protection tag and the k3a lock from the resource at scope. Other locks are left alone.
+func Clear(ctx context.Context, subscriptionID, scope string, cred *azidentity.DefaultAzureCredential) error {
+	tagsClient, err := armresources.NewTagsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create tags client: %w", err)
+	}
+	current, err := tagsClient.GetAtScope(ctx, scope, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get tags: %w", err)
+	}
+	if current.Properties != nil {
+		if v, ok := current.Properties.Tags[Tag]; ok {
+			if _, err := tagsClient.UpdateAtScope(ctx, scope, armresources.TagsPatchResource{
+				Operation:  to.Ptr(armresources.TagsPatchOperationDelete),
+				Properties: &armresources.Tags{Tags: map[string]*string{Tag: v}},
+			}, nil); err != nil {
+				return fmt.Errorf("failed to remove %s tag: %w", Tag, err)
+			}
+		}
+	}
+	locksClient, err := armlocks.NewManagementLocksClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create management locks client: %w", err)
+	}
+	if _, err := locksClient.DeleteByScope(ctx, scope, LockName, nil); err != nil {
+		return fmt.Errorf("failed to delete lock '%s': %w", LockName, err)
+	}
+	return nil
+}
+
+// Check returns an error when the resource at scope is tagged as protected or when a management lock
+// in its resource group would block deleting it: a lock on the resource or a parent scope, or on a
+// resource below it. kind is the k3a command group ("cluster" or "pool") that manages the protection.
+func Check(ctx context.Context, subscriptionID, resourceGroup, scope, kind string, tags map[string]*string, cred *azidentity.DefaultAzureCredential) error {
+	if Protected(tags) {
+		return fmt.Errorf("%s '%s' is protected by the %s=true tag; remove it with 'k3a %s unprotect' first", kind, scopeName(scope), Tag, kind)
+	}
+	locksClient, err := armlocks.NewManagementLocksClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create management locks client: %w", err)
+	}
+	target := strings.ToLower(scope) + "/"
+	var blocking []string
+	pager := locksClient.NewListAtResourceGroupLevelPager(resourceGroup, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list management locks: %w", err)
+		}
+		for _, lock := range page.Value {
+			if lock.ID == nil || lock.Name == nil {
+				continue
+			}
+			id := strings.ToLower(*lock.ID)
+			i := strings.LastIndex(id, lockSegment)
+			if i < 0 {
+				continue
+			}
+			lockScope := id[:i] + "/"
+			if strings.HasPrefix(target, lockScope) || strings.HasPrefix(lockScope, target) {
+				blocking = append(blocking, fmt.Sprintf("%s on %s", *lock.Name, scopeName(id[:i])))
+			}
+		}
+	}
+	if len(blocking) > 0 {
+		return fmt.Errorf("'%s' cannot be deleted while management locks exist: %s", scopeName(scope), strings.Join(blocking, ", "))
+	}
+	return nil
+}
+
+// scopeName returns the last segment of a resource ID
+func scopeName(scope string) string {
+	return scope[strings.LastIndex(scope, "/")+1:]
+}
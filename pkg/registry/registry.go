@@ -0,0 +1,203 @@
+// Package registry records how a cluster and its pools were created in an Azure Table in the
+// cluster storage account.
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+	"github.com/jwilder/k3a/pkg/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+const tableName = "k3a"
+
+// Record kinds, used as the table partition key
+const (
+	KindCluster = "cluster"
+	KindPool    = "pool"
+)
+
+// Record describes how a cluster or pool was created
+type Record struct {
+	Kind              string    `json:"PartitionKey"`
+	Name              string    `json:"RowKey"`
+	Args              string    // Create arguments as JSON
+	K8sVersion        string    `json:",omitempty"`
+	SSHKeyFingerprint string    `json:",omitempty"`
+	K3aVersion        string    // Version of k3a that wrote the record
+	CreatedBy         string    // Azure principal that ran the create
+	CreatedAt         time.Time // First create
+	UpdatedAt         time.Time // Last create or update
+}
+
+// Put writes a record with args stored as JSON. Re-running a create keeps the original creator and time.
+func Put(ctx context.Context, subscriptionID, cluster string, r Record, args any, cred *azidentity.DefaultAzureCredential) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s arguments: %w", r.Kind, err)
+	}
+	r.Args = string(data)
+
+	client, err := newClient(cluster, cred)
+	if err != nil {
+		return err
+	}
+	if _, err := client.CreateTable(ctx, nil); err != nil && !hasErrorCode(err, aztables.TableAlreadyExists) {
+		return fmt.Errorf("failed to create table '%s': %w", tableName, err)
+	}
+
+	now := time.Now().UTC()
+	r.K3aVersion = k3aVersion()
+	r.CreatedBy = principal(ctx, cred)
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	if existing, err := client.GetEntity(ctx, r.Kind, r.Name, nil); err == nil {
+		var previous Record
+		if json.Unmarshal(existing.Value, &previous) == nil && !previous.CreatedAt.IsZero() {
+			r.CreatedBy = previous.CreatedBy
+			r.CreatedAt = previous.CreatedAt
+		}
+	}
+
+	entity, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := client.UpsertEntity(ctx, entity, &aztables.UpsertEntityOptions{UpdateMode: aztables.UpdateModeReplace}); err != nil {
+		return fmt.Errorf("failed to write %s record '%s': %w", r.Kind, r.Name, err)
+	}
+	return nil
+}
+
+// Delete removes a record, ignoring records that don't exist
+func Delete(ctx context.Context, subscriptionID, cluster, kind, name string, cred *azidentity.DefaultAzureCredential) error {
+	client, err := newClient(cluster, cred)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteEntity(ctx, kind, name, nil); err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete %s record '%s': %w", kind, name, err)
+	}
+	return nil
+}
+
+// List returns the cluster's records, cluster first and then pools by name
+func List(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) ([]Record, error) {
+	client, err := newClient(cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	pager := client.NewListEntitiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if isNotFound(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table '%s': %w", tableName, err)
+		}
+		for _, entity := range page.Entities {
+			var r Record
+			if err := json.Unmarshal(entity, &r); err != nil {
+				return nil, fmt.Errorf("invalid record in table '%s': %w", tableName, err)
+			}
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Kind != records[j].Kind {
+			return records[i].Kind == KindCluster
+		}
+		return records[i].Name < records[j].Name
+	})
+	return records, nil
+}
+
+// SSHKeyFingerprint returns the SHA256 fingerprint of an authorized_keys formatted public key
+func SSHKeyFingerprint(publicKey string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// newClient returns a client for the registry table. It authenticates with the caller's token, which
+// needs the Storage Table Data Contributor role on the cluster storage account.
+func newClient(cluster string, cred *azidentity.DefaultAzureCredential) (*aztables.Client, error) {
+	tableURL := fmt.Sprintf("https://%s.table.core.windows.net/%s", storage.AccountName(cluster), tableName)
+	client, err := aztables.NewClient(tableURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table client: %w", err)
+	}
+	return client, nil
+}
+
+// principal names the caller from its ARM access token: the user principal name, or the application
+// and object ID for service principals and managed identities
+func principal(ctx context.Context, cred *azidentity.DefaultAzureCredential) string {
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}})
+	if err != nil {
+		return "unknown"
+	}
+	parts := strings.Split(token.Token, ".")
+	if len(parts) != 3 {
+		return "unknown"
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "unknown"
+	}
+	var claims struct {
+		UPN        string `json:"upn"`
+		UniqueName string `json:"unique_name"`
+		AppID      string `json:"appid"`
+		OID        string `json:"oid"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "unknown"
+	}
+	switch {
+	case claims.UPN != "":
+		return claims.UPN
+	case claims.UniqueName != "":
+		return claims.UniqueName
+	case claims.AppID != "":
+		return fmt.Sprintf("app %s (object %s)", claims.AppID, claims.OID)
+	case claims.OID != "":
+		return claims.OID
+	}
+	return "unknown"
+}
+
+// k3aVersion returns the module version k3a was built from
+func k3aVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+func hasErrorCode(err error, code aztables.TableErrorCode) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.ErrorCode == string(code)
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,13 @@
+// Package storage names the cluster storage account, which holds etcd backups and the cluster registry.
+package storage
+
+import (
+	"fmt"
+
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+)
+
+// AccountName returns the name of the cluster's storage account
+func AccountName(cluster string) string {
+	return fmt.Sprintf("k3astorage%s", kstrings.UniqueString(cluster))
+}
@@ -0,0 +1,31 @@
+// Package version reports the k3a release a binary was built from
+package version
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is set by release builds with -ldflags "-X github.com/jwilder/k3a/pkg/version.Version=v1.2.3"
+var Version = ""
+
+// pseudoVersion matches the versions Go gives untagged commits, which have no release image
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}`)
+
+// Get returns the k3a release of this binary: the linker flag, or the module version 'go install ...@v1.2.3'
+// records. It is empty for development builds and untagged commits.
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	v := info.Main.Version
+	if v == "" || v == "(devel)" || pseudoVersion.MatchString(v) || strings.Contains(v, "+dirty") {
+		return ""
+	}
+	return v
+}
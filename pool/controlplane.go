@@ -0,0 +1,400 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/jwilder/k3a/pkg/kube"
+)
+
+// ensureAPIBackendPools makes sure a control-plane VMSS model places instances in the API load balancer's
+// backend pools, so instances added by a scale-out receive API server traffic
+func ensureAPIBackendPools(ctx context.Context, subscriptionID, cluster, poolName string, vmss *armcompute.VirtualMachineScaleSet, cred *azidentity.DefaultAzureCredential) error {
+	vmssName := poolName + "-vmss"
+	if vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil || vmss.Properties.VirtualMachineProfile.NetworkProfile == nil {
+		return fmt.Errorf("VMSS '%s' has no network profile", vmssName)
+	}
+	networkProfile := vmss.Properties.VirtualMachineProfile.NetworkProfile
+	if len(networkProfile.NetworkInterfaceConfigurations) == 0 || networkProfile.NetworkInterfaceConfigurations[0].Properties == nil ||
+		len(networkProfile.NetworkInterfaceConfigurations[0].Properties.IPConfigurations) == 0 {
+		return fmt.Errorf("VMSS '%s' has no IP configuration", vmssName)
+	}
+	ipConfig := networkProfile.NetworkInterfaceConfigurations[0].Properties.IPConfigurations[0]
+
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	backendPools, _, err := getLoadBalancerPools(ctx, subscriptionID, cluster, network.APILBName, poolName, cred)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, pool := range ipConfig.Properties.LoadBalancerBackendAddressPools {
+		if pool.ID != nil {
+			present[strings.ToLower(*pool.ID)] = true
+		}
+	}
+	added := false
+	for _, pool := range backendPools {
+		if !present[strings.ToLower(*pool.ID)] {
+			ipConfig.Properties.LoadBalancerBackendAddressPools = append(ipConfig.Properties.LoadBalancerBackendAddressPools, pool)
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+
+	// The update model has the same shape as the network profile, so convert it through JSON
+	data, err := json.Marshal(networkProfile)
+	if err != nil {
+		return err
+	}
+	var update armcompute.VirtualMachineScaleSetUpdateNetworkProfile
+	if err := json.Unmarshal(data, &update); err != nil {
+		return err
+	}
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	fmt.Printf("Adding pool '%s' to the API load balancer backend pools...\n", poolName)
+	poller, err := vmssClient.BeginUpdate(ctx, cluster, vmssName, armcompute.VirtualMachineScaleSetUpdate{
+		Properties: &armcompute.VirtualMachineScaleSetUpdateProperties{
+			VirtualMachineProfile: &armcompute.VirtualMachineScaleSetUpdateVMProfile{
+				NetworkProfile: &update,
+			},
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start VMSS network update: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to update VMSS network profile: %w", err)
+	}
+	return nil
+}
+
+// joinNewControlPlaneInstances joins the instances of a control-plane pool that aren't in existing as
+// additional masters and waits for them to become Ready control-plane nodes
+func joinNewControlPlaneInstances(ctx context.Context, subscriptionID, cluster, poolName string, existing map[string]bool, expectedCount int, cred *azidentity.DefaultAzureCredential) error {
+	vmssName := poolName + "-vmss"
+	vmssManager := NewVMSSManager(subscriptionID, cluster, cred)
+	instances, err := vmssManager.WaitForVMSSInstancesRunning(ctx, vmssName, expectedCount, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	var added []VMInstance
+	for _, instance := range instances {
+		if !existing[instance.Name] {
+			added = append(added, instance)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	// Certificate keys only last 2h, so control-plane joins always get fresh join material
+	if err := rotateJoin(ctx, subscriptionID, cluster, cred); err != nil {
+		return fmt.Errorf("failed to refresh join commands: %w", err)
+	}
+
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	lbName := network.APILBName
+	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, lbName)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer public IP: %w", err)
+	}
+	natPortMappings, err := vmssManager.GetVMSSNATPortMappings(ctx, vmssName, lbName)
+	if err != nil {
+		return fmt.Errorf("failed to get NAT port mappings: %w", err)
+	}
+	labels, taints, err := getPoolNodeRegistration(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+	nodeNames, err := getInstanceNodeNames(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+	keyVaultName := kube.KeyVaultName(cluster)
+
+	for _, instance := range added {
+		natPort, exists := natPortMappings[instance.Name]
+		if !exists {
+			return fmt.Errorf("no NAT port mapping found for instance %s", instance.Name)
+		}
+		fmt.Printf("Joining instance %s as an additional control-plane node (NAT port: %d)\n", instance.Name, natPort)
+		sshClient, err := CreateSSHClientViaNAT(lbPublicIP, natPort, "azureuser", "")
+		if err != nil {
+			return fmt.Errorf("failed to create SSH connection to %s: %w", instance.Name, err)
+		}
+		installer := NewKubeadmInstaller(subscriptionID, cluster, keyVaultName, sshClient, cred)
+		installer.SetNodeRegistration(labels, taints)
+		err = installer.InstallAsAdditionalMaster(ctx)
+		sshClient.Close()
+		if err != nil {
+			return fmt.Errorf("failed to install additional master on %s: %w", instance.Name, err)
+		}
+	}
+
+	kubectl, err := NewKubectlRunner(ctx, subscriptionID, cluster, cred, nil)
+	if err != nil {
+		return err
+	}
+	defer kubectl.Close()
+	output, err := kubectl.Run("get nodes -l node-role.kubernetes.io/control-plane -o name")
+	if err != nil {
+		return err
+	}
+	for _, instance := range added {
+		nodeName := nodeNames[instance.Name]
+		if !strings.Contains(output+"\n", "node/"+nodeName+"\n") {
+			return fmt.Errorf("instance %s joined but node %s is not a control-plane node", instance.Name, nodeName)
+		}
+		if err := waitForNodeReady(kubectl, nodeName, nodeReadyTimeout); err != nil {
+			return err
+		}
+		fmt.Printf("Control-plane node %s is Ready\n", nodeName)
+	}
+	return nil
+}
+
+// removeControlPlaneInstances scales a control-plane pool down to count instances. VMSS picks which
+// instances a capacity change removes, so the newest instances are removed from the cluster with
+// removeControlPlaneMember and deleted one at a time instead.
+func removeControlPlaneInstances(ctx context.Context, subscriptionID, cluster, vmssName string, count int, vmssClient *armcompute.VirtualMachineScaleSetsClient, cred *azidentity.DefaultAzureCredential) error {
+	instances, err := NewVMSSManager(subscriptionID, cluster, cred).GetVMSSInstances(ctx, vmssName)
+	if err != nil {
+		return fmt.Errorf("failed to list VMSS instances: %w", err)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		a, _ := strconv.Atoi(instances[i].InstanceID)
+		b, _ := strconv.Atoi(instances[j].InstanceID)
+		return a > b
+	})
+	for i := 0; i < len(instances)-count; i++ {
+		instance := instances[i]
+		if err := removeControlPlaneMember(ctx, subscriptionID, cluster, vmssName, instance.InstanceID, false, cred); err != nil {
+			return err
+		}
+		fmt.Printf("Deleting instance %s...\n", instance.Name)
+		poller, err := vmssClient.BeginDeleteInstances(ctx, cluster, vmssName, armcompute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+			InstanceIDs: []*string{to.Ptr(instance.InstanceID)},
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start deleting instance %s: %w", instance.Name, err)
+		}
+		if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+			return fmt.Errorf("failed to delete instance %s: %w", instance.Name, err)
+		}
+	}
+	return nil
+}
+
+// etcdctlFlags reach the local member of kubeadm's stacked etcd from inside its static pod
+const etcdctlFlags = "--endpoints https://127.0.0.1:2379 --cacert /etc/kubernetes/pki/etcd/ca.crt " +
+	"--cert /etc/kubernetes/pki/etcd/server.crt --key /etc/kubernetes/pki/etcd/server.key"
+
+type etcdMember struct {
+	ID         string
+	Name       string
+	ClientURLs []string
+}
+
+// removeControlPlaneMember takes a control-plane instance out of the cluster before its VM is deleted.
+// It refuses when the remaining etcd members would lose quorum, resets kubeadm on the node when it is
+// reachable, removes its stacked etcd member and deletes its Node. kubeadm no longer keeps a
+// ClusterStatus entry per control-plane node, so there is nothing to clean up in kubeadm-config.
+// force skips the etcd membership and quorum checks, for members left out of a forced restore.
+func removeControlPlaneMember(ctx context.Context, subscriptionID, cluster, vmssName, instanceID string, force bool, cred *azidentity.DefaultAzureCredential) error {
+	vmssVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS VMs client: %w", err)
+	}
+	vm, err := vmssVMsClient.Get(ctx, cluster, vmssName, instanceID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get VMSS instance '%s': %w", instanceID, err)
+	}
+	if vm.Name == nil {
+		return fmt.Errorf("VMSS instance '%s' has no name", instanceID)
+	}
+	instanceName := *vm.Name
+	nodeName := instanceNodeName(instanceName)
+
+	hostnames, err := getInstanceNodeNames(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+	if len(hostnames) <= 1 {
+		return fmt.Errorf("refusing to delete %s, the last control-plane instance of cluster '%s'", nodeName, cluster)
+	}
+
+	kubectl, err := NewKubectlRunner(ctx, subscriptionID, cluster, cred, []string{nodeName})
+	if err != nil {
+		return err
+	}
+	defer kubectl.Close()
+
+	if _, err := kubectl.Run(fmt.Sprintf("get node %s -o name", nodeName)); err != nil && !force {
+		return fmt.Errorf("node %s of instance %s not found in the cluster: %w", nodeName, instanceName, err)
+	}
+
+	// Stacked etcd runs as a static pod on every control-plane node; with external etcd there is none
+	etcdPod := "etcd-" + kubectl.Host
+	_, err = kubectl.Run(fmt.Sprintf("-n kube-system get pod %s -o name", etcdPod))
+	stacked := err == nil
+	if stacked && !force {
+		members, err := etcdMembers(kubectl, etcdPod)
+		if err != nil {
+			return err
+		}
+		healthy, err := etcdHealthyEndpoints(kubectl, etcdPod)
+		if err != nil {
+			return err
+		}
+		found := false
+		remaining, remainingHealthy := 0, 0
+		for _, member := range members {
+			if member.Name == nodeName {
+				found = true
+				continue
+			}
+			remaining++
+			for _, url := range member.ClientURLs {
+				if healthy[url] {
+					remainingHealthy++
+					break
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("no etcd member named %s found; refusing to delete instance %s", nodeName, instanceName)
+		}
+		if quorum := remaining/2 + 1; remainingHealthy < quorum {
+			return fmt.Errorf("refusing to delete %s: %d of the %d remaining etcd members are healthy, below the quorum of %d",
+				nodeName, remainingHealthy, remaining, quorum)
+		}
+	}
+
+	fmt.Printf("Draining node %s...\n", nodeName)
+	if _, err := kubectl.Run(fmt.Sprintf("drain %s --ignore-daemonsets --delete-emptydir-data --timeout=5m", nodeName)); err != nil {
+		fmt.Printf("Warning: failed to drain node %s: %v\n", nodeName, err)
+	}
+
+	// kubeadm reset also removes the node's own etcd member when it can still reach etcd
+	if err := resetControlPlaneNode(ctx, subscriptionID, cluster, vmssName, instanceName, nodeName, cred); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	if stacked {
+		members, err := etcdMembers(kubectl, etcdPod)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if member.Name != nodeName {
+				continue
+			}
+			fmt.Printf("Removing etcd member %s (%s)...\n", member.Name, member.ID)
+			if _, err := kubectl.Run(fmt.Sprintf("-n kube-system exec %s -- etcdctl %s member remove %s", etcdPod, etcdctlFlags, member.ID)); err != nil {
+				return fmt.Errorf("failed to remove etcd member %s: %w", member.Name, err)
+			}
+		}
+	}
+
+	fmt.Printf("Deleting node %s...\n", nodeName)
+	if _, err := kubectl.Run(fmt.Sprintf("delete node %s --ignore-not-found=%t", nodeName, force)); err != nil {
+		return fmt.Errorf("failed to delete node %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+// resetControlPlaneNode runs kubeadm reset on a control-plane instance over the SSH NAT
+func resetControlPlaneNode(ctx context.Context, subscriptionID, cluster, vmssName, instanceName, nodeName string, cred *azidentity.DefaultAzureCredential) error {
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	vmssManager := NewVMSSManager(subscriptionID, cluster, cred)
+	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, network.APILBName)
+	if err != nil {
+		return fmt.Errorf("failed to get load balancer public IP: %w", err)
+	}
+	natPortMappings, err := vmssManager.GetVMSSNATPortMappings(ctx, vmssName, network.APILBName)
+	if err != nil {
+		return fmt.Errorf("failed to get NAT port mappings: %w", err)
+	}
+	natPort, exists := natPortMappings[instanceName]
+	if !exists {
+		return fmt.Errorf("no NAT port mapping found for instance %s, skipping kubeadm reset", instanceName)
+	}
+	sshClient, err := CreateSSHClientViaNAT(lbPublicIP, natPort, "azureuser", "")
+	if err != nil {
+		return fmt.Errorf("node %s is not reachable, skipping kubeadm reset: %w", nodeName, err)
+	}
+	node := &KubectlRunner{Host: nodeName, sshClient: sshClient}
+	defer node.Close()
+
+	fmt.Printf("Running kubeadm reset on %s...\n", nodeName)
+	if _, err := node.RunScript("kubeadm reset --force"); err != nil {
+		return fmt.Errorf("kubeadm reset failed on %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+// etcdMembers lists the etcd cluster members through the etcd static pod
+func etcdMembers(kubectl *KubectlRunner, etcdPod string) ([]etcdMember, error) {
+	output, err := kubectl.Run(fmt.Sprintf("-n kube-system exec %s -- etcdctl %s member list", etcdPod, etcdctlFlags))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list etcd members: %w", err)
+	}
+	// Each line is: ID, status, name, peer URLs, client URLs, is learner
+	var members []etcdMember
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, ", ")
+		if len(fields) < 5 {
+			continue
+		}
+		members = append(members, etcdMember{
+			ID:         fields[0],
+			Name:       fields[2],
+			ClientURLs: strings.Split(fields[4], ","),
+		})
+	}
+	return members, nil
+}
+
+// etcdHealthyEndpoints returns the client URLs of the etcd members that report healthy
+func etcdHealthyEndpoints(kubectl *KubectlRunner, etcdPod string) (map[string]bool, error) {
+	// endpoint health exits non-zero when any member is unhealthy, so only a missing report is an error
+	output, _ := kubectl.Run(fmt.Sprintf("-n kube-system exec %s -- etcdctl %s endpoint health --cluster", etcdPod, etcdctlFlags))
+	healthy := make(map[string]bool)
+	reported := false
+	for _, line := range strings.Split(output, "\n") {
+		endpoint, status, found := strings.Cut(strings.TrimSpace(line), " is ")
+		if !found {
+			continue
+		}
+		reported = true
+		if strings.HasPrefix(status, "healthy") {
+			healthy[endpoint] = true
+		}
+	}
+	if !reported {
+		return nil, fmt.Errorf("failed to check etcd health: %s", strings.TrimSpace(output))
+	}
+	return healthy, nil
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
 	"time"
 
@@ -16,6 +17,10 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/jwilder/k3a/loadbalancer/rule"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"github.com/jwilder/k3a/pkg/kube"
+	"github.com/jwilder/k3a/pkg/registry"
+	"github.com/jwilder/k3a/pkg/storage"
 	kstrings "github.com/jwilder/k3a/pkg/strings"
 )
 
@@ -27,10 +32,28 @@ type CreatePoolArgs struct {
 	Name           string
 	SSHKeyPath     string
 	InstanceCount  int
-	K8sVersion     string   // New field for Kubernetes version
+	K8sVersion     string   // Kubernetes version; empty takes the version baked into ImageID
 	SKU            string   // VM SKU type
 	OSDiskSizeGB   int      // OS disk size in GB
 	MSIIDs         []string // Additional user-assigned MSI resource IDs
+	ImageID        string   // Optional pre-baked image (Shared Image Gallery version or managed image) resource ID
+	Labels         []string // Node labels in key=value form
+	Taints         []string // Node taints in key=value:Effect form
+	OSDiskSKU      string   // OS disk SKU (Standard_LRS, StandardSSD_LRS or Premium_LRS)
+	EphemeralOS    bool     // Place the OS disk on the VM's local cache disk
+	DataDisks      []DataDisk
+	MountDataDisk  bool   // Mount the first data disk at /var/lib/containerd and /var/lib/kubelet
+	SubnetPrefix   string // Dedicated pool subnet as a prefix length ("/22") or CIDR; empty uses the cluster subnet
+}
+
+// nodeConfig holds the per-pool settings rendered into cloud-init
+type nodeConfig struct {
+	Role          string
+	K8sVersion    string
+	PrebakedImage bool
+	Labels        []string
+	Taints        []string
+	MountDataDisk bool
 }
 
 //go:embed cloud-init.yaml
@@ -53,6 +76,21 @@ func getCloudInitData(tmplData map[string]string) (string, error) {
 	return base64.StdEncoding.EncodeToString(renderedCloudInit.Bytes()), nil
 }
 
+// CloudInitData renders the node cloud-init template for callers outside the pool package (e.g. image builds)
+func CloudInitData(tmplData map[string]string) (string, error) {
+	return getCloudInitData(tmplData)
+}
+
+// K8sRepoVersion returns the pkgs.k8s.io repository channel (e.g. v1.33) for a Kubernetes version (e.g. v1.33.1)
+func K8sRepoVersion(k8sVersion string) string {
+	v := strings.TrimPrefix(k8sVersion, "v")
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return "v1.33"
+	}
+	return fmt.Sprintf("v%s.%s", parts[0], parts[1])
+}
+
 // getManagedIdentity fetches the managed identity resource
 func getManagedIdentity(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (*armmsi.Identity, error) {
 	msiClient, err := armmsi.NewUserAssignedIdentitiesClient(subscriptionID, cred, nil)
@@ -67,19 +105,6 @@ func getManagedIdentity(ctx context.Context, subscriptionID, cluster string, cre
 	return &msi.Identity, nil
 }
 
-// getSubnet fetches the subnet resource
-func getSubnet(ctx context.Context, subscriptionID, cluster, vnetName string, cred *azidentity.DefaultAzureCredential) (*armnetwork.Subnet, error) {
-	subnetClient, err := armnetwork.NewSubnetsClient(subscriptionID, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create subnet client: %w", err)
-	}
-	subnet, err := subnetClient.Get(ctx, cluster, vnetName, "default", nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get subnet: %w", err)
-	}
-	return &subnet.Subnet, nil
-}
-
 // getLoadBalancerPools fetches backend and inbound NAT pools for control plane
 func getLoadBalancerPools(ctx context.Context, subscriptionID, cluster, lbName, poolName string, cred *azidentity.DefaultAzureCredential) ([]*armcompute.SubResource, []*armcompute.SubResource, error) {
 	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
@@ -105,7 +130,7 @@ func getLoadBalancerPools(ctx context.Context, subscriptionID, cluster, lbName,
 	}
 
 	// Create a new backend pool for this VMSS
-	newBackendPoolName := fmt.Sprintf("%s-backend-pool", poolName)
+	newBackendPoolName := rule.BackendPoolName(poolName)
 	var newBackendPoolID *string
 	if lb.Properties != nil && lb.Properties.BackendAddressPools != nil {
 		for _, bp := range lb.Properties.BackendAddressPools {
@@ -153,6 +178,166 @@ func getLoadBalancerPools(ctx context.Context, subscriptionID, cluster, lbName,
 	return backendPools, inboundNatPools, nil
 }
 
+// getOutboundPoolID returns the ID of the outbound SNAT backend pool on the given load balancer
+func getOutboundPoolID(ctx context.Context, subscriptionID, cluster, lbName, backendPoolName string, cred *azidentity.DefaultAzureCredential) (*string, error) {
+	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create load balancer client: %w", err)
+	}
+	lb, err := lbClient.Get(ctx, cluster, lbName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get load balancer: %w", err)
+	}
+	if lb.Properties != nil {
+		for _, bp := range lb.Properties.BackendAddressPools {
+			if bp.Name != nil && *bp.Name == backendPoolName {
+				return bp.ID, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s not found on load balancer '%s'", backendPoolName, lbName)
+}
+
+// getAPIPoolsIPv6 returns the IPv6 backend pool (created if missing) and SSH NAT pool that a control-plane
+// pool's IPv6 NIC config joins. Both are nil on clusters created without an inbound IPv6 frontend.
+func getAPIPoolsIPv6(ctx context.Context, subscriptionID, cluster, lbName, poolName string, cred *azidentity.DefaultAzureCredential) (*armcompute.SubResource, *armcompute.SubResource, error) {
+	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create load balancer client: %w", err)
+	}
+	lb, err := lbClient.Get(ctx, cluster, lbName, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get load balancer: %w", err)
+	}
+	if lb.Properties == nil {
+		return nil, nil, nil
+	}
+	var natPoolID *string
+	for _, np := range lb.Properties.InboundNatPools {
+		if np.Name != nil && *np.Name == clusternet.SSHNATPoolIPv6 {
+			natPoolID = np.ID
+			break
+		}
+	}
+	if natPoolID == nil {
+		return nil, nil, nil
+	}
+
+	backendPoolName := rule.BackendPoolNameIPv6(poolName)
+	var backendPoolID *string
+	for _, bp := range lb.Properties.BackendAddressPools {
+		if bp.Name != nil && *bp.Name == backendPoolName {
+			backendPoolID = bp.ID
+			break
+		}
+	}
+	if backendPoolID == nil {
+		backendPoolsClient, err := armnetwork.NewLoadBalancerBackendAddressPoolsClient(subscriptionID, cred, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create backend address pool client: %w", err)
+		}
+		poller, err := backendPoolsClient.BeginCreateOrUpdate(ctx, cluster, lbName, backendPoolName, armnetwork.BackendAddressPool{
+			Name: to.Ptr(backendPoolName),
+		}, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start IPv6 backend address pool creation: %w", err)
+		}
+		resp, err := poller.PollUntilDone(ctx, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create IPv6 backend address pool: %w", err)
+		}
+		backendPoolID = resp.ID
+	}
+	return &armcompute.SubResource{ID: backendPoolID}, &armcompute.SubResource{ID: natPoolID}, nil
+}
+
+// buildCustomData renders the base64 cloud-init for a pool's VMSS model
+func buildCustomData(ctx context.Context, subscriptionID, cluster string, node nodeConfig, msi *armmsi.Identity, cred *azidentity.DefaultAzureCredential) (string, error) {
+	clusterHash := kstrings.UniqueString(cluster)
+
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return "", err
+	}
+	externalIP := ""
+	if !network.Private {
+		publicIPName := fmt.Sprintf("k3alb%s-publicip", clusterHash)
+		externalIP, err = getPublicIP(ctx, subscriptionID, cluster, publicIPName, cred)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	keyVaultName := kube.KeyVaultName(cluster)
+	storageAccountName := storage.AccountName(cluster)
+	tmplData := map[string]string{
+		"KeyVaultName":       keyVaultName,
+		"Role":               node.Role,
+		"StorageAccountName": storageAccountName,
+		"ResourceGroup":      cluster,
+		"ExternalIP":         externalIP,
+		"K8sVersion":         node.K8sVersion, // Pass version to template
+		"K8sRepoVersion":     K8sRepoVersion(node.K8sVersion),
+		"MSIClientID":        *msi.Properties.ClientID,
+		"PrebakedImage":      fmt.Sprintf("%t", node.PrebakedImage),
+		"NodeLabels":         strings.Join(node.Labels, ","),
+		"NodeTaints":         strings.Join(node.Taints, ","),
+		"MountDataDisk":      fmt.Sprintf("%t", node.MountDataDisk),
+	}
+
+	return getCloudInitData(tmplData)
+}
+
+// buildUserAssignedIdentities returns the VMSS identity map for the cluster MSI plus any additional MSIs
+func buildUserAssignedIdentities(clusterMSIID string, msiIDs []string) map[string]*armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue {
+	userAssignedIdentities := map[string]*armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue{
+		clusterMSIID: {},
+	}
+	for _, id := range msiIDs {
+		userAssignedIdentities[id] = &armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue{}
+	}
+	return userAssignedIdentities
+}
+
+// buildStorageProfile returns the VMSS storage profile for the given image, OS disk and data disks
+func buildStorageProfile(imageID string, osDiskSizeGB int, osDiskSKU string, ephemeralOS bool, dataDisks []DataDisk) *armcompute.VirtualMachineScaleSetStorageProfile {
+	imageReference := &armcompute.ImageReference{
+		Publisher: to.Ptr("MicrosoftCblMariner"),
+		Offer:     to.Ptr("Cbl-Mariner"),
+		SKU:       to.Ptr("cbl-mariner-2-gen2"),
+		Version:   to.Ptr("latest"),
+	}
+	if imageID != "" {
+		// Pre-baked images already contain azure-cli, containerd and kubeadm (see `k3a image build`)
+		imageReference = &armcompute.ImageReference{ID: to.Ptr(imageID)}
+	}
+	if osDiskSKU == "" {
+		osDiskSKU = string(armcompute.StorageAccountTypesStandardLRS)
+	}
+
+	osDisk := &armcompute.VirtualMachineScaleSetOSDisk{
+		CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesFromImage),
+		ManagedDisk: &armcompute.VirtualMachineScaleSetManagedDiskParameters{
+			StorageAccountType: to.Ptr(armcompute.StorageAccountTypes(osDiskSKU)),
+		},
+		DiskSizeGB: to.Ptr(int32(osDiskSizeGB)),
+	}
+	if ephemeralOS {
+		// Ephemeral OS disks live on the local cache disk and require read-only caching
+		osDisk.Caching = to.Ptr(armcompute.CachingTypesReadOnly)
+		osDisk.DiffDiskSettings = &armcompute.DiffDiskSettings{
+			Option:    to.Ptr(armcompute.DiffDiskOptionsLocal),
+			Placement: to.Ptr(armcompute.DiffDiskPlacementCacheDisk),
+		}
+	}
+
+	return &armcompute.VirtualMachineScaleSetStorageProfile{
+		ImageReference: imageReference,
+		OSDisk:         osDisk,
+		DataDisks:      buildDataDisks(dataDisks),
+	}
+}
+
 // getSSHKey reads the SSH public key from the given path
 func getSSHKey(sshKeyPath string) (string, error) {
 	if sshKeyPath == "" {
@@ -241,15 +426,19 @@ func installKubeadmOnInstances(ctx context.Context, subscriptionID, cluster, vms
 		return err
 	}
 
-	clusterHash := kstrings.UniqueString(cluster)
-	keyVaultName := fmt.Sprintf("k3akv%s", clusterHash)
-	lbName := fmt.Sprintf("k3alb%s", clusterHash)
+	keyVaultName := kube.KeyVaultName(cluster)
 
 	// Worker nodes use cloud-init for automatic joining, no SSH installation needed
 	if role == "worker" {
 		return nil
 	}
 
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	lbName := network.APILBName
+
 	// Get load balancer public IP for SSH access (control-plane only)
 	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, lbName)
 	if err != nil {
@@ -270,6 +459,12 @@ func installKubeadmOnInstances(ctx context.Context, subscriptionID, cluster, vms
 
 	fmt.Printf("Determined node type: %s\n", nodeType)
 
+	// Labels and taints requested at pool creation are stored as VMSS tags
+	labels, taints, err := getPoolNodeRegistration(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+
 	// For control-plane, we only install on the first instance initially
 	// Additional instances will be handled separately if needed
 	var instancesToProcess []VMInstance
@@ -299,6 +494,7 @@ func installKubeadmOnInstances(ctx context.Context, subscriptionID, cluster, vms
 
 		// Create kubeadm installer
 		installer := NewKubeadmInstaller(subscriptionID, cluster, keyVaultName, sshClient, cred)
+		installer.SetNodeRegistration(labels, taints)
 
 		// Install based on node type
 		switch nodeType {
@@ -347,6 +543,7 @@ func installKubeadmOnInstances(ctx context.Context, subscriptionID, cluster, vms
 
 			// Create kubeadm installer
 			installer := NewKubeadmInstaller(subscriptionID, cluster, keyVaultName, sshClient, cred)
+			installer.SetNodeRegistration(labels, taints)
 
 			if err := installer.InstallAsAdditionalMaster(ctx); err != nil {
 				return fmt.Errorf("failed to install additional master on %s: %w", instance.Name, err)
@@ -368,6 +565,21 @@ func Create(args CreatePoolArgs) error {
 	if role != "" && role != "control-plane" && role != "worker" {
 		return fmt.Errorf("invalid role: %s (must be 'control-plane' or 'worker')", role)
 	}
+	labels, err := nodeLabels(args.Name, args.Labels)
+	if err != nil {
+		return err
+	}
+	if err := validateTaints(args.Taints); err != nil {
+		return err
+	}
+	if args.OSDiskSKU != "" {
+		if err := validateDiskSKU(args.OSDiskSKU); err != nil {
+			return err
+		}
+	}
+	if args.MountDataDisk && len(args.DataDisks) == 0 {
+		return fmt.Errorf("mounting a data disk requires at least one data disk")
+	}
 
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
@@ -408,17 +620,23 @@ func Create(args CreatePoolArgs) error {
 		}
 	}
 
+	// Nodes from a pre-baked image run the Kubernetes version baked into it
+	if args.ImageID != "" {
+		if args.K8sVersion, err = checkImageK8sVersion(ctx, args.ImageID, args.K8sVersion, cred); err != nil {
+			return err
+		}
+	}
+
 	sshKey, err := getSSHKey(args.SSHKeyPath)
 	if err != nil {
 		return err
 	}
 
-	clusterHash := kstrings.UniqueString(cluster)
-
-	publicIPName := fmt.Sprintf("k3alb%s-publicip", clusterHash)
-	externalIP, err := getPublicIP(ctx, subscriptionID, cluster, publicIPName, cred)
-	if err != nil {
-		return err
+	// Workers join with the stored join command, which must still be valid when they boot
+	if role != "control-plane" {
+		if err := refreshJoinIfExpiring(ctx, subscriptionID, cluster, role, cred); err != nil {
+			return err
+		}
 	}
 
 	// Reference existing resources
@@ -428,26 +646,16 @@ func Create(args CreatePoolArgs) error {
 	}
 
 	// Collect all MSIs: default + user-specified
-	userAssignedIdentities := map[string]*armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue{
-		*msi.ID: {},
-	}
-	for _, id := range args.MSIIDs {
-		userAssignedIdentities[id] = &armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue{}
-	}
-
-	keyVaultName := fmt.Sprintf("k3akv%s", clusterHash)
-	storageAccountName := fmt.Sprintf("k3astorage%s", clusterHash)
-	tmplData := map[string]string{
-		"KeyVaultName":       keyVaultName,
-		"Role":               role,
-		"StorageAccountName": storageAccountName,
-		"ResourceGroup":      cluster,
-		"ExternalIP":         externalIP,
-		"K8sVersion":         args.K8sVersion, // Pass version to template
-		"MSIClientID":        *msi.Properties.ClientID,
-	}
-
-	customDataB64, err := getCloudInitData(tmplData)
+	userAssignedIdentities := buildUserAssignedIdentities(*msi.ID, args.MSIIDs)
+
+	customDataB64, err := buildCustomData(ctx, subscriptionID, cluster, nodeConfig{
+		Role:          role,
+		K8sVersion:    args.K8sVersion,
+		PrebakedImage: args.ImageID != "",
+		Labels:        labels,
+		Taints:        args.Taints,
+		MountDataDisk: args.MountDataDisk,
+	}, msi, cred)
 	if err != nil {
 		return err
 	}
@@ -459,9 +667,20 @@ func Create(args CreatePoolArgs) error {
 
 	instanceCount := args.InstanceCount
 
-	vnetName := "k3a-vnet"
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	if err := checkSNATCapacity(ctx, subscriptionID, cluster, vmssName, int64(instanceCount), network, cred); err != nil {
+		return err
+	}
 
-	subnet, err := getSubnet(ctx, subscriptionID, cluster, vnetName, cred)
+	var subnet *armnetwork.Subnet
+	if args.SubnetPrefix != "" {
+		subnet, err = createPoolSubnet(ctx, subscriptionID, cluster, args.Name, args.SubnetPrefix, network, cred)
+	} else {
+		subnet, err = getSubnet(ctx, network.SubnetID, cred)
+	}
 	if err != nil {
 		return err
 	}
@@ -469,31 +688,72 @@ func Create(args CreatePoolArgs) error {
 	// Prepare VMSS parameters
 	var backendPools []*armcompute.SubResource
 	var inboundNatPools []*armcompute.SubResource
-	lbName := fmt.Sprintf("k3alb%s", clusterHash)
+	lbName := network.APILBName
 	backendPools, inboundNatPools, err = getLoadBalancerPools(ctx, subscriptionID, cluster, lbName, args.Name, cred)
 	if err != nil {
 		return err
 	}
+	if network.Private && network.Egress == clusternet.EgressLoadBalancer {
+		// Outbound SNAT still goes through the public load balancer
+		outboundPoolID, err := getOutboundPoolID(ctx, subscriptionID, cluster, network.PublicLBName, "outbound-pool", cred)
+		if err != nil {
+			return err
+		}
+		backendPools = append(backendPools, &armcompute.SubResource{ID: outboundPoolID})
+	}
 
 	if !isControlPlane {
 		inboundNatPools = nil
 	}
 
-	storageProfile := &armcompute.VirtualMachineScaleSetStorageProfile{
-		ImageReference: &armcompute.ImageReference{
-			Publisher: to.Ptr("MicrosoftCblMariner"),
-			Offer:     to.Ptr("Cbl-Mariner"),
-			SKU:       to.Ptr("cbl-mariner-2-gen2"),
-			Version:   to.Ptr("latest"),
-		},
-		OSDisk: &armcompute.VirtualMachineScaleSetOSDisk{
-			CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesFromImage),
-			ManagedDisk: &armcompute.VirtualMachineScaleSetManagedDiskParameters{
-				StorageAccountType: to.Ptr(armcompute.StorageAccountTypesStandardLRS),
+	ipConfigurations := []*armcompute.VirtualMachineScaleSetIPConfiguration{
+		{
+			Name: to.Ptr(args.Name + "-ipconfig"),
+			Properties: &armcompute.VirtualMachineScaleSetIPConfigurationProperties{
+				Subnet: &armcompute.APIEntityReference{
+					ID: subnet.ID,
+				},
+				LoadBalancerBackendAddressPools: backendPools,
+				LoadBalancerInboundNatPools:     inboundNatPools,
 			},
-			DiskSizeGB: to.Ptr(int32(args.OSDiskSizeGB)),
 		},
 	}
+	var apiPoolIPv6 *armcompute.SubResource
+	if network.DualStack {
+		outboundPoolV6ID, err := getOutboundPoolID(ctx, subscriptionID, cluster, network.PublicLBName, "outbound-pool-ipv6", cred)
+		if err != nil {
+			return err
+		}
+		backendPoolsV6 := []*armcompute.SubResource{{ID: outboundPoolV6ID}}
+		var inboundNatPoolsV6 []*armcompute.SubResource
+		// Control-plane nodes of public clusters also serve the API server and SSH over IPv6;
+		// private clusters keep the API server on the IPv4 internal load balancer
+		if hasAPIPoolIPv6(network, isControlPlane) {
+			var sshPoolIPv6 *armcompute.SubResource
+			apiPoolIPv6, sshPoolIPv6, err = getAPIPoolsIPv6(ctx, subscriptionID, cluster, lbName, args.Name, cred)
+			if err != nil {
+				return err
+			}
+			if apiPoolIPv6 != nil {
+				backendPoolsV6 = append(backendPoolsV6, apiPoolIPv6)
+				inboundNatPoolsV6 = append(inboundNatPoolsV6, sshPoolIPv6)
+			}
+		}
+		ipConfigurations[0].Properties.Primary = to.Ptr(true)
+		ipConfigurations = append(ipConfigurations, &armcompute.VirtualMachineScaleSetIPConfiguration{
+			Name: to.Ptr(args.Name + "-ipconfig-v6"),
+			Properties: &armcompute.VirtualMachineScaleSetIPConfigurationProperties{
+				PrivateIPAddressVersion: to.Ptr(armcompute.IPVersionIPv6),
+				Subnet: &armcompute.APIEntityReference{
+					ID: subnet.ID,
+				},
+				LoadBalancerBackendAddressPools: backendPoolsV6,
+				LoadBalancerInboundNatPools:     inboundNatPoolsV6,
+			},
+		})
+	}
+
+	storageProfile := buildStorageProfile(args.ImageID, args.OSDiskSizeGB, args.OSDiskSKU, args.EphemeralOS, args.DataDisks)
 
 	vmssParams := armcompute.VirtualMachineScaleSet{
 		Location: to.Ptr(location),
@@ -503,7 +763,11 @@ func Create(args CreatePoolArgs) error {
 			Capacity: to.Ptr[int64](int64(instanceCount)),
 		},
 		Tags: map[string]*string{
-			"k3a": to.Ptr(role),
+			"k3a":            to.Ptr(role),
+			K8sVersionTag:    to.Ptr(args.K8sVersion),
+			labelsTag:        to.Ptr(strings.Join(labels, ",")),
+			taintsTag:        to.Ptr(strings.Join(args.Taints, ",")),
+			dataDiskMountTag: to.Ptr(fmt.Sprintf("%t", args.MountDataDisk)),
 		},
 		Identity: &armcompute.VirtualMachineScaleSetIdentity{
 			Type:                   to.Ptr(armcompute.ResourceIdentityTypeUserAssigned),
@@ -536,19 +800,8 @@ func Create(args CreatePoolArgs) error {
 						{
 							Name: to.Ptr(args.Name + "-nic"),
 							Properties: &armcompute.VirtualMachineScaleSetNetworkConfigurationProperties{
-								Primary: to.Ptr(true),
-								IPConfigurations: []*armcompute.VirtualMachineScaleSetIPConfiguration{
-									{
-										Name: to.Ptr(args.Name + "-ipconfig"),
-										Properties: &armcompute.VirtualMachineScaleSetIPConfigurationProperties{
-											Subnet: &armcompute.APIEntityReference{
-												ID: subnet.ID,
-											},
-											LoadBalancerBackendAddressPools: backendPools,
-											LoadBalancerInboundNatPools:     inboundNatPools,
-										},
-									},
-								},
+								Primary:          to.Ptr(true),
+								IPConfigurations: ipConfigurations,
 							},
 						},
 					},
@@ -556,6 +809,9 @@ func Create(args CreatePoolArgs) error {
 			},
 		},
 	}
+	if args.SubnetPrefix != "" {
+		vmssParams.Tags[clusternet.PoolSubnetTag] = subnet.ID
+	}
 
 	poller, err := vmssClient.BeginCreateOrUpdate(ctx, cluster, vmssName, vmssParams, nil)
 	if err != nil {
@@ -574,9 +830,28 @@ func Create(args CreatePoolArgs) error {
 			RuleName:       "kubernetes-api",
 			FrontendPort:   6443,
 			BackendPort:    6443,
+			BackendPool:    args.Name,
+			ProbeProtocol:  "https",
+			ProbePath:      "/readyz",
 		}); err != nil {
 			return fmt.Errorf("failed to create kubernetes API load balancing rule: %w", err)
 		}
+		if apiPoolIPv6 != nil {
+			if err := rule.Create(rule.CreateRuleArgs{
+				SubscriptionID: subscriptionID,
+				ResourceGroup:  cluster,
+				LBName:         lbName,
+				RuleName:       "kubernetes-api-ipv6",
+				FrontendPort:   6443,
+				BackendPort:    6443,
+				BackendPool:    rule.BackendPoolNameIPv6(args.Name),
+				Frontend:       clusternet.APIFrontendIPv6,
+				ProbeProtocol:  "https",
+				ProbePath:      "/readyz",
+			}); err != nil {
+				return fmt.Errorf("failed to create kubernetes API IPv6 load balancing rule: %w", err)
+			}
+		}
 	}
 
 	fmt.Printf("VMSS deployment succeeded: %v\n", *resp.ID)
@@ -586,5 +861,15 @@ func Create(args CreatePoolArgs) error {
 		return fmt.Errorf("kubeadm installation failed: %w", err)
 	}
 
+	// The pool works without its record, so failures only warn
+	if err := registry.Put(ctx, subscriptionID, cluster, registry.Record{
+		Kind:              registry.KindPool,
+		Name:              args.Name,
+		K8sVersion:        args.K8sVersion,
+		SSHKeyFingerprint: registry.SSHKeyFingerprint(sshKey),
+	}, args, cred); err != nil {
+		fmt.Printf("Warning: failed to record pool metadata: %v\n", err)
+	}
+
 	return nil
 }
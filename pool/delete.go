@@ -4,21 +4,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
-	kstrings "github.com/jwilder/k3a/pkg/strings"
+	"github.com/jwilder/k3a/loadbalancer/rule"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	"github.com/jwilder/k3a/pkg/protect"
+	"github.com/jwilder/k3a/pkg/registry"
 )
 
 type DeletePoolArgs struct {
 	SubscriptionID string
 	Cluster        string
 	Name           string
+	Force          bool // Delete the control-plane pool even while worker pools exist
 }
 
+// Delete deletes a pool's VMSS, its API load balancer backend pool and its dedicated subnet. It refuses
+// protected pools and, unless Force is set, the control-plane pool while worker pools exist.
 func Delete(args DeletePoolArgs) error {
 	subscriptionID := args.SubscriptionID
 	cluster := args.Cluster
@@ -37,6 +44,29 @@ func Delete(args DeletePoolArgs) error {
 		return fmt.Errorf("failed to create VMSS client: %w", err)
 	}
 	vmssName := poolName + "-vmss"
+
+	// Remember a dedicated pool subnet so it can be removed once the instances are gone
+	var poolSubnetID string
+	controlPlane := false
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err == nil {
+		if err := checkPoolDeletable(ctx, subscriptionID, cluster, &vmss.VirtualMachineScaleSet, args.Force, vmssClient, cred); err != nil {
+			return err
+		}
+		if v, ok := vmss.Tags[clusternet.PoolSubnetTag]; ok && v != nil {
+			poolSubnetID = *v
+		}
+		if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+			controlPlane = true
+		}
+	} else {
+		// Only a missing VMSS leaves nothing to check; the rest of the pool is still cleaned up
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+		}
+	}
+
 	// Spinner removed from here
 	poller, err := vmssClient.BeginDelete(ctx, cluster, vmssName, nil)
 	if err != nil {
@@ -47,36 +77,54 @@ func Delete(args DeletePoolArgs) error {
 		return fmt.Errorf("failed to delete VMSS: %w", err)
 	}
 
-	// Compute clusterHash for consistent LB naming
-	clusterHash := kstrings.UniqueString(cluster)
-	// Delete the backend pool from the load balancer
-	lbName := strings.ToLower("k3alb" + clusterHash)
-	backendPoolName := fmt.Sprintf("k3a-%s-backend-pool", poolName)
+	// Delete the backend pool from the load balancer that carries the API server rule
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	lbName := network.APILBName
+	backendPoolName := rule.BackendPoolName(poolName)
 	backendPoolsClient, err := armnetwork.NewLoadBalancerBackendAddressPoolsClient(subscriptionID, cred, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create backend address pools client: %w", err)
 	}
+	if err := deleteBackendPool(ctx, cluster, lbName, backendPoolName, backendPoolsClient); err != nil {
+		return err
+	}
+	if hasAPIPoolIPv6(network, controlPlane) {
+		if err := deleteBackendPool(ctx, cluster, lbName, rule.BackendPoolNameIPv6(poolName), backendPoolsClient); err != nil {
+			return err
+		}
+	}
+
+	if poolSubnetID != "" {
+		if err := deletePoolSubnet(ctx, poolSubnetID, cred); err != nil {
+			return err
+		}
+	}
+
+	if err := registry.Delete(ctx, subscriptionID, cluster, registry.KindPool, poolName, cred); err != nil {
+		fmt.Printf("Warning: failed to remove pool metadata: %v\n", err)
+	}
+
+	fmt.Printf("Pool '%s' and backend pool '%s' deleted successfully in cluster '%s'.\n", poolName, backendPoolName, cluster)
+	return nil
+}
+
+// deleteBackendPool deletes a backend pool from the load balancer, skipping pools that don't exist
+func deleteBackendPool(ctx context.Context, cluster, lbName, backendPoolName string, backendPoolsClient *armnetwork.LoadBalancerBackendAddressPoolsClient) error {
 	deletePoller, err := backendPoolsClient.BeginDelete(ctx, cluster, lbName, backendPoolName, nil)
+	if err == nil {
+		_, err = deletePoller.PollUntilDone(ctx, nil)
+	}
 	if err != nil {
 		var respErr *azcore.ResponseError
 		if errors.As(err, &respErr) && respErr.ErrorCode == "ResourceNotFound" {
 			fmt.Printf("Backend pool '%s' or load balancer '%s' not found, skipping deletion.\n", backendPoolName, lbName)
-		} else {
-			return fmt.Errorf("failed to start backend pool deletion: %w", err)
-		}
-	} else {
-		_, err = deletePoller.PollUntilDone(ctx, nil)
-		if err != nil {
-			var respErr *azcore.ResponseError
-			if errors.As(err, &respErr) && respErr.ErrorCode == "ResourceNotFound" {
-				fmt.Printf("Backend pool '%s' or load balancer '%s' not found, skipping deletion.\n", backendPoolName, lbName)
-			} else {
-				return fmt.Errorf("failed to delete backend pool: %w", err)
-			}
+			return nil
 		}
+		return fmt.Errorf("failed to delete backend pool '%s': %w", backendPoolName, err)
 	}
-
-	fmt.Printf("Pool '%s' and backend pool '%s' deleted successfully in cluster '%s'.\n", poolName, backendPoolName, cluster)
 	return nil
 }
 
@@ -86,9 +134,12 @@ type DeleteInstanceArgs struct {
 	Cluster        string
 	PoolName       string
 	InstanceID     string
+	// Force skips the etcd checks for control-plane instances left out of a forced restore
+	Force bool
 }
 
-// DeleteInstance deletes a single VMSS instance in the specified pool
+// DeleteInstance deletes a single VMSS instance in the specified pool. Control-plane instances are
+// first removed from the cluster by removeControlPlaneMember.
 func DeleteInstance(args DeleteInstanceArgs) error {
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
@@ -99,7 +150,23 @@ func DeleteInstance(args DeleteInstanceArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to create VMSS VMs client: %w", err)
 	}
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
 	vmssName := args.PoolName + "-vmss"
+	vmss, err := vmssClient.Get(ctx, args.Cluster, vmssName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	if err := protect.Check(ctx, args.SubscriptionID, args.Cluster, *vmss.ID, "pool", vmss.Tags, cred); err != nil {
+		return err
+	}
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+		if err := removeControlPlaneMember(ctx, args.SubscriptionID, args.Cluster, vmssName, args.InstanceID, args.Force, cred); err != nil {
+			return err
+		}
+	}
 	poller, err := vmssVMsClient.BeginDelete(ctx, args.Cluster, vmssName, args.InstanceID, nil)
 	if err != nil {
 		return fmt.Errorf("failed to start VMSS instance deletion: %w", err)
@@ -111,3 +178,124 @@ func DeleteInstance(args DeleteInstanceArgs) error {
 	fmt.Printf("Instance '%s' deleted successfully from pool '%s' in cluster '%s'.\n", args.InstanceID, args.PoolName, args.Cluster)
 	return nil
 }
+
+// DeletePlan checks that the pool can be deleted and returns the resources deleting it would destroy
+func DeletePlan(args DeletePoolArgs) ([]string, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmssName := args.Name + "-vmss"
+	vmss, err := vmssClient.Get(ctx, args.Cluster, vmssName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	if err := checkPoolDeletable(ctx, args.SubscriptionID, args.Cluster, &vmss.VirtualMachineScaleSet, args.Force, vmssClient, cred); err != nil {
+		return nil, err
+	}
+
+	var capacity int64
+	if vmss.SKU != nil && vmss.SKU.Capacity != nil {
+		capacity = *vmss.SKU.Capacity
+	}
+	plan := []string{
+		fmt.Sprintf("VMSS %s with %d instance(s)", vmssName, capacity),
+		fmt.Sprintf("Load balancer backend pool %s", rule.BackendPoolName(args.Name)),
+	}
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+		network, err := getClusterNetwork(ctx, args.SubscriptionID, args.Cluster, cred)
+		if err != nil {
+			return nil, err
+		}
+		if hasAPIPoolIPv6(network, true) {
+			plan = append(plan, fmt.Sprintf("Load balancer backend pool %s", rule.BackendPoolNameIPv6(args.Name)))
+		}
+	}
+	if v, ok := vmss.Tags[clusternet.PoolSubnetTag]; ok && v != nil {
+		plan = append(plan, fmt.Sprintf("Subnet %s", (*v)[strings.LastIndex(*v, "/")+1:]))
+	}
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+		plan = append(plan, "The cluster control plane, including etcd and the Kubernetes API server")
+	}
+	return plan, nil
+}
+
+// hasAPIPoolIPv6 reports whether a pool has an IPv6 backend pool on the API load balancer. Only
+// control-plane pools of public dual-stack clusters serve the API server over IPv6.
+func hasAPIPoolIPv6(network clusterNetwork, controlPlane bool) bool {
+	return controlPlane && network.DualStack && !network.Private
+}
+
+// checkPoolDeletable refuses protected pools and, unless force is set, the control-plane pool while
+// worker pools still depend on it
+func checkPoolDeletable(ctx context.Context, subscriptionID, cluster string, vmss *armcompute.VirtualMachineScaleSet, force bool, vmssClient *armcompute.VirtualMachineScaleSetsClient, cred *azidentity.DefaultAzureCredential) error {
+	if err := protect.Check(ctx, subscriptionID, cluster, *vmss.ID, "pool", vmss.Tags, cred); err != nil {
+		return err
+	}
+	if v, ok := vmss.Tags["k3a"]; !ok || v == nil || *v != "control-plane" || force {
+		return nil
+	}
+	var workers []string
+	pager := vmssClient.NewListPager(cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list VMSS: %w", err)
+		}
+		for _, other := range page.Value {
+			if other.Name == nil || *other.Name == *vmss.Name {
+				continue
+			}
+			if v, ok := other.Tags["k3a"]; ok && v != nil && *v != "control-plane" {
+				workers = append(workers, strings.TrimSuffix(*other.Name, "-vmss"))
+			}
+		}
+	}
+	if len(workers) > 0 {
+		return fmt.Errorf("refusing to delete the control-plane pool while worker pools exist (%s); delete them first or pass --force", strings.Join(workers, ", "))
+	}
+	return nil
+}
+
+// DeleteInstancePlan checks that the instance can be deleted and returns what deleting it would destroy
+func DeleteInstancePlan(args DeleteInstanceArgs) ([]string, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmssName := args.PoolName + "-vmss"
+	vmss, err := vmssClient.Get(ctx, args.Cluster, vmssName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	if err := protect.Check(ctx, args.SubscriptionID, args.Cluster, *vmss.ID, "pool", vmss.Tags, cred); err != nil {
+		return nil, err
+	}
+	vmssVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(args.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMSS VMs client: %w", err)
+	}
+	vm, err := vmssVMsClient.Get(ctx, args.Cluster, vmssName, args.InstanceID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VMSS instance '%s': %w", args.InstanceID, err)
+	}
+	instance := args.InstanceID
+	if vm.Name != nil {
+		instance = fmt.Sprintf("%s (node %s)", *vm.Name, instanceNodeName(*vm.Name))
+	}
+	plan := []string{fmt.Sprintf("VMSS instance %s and its disks", instance)}
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+		plan = append(plan, "Its etcd member and Node object")
+	}
+	return plan, nil
+}
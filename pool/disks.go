@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+)
+
+const dataDiskMountTag = "k3a-data-disk-mount"
+
+// DataDisk describes a managed data disk attached to every instance in a pool
+type DataDisk struct {
+	SizeGB  int
+	SKU     string // Standard_LRS, StandardSSD_LRS or Premium_LRS
+	Caching string // None, ReadOnly or ReadWrite
+}
+
+// ParseDataDisk parses a data disk spec such as "size=128,sku=Premium_LRS,caching=ReadOnly"
+func ParseDataDisk(spec string) (DataDisk, error) {
+	disk := DataDisk{
+		SKU:     string(armcompute.StorageAccountTypesPremiumLRS),
+		Caching: string(armcompute.CachingTypesReadOnly),
+	}
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return DataDisk{}, fmt.Errorf("invalid data disk field '%s' in '%s' (expected key=value)", field, spec)
+		}
+		switch key {
+		case "size":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return DataDisk{}, fmt.Errorf("invalid data disk size '%s': %w", value, err)
+			}
+			disk.SizeGB = size
+		case "sku":
+			disk.SKU = value
+		case "caching":
+			disk.Caching = value
+		default:
+			return DataDisk{}, fmt.Errorf("unknown data disk field '%s' (must be size, sku or caching)", key)
+		}
+	}
+	if disk.SizeGB < 1 {
+		return DataDisk{}, fmt.Errorf("data disk '%s' requires a size greater than 0", spec)
+	}
+	if err := validateDiskSKU(disk.SKU); err != nil {
+		return DataDisk{}, err
+	}
+	switch armcompute.CachingTypes(disk.Caching) {
+	case armcompute.CachingTypesNone, armcompute.CachingTypesReadOnly, armcompute.CachingTypesReadWrite:
+	default:
+		return DataDisk{}, fmt.Errorf("invalid data disk caching '%s' (must be None, ReadOnly or ReadWrite)", disk.Caching)
+	}
+	return disk, nil
+}
+
+// validateDiskSKU checks a managed disk SKU supported by VMSS pools
+func validateDiskSKU(sku string) error {
+	switch armcompute.StorageAccountTypes(sku) {
+	case armcompute.StorageAccountTypesStandardLRS, armcompute.StorageAccountTypesStandardSSDLRS, armcompute.StorageAccountTypesPremiumLRS:
+		return nil
+	}
+	return fmt.Errorf("invalid disk SKU '%s' (must be Standard_LRS, StandardSSD_LRS or Premium_LRS)", sku)
+}
+
+// buildDataDisks returns the VMSS data disks, attached from LUN 0 in order
+func buildDataDisks(dataDisks []DataDisk) []*armcompute.VirtualMachineScaleSetDataDisk {
+	var disks []*armcompute.VirtualMachineScaleSetDataDisk
+	for i, disk := range dataDisks {
+		disks = append(disks, &armcompute.VirtualMachineScaleSetDataDisk{
+			Lun:          to.Ptr(int32(i)),
+			CreateOption: to.Ptr(armcompute.DiskCreateOptionTypesEmpty),
+			DiskSizeGB:   to.Ptr(int32(disk.SizeGB)),
+			Caching:      to.Ptr(armcompute.CachingTypes(disk.Caching)),
+			ManagedDisk: &armcompute.VirtualMachineScaleSetManagedDiskParameters{
+				StorageAccountType: to.Ptr(armcompute.StorageAccountTypes(disk.SKU)),
+			},
+		})
+	}
+	return disks
+}
@@ -0,0 +1,83 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/clusternet"
+)
+
+// checkSNATCapacity refuses to grow a pool past the number of instances the load balancer outbound rules
+// can give SNAT ports to. capacity is the pool's new instance count; the other pools' counts are added to it.
+// Dual-stack clusters are limited by whichever of the IPv4 and IPv6 rules has fewer frontend IPs.
+func checkSNATCapacity(ctx context.Context, subscriptionID, cluster, vmssName string, capacity int64, network clusterNetwork, cred *azidentity.DefaultAzureCredential) error {
+	if network.Egress != clusternet.EgressLoadBalancer || network.SNATPorts <= 0 {
+		return nil
+	}
+	outboundIPs := network.OutboundIPs
+	family := ""
+	if network.DualStack {
+		ipv6IPs, err := countOutboundFrontendsIPv6(ctx, subscriptionID, cluster, network.PublicLBName, cred)
+		if err != nil {
+			return err
+		}
+		if ipv6IPs < outboundIPs {
+			outboundIPs, family = ipv6IPs, "IPv6 "
+		}
+	}
+	maxInstances := int64(outboundIPs * clusternet.PortsPerFrontendIP / network.SNATPorts)
+
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	total := capacity
+	pager := vmssClient.NewListPager(cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list VMSS: %w", err)
+		}
+		for _, vmss := range page.Value {
+			if vmss.Name == nil || *vmss.Name == vmssName || vmss.SKU == nil || vmss.SKU.Capacity == nil {
+				continue
+			}
+			total += *vmss.SKU.Capacity
+		}
+	}
+
+	if total > maxInstances {
+		return fmt.Errorf("cluster would have %d instances but the %soutbound rule only has SNAT ports for %d (%d outbound IPs * %d ports / %d ports per instance); recreate the cluster with more --outbound-ips, fewer --snat-ports-per-instance or --egress nat-gateway",
+			total, family, maxInstances, outboundIPs, clusternet.PortsPerFrontendIP, network.SNATPorts)
+	}
+	if total*10 > maxInstances*9 {
+		fmt.Printf("Warning: cluster will use SNAT ports for %d of %d possible instances\n", total, maxInstances)
+	}
+	return nil
+}
+
+// countOutboundFrontendsIPv6 returns the number of IPv6 outbound frontends on the load balancer. Clusters
+// created before IPv6 egress got one IP per IPv4 outbound IP have a single one.
+func countOutboundFrontendsIPv6(ctx context.Context, subscriptionID, cluster, lbName string, cred *azidentity.DefaultAzureCredential) (int, error) {
+	lbClient, err := armnetwork.NewLoadBalancersClient(subscriptionID, cred, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create load balancer client: %w", err)
+	}
+	lb, err := lbClient.Get(ctx, cluster, lbName, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get load balancer: %w", err)
+	}
+	count := 0
+	if lb.Properties != nil {
+		for _, fe := range lb.Properties.FrontendIPConfigurations {
+			if fe.Name != nil && strings.HasPrefix(*fe.Name, clusternet.OutboundFrontendIPv6) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+)
+
+// K8sVersionTag records the Kubernetes version of a pool VMSS, and of an image built by 'k3a image build'
+const K8sVersionTag = "k3a-k8s-version"
+
+// imageK8sVersion returns the Kubernetes version baked into a pre-baked image, read from its
+// K8sVersionTag. Nodes from a pre-baked image skip installing Kubernetes, so an untagged image is refused.
+func imageK8sVersion(ctx context.Context, imageID string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	id, err := arm.ParseResourceID(imageID)
+	if err != nil {
+		return "", fmt.Errorf("invalid image ID '%s': %w", imageID, err)
+	}
+	var tags map[string]*string
+	switch {
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/galleries/images/versions") && id.Parent != nil && id.Parent.Parent != nil:
+		client, err := armcompute.NewGalleryImageVersionsClient(id.SubscriptionID, cred, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create gallery image versions client: %w", err)
+		}
+		resp, err := client.Get(ctx, id.ResourceGroupName, id.Parent.Parent.Name, id.Parent.Name, id.Name, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to get image version '%s': %w", imageID, err)
+		}
+		tags = resp.Tags
+	case strings.EqualFold(id.ResourceType.String(), "Microsoft.Compute/images"):
+		client, err := armcompute.NewImagesClient(id.SubscriptionID, cred, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create images client: %w", err)
+		}
+		resp, err := client.Get(ctx, id.ResourceGroupName, id.Name, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to get image '%s': %w", imageID, err)
+		}
+		tags = resp.Tags
+	default:
+		return "", fmt.Errorf("image '%s' is neither a gallery image version nor a managed image", imageID)
+	}
+	if v, ok := tags[K8sVersionTag]; ok && v != nil && *v != "" {
+		return *v, nil
+	}
+	return "", fmt.Errorf("image '%s' has no %s tag recording its Kubernetes version; build it with 'k3a image build' or tag it", imageID, K8sVersionTag)
+}
+
+// checkImageK8sVersion returns the Kubernetes version of a pre-baked image, refusing a k8sVersion
+// that differs from it. An empty k8sVersion takes the image's version.
+func checkImageK8sVersion(ctx context.Context, imageID, k8sVersion string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	imageVersion, err := imageK8sVersion(ctx, imageID, cred)
+	if err != nil {
+		return "", err
+	}
+	if k8sVersion != "" && strings.TrimPrefix(k8sVersion, "v") != strings.TrimPrefix(imageVersion, "v") {
+		return "", fmt.Errorf("--k8s-version %s does not match Kubernetes %s baked into image '%s'", k8sVersion, imageVersion, imageID)
+	}
+	return imageVersion, nil
+}
@@ -0,0 +1,185 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/jwilder/k3a/pkg/kube"
+)
+
+// Join commands are stored in the cluster Key Vault. The bootstrap token in them expires after
+// joinTokenTTL and the certificate key control-plane joins use after 2h, so each secret carries its
+// expiry in the joinExpiresTag tag.
+const (
+	joinExpiresTag    = "k3a-expires"
+	joinTokenTTL      = 24 * time.Hour
+	certificateKeyTTL = 2 * time.Hour
+	// joinRefreshMargin is how long a stored join command must stay valid for new instances to boot and join
+	joinRefreshMargin = time.Hour
+)
+
+func workerJoinSecretName(cluster string) string {
+	return fmt.Sprintf("%s-worker-join", cluster)
+}
+
+func masterJoinSecretName(cluster string) string {
+	return fmt.Sprintf("%s-master-join", cluster)
+}
+
+// joinExpiryTags returns the secret tags recording when a join command expires
+func joinExpiryTags(expires time.Time) map[string]*string {
+	return map[string]*string{joinExpiresTag: to.Ptr(expires.UTC().Format(time.RFC3339))}
+}
+
+type RotateJoinArgs struct {
+	SubscriptionID string
+	Cluster        string
+}
+
+// RotateJoin mints a new bootstrap token and certificate key on a control-plane node and stores fresh
+// worker and control-plane join commands in the cluster Key Vault
+func RotateJoin(args RotateJoinArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	return rotateJoin(context.Background(), args.SubscriptionID, args.Cluster, cred)
+}
+
+func rotateJoin(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) error {
+	runner, err := NewKubectlRunner(ctx, subscriptionID, cluster, cred, nil)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	output, err := runner.RunScript(fmt.Sprintf("kubeadm token create --ttl %s --print-join-command", joinTokenTTL))
+	if err != nil {
+		return fmt.Errorf("failed to create join token: %w", err)
+	}
+	workerJoin := joinCommandLine(output)
+	if workerJoin == "" {
+		return fmt.Errorf("kubeadm printed no join command: %s", strings.TrimSpace(output))
+	}
+	// stderr is kept so kubeadm's errors reach the caller; warnings are skipped by certificateKeyLine
+	output, err = runner.RunScript("set -o pipefail\nkubeadm init phase upload-certs --upload-certs | tail -1\n")
+	if err != nil {
+		return fmt.Errorf("failed to upload control-plane certificates: %w", err)
+	}
+	certKey := certificateKeyLine(output)
+	if certKey == "" {
+		return fmt.Errorf("kubeadm printed no certificate key: %s", strings.TrimSpace(output))
+	}
+
+	client, err := newKeyVaultSecretsClient(cluster, cred)
+	if err != nil {
+		return err
+	}
+	// Keep the endpoint of the current join command; the first master points it at its internal IP
+	if current, err := client.GetSecret(ctx, workerJoinSecretName(cluster), "", nil); err == nil && current.Value != nil {
+		workerJoin = withJoinEndpoint(workerJoin, *current.Value)
+	}
+
+	now := time.Now()
+	masterJoin := fmt.Sprintf("%s --control-plane --certificate-key %s", workerJoin, certKey)
+	for _, secret := range []struct {
+		name, value string
+		expires     time.Time
+	}{
+		{workerJoinSecretName(cluster), workerJoin, now.Add(joinTokenTTL)},
+		{masterJoinSecretName(cluster), masterJoin, now.Add(certificateKeyTTL)},
+	} {
+		if _, err := client.SetSecret(ctx, secret.name, azsecrets.SetSecretParameters{
+			Value: to.Ptr(secret.value),
+			Tags:  joinExpiryTags(secret.expires),
+		}, nil); err != nil {
+			return fmt.Errorf("failed to store secret '%s': %w", secret.name, err)
+		}
+	}
+	fmt.Printf("Join commands rotated on %s: worker join valid until %s, control-plane join until %s\n",
+		runner.Host, now.Add(joinTokenTTL).Format(time.RFC1123), now.Add(certificateKeyTTL).Format(time.RFC1123))
+	return nil
+}
+
+// refreshJoinIfExpiring rotates the join commands when the one new instances of role use expires within
+// joinRefreshMargin. Secrets without an expiry tag predate it and are treated as expired. A cluster
+// without join secrets has no control plane yet, so there is nothing to refresh.
+func refreshJoinIfExpiring(ctx context.Context, subscriptionID, cluster, role string, cred *azidentity.DefaultAzureCredential) error {
+	name := workerJoinSecretName(cluster)
+	if role == "control-plane" {
+		name = masterJoinSecretName(cluster)
+	}
+	client, err := newKeyVaultSecretsClient(cluster, cred)
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetSecret(ctx, name, "", nil)
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to get secret '%s': %w", name, err)
+	}
+	if v, ok := resp.Tags[joinExpiresTag]; ok && v != nil {
+		if expires, err := time.Parse(time.RFC3339, *v); err == nil && time.Until(expires) > joinRefreshMargin {
+			return nil
+		}
+	}
+	fmt.Printf("Join command in '%s' has expired or expires soon, rotating...\n", name)
+	if err := rotateJoin(ctx, subscriptionID, cluster, cred); err != nil {
+		return fmt.Errorf("failed to refresh join commands: %w", err)
+	}
+	return nil
+}
+
+func newKeyVaultSecretsClient(cluster string, cred *azidentity.DefaultAzureCredential) (*azsecrets.Client, error) {
+	client, err := azsecrets.NewClient(fmt.Sprintf("https://%s.vault.azure.net/", kube.KeyVaultName(cluster)), cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+	return client, nil
+}
+
+// joinCommandLine returns the kubeadm join command from kubeadm output that may include warnings
+func joinCommandLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "kubeadm join ") {
+			return line
+		}
+	}
+	return ""
+}
+
+// certificateKeyPattern matches the 32-byte hex certificate key printed by kubeadm upload-certs
+var certificateKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// certificateKeyLine returns the certificate key from kubeadm upload-certs output that may include warnings
+func certificateKeyLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); certificateKeyPattern.MatchString(line) {
+			return line
+		}
+	}
+	return ""
+}
+
+// withJoinEndpoint replaces the API server endpoint of a join command with the one in current
+func withJoinEndpoint(join, current string) string {
+	fields := strings.Fields(join)
+	currentFields := strings.Fields(current)
+	if len(fields) < 3 || len(currentFields) < 3 || currentFields[1] != "join" {
+		return join
+	}
+	fields[2] = currentFields[2]
+	return strings.Join(fields, " ")
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/jwilder/k3a/pkg/cidr"
+	"github.com/jwilder/k3a/pkg/clusternet"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -21,6 +23,8 @@ type KubeadmInstaller struct {
 	keyVaultName   string
 	sshClient      *ssh.Client
 	credential     *azidentity.DefaultAzureCredential
+	nodeLabels     []string
+	nodeTaints     []string
 }
 
 // NewKubeadmInstaller creates a new kubeadm installer
@@ -34,6 +38,41 @@ func NewKubeadmInstaller(subscriptionID, cluster, keyVaultName string, sshClient
 	}
 }
 
+// SetNodeRegistration sets the labels and taints the node registers with when it joins
+func (k *KubeadmInstaller) SetNodeRegistration(labels, taints []string) {
+	k.nodeLabels = labels
+	k.nodeTaints = taints
+}
+
+// nodeRegistrationConfig renders the kubeadm nodeRegistration section for a control-plane node's labels
+// and taints. Setting taints replaces kubeadm's defaults, so the control-plane taint is kept explicitly.
+func (k *KubeadmInstaller) nodeRegistrationConfig() string {
+	if len(k.nodeLabels) == 0 && len(k.nodeTaints) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("nodeRegistration:\n")
+	if len(k.nodeLabels) > 0 {
+		b.WriteString("  kubeletExtraArgs:\n")
+		b.WriteString("  - name: node-labels\n")
+		fmt.Fprintf(&b, "    value: \"%s\"\n", strings.Join(k.nodeLabels, ","))
+	}
+	b.WriteString("  taints:\n")
+	b.WriteString("  - key: node-role.kubernetes.io/control-plane\n")
+	b.WriteString("    effect: NoSchedule\n")
+	for _, taint := range k.nodeTaints {
+		keyValue, effect, _ := strings.Cut(taint, ":")
+		key, value, _ := strings.Cut(keyValue, "=")
+		fmt.Fprintf(&b, "  - key: \"%s\"\n", key)
+		if value != "" {
+			fmt.Fprintf(&b, "    value: \"%s\"\n", value)
+		}
+		fmt.Fprintf(&b, "    effect: %s\n", effect)
+	}
+	return b.String()
+}
+
 // executeCommand executes a command over SSH and returns the output
 func (k *KubeadmInstaller) executeCommand(command string) (string, error) {
 	session, err := k.sshClient.NewSession()
@@ -73,13 +112,13 @@ func (k *KubeadmInstaller) waitForSecretInKeyVault(ctx context.Context, secretNa
 }
 
 // storeSecretInKeyVault stores a secret in Key Vault
-func (k *KubeadmInstaller) storeSecretInKeyVault(ctx context.Context, secretName, secretValue string) error {
+func (k *KubeadmInstaller) storeSecretInKeyVault(ctx context.Context, secretName, secretValue string, tags map[string]*string) error {
 	client, err := azsecrets.NewClient(fmt.Sprintf("https://%s.vault.azure.net/", k.keyVaultName), k.credential, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create Key Vault client: %w", err)
 	}
 
-	_, err = client.SetSecret(ctx, secretName, azsecrets.SetSecretParameters{Value: &secretValue}, nil)
+	_, err = client.SetSecret(ctx, secretName, azsecrets.SetSecretParameters{Value: &secretValue, Tags: tags}, nil)
 	if err != nil {
 		// Check if it's a soft-delete conflict error
 		if strings.Contains(err.Error(), "ObjectIsDeletedButRecoverable") {
@@ -94,7 +133,7 @@ func (k *KubeadmInstaller) storeSecretInKeyVault(ctx context.Context, secretName
 			time.Sleep(2 * time.Second)
 
 			// Retry storing the secret
-			_, err = client.SetSecret(ctx, secretName, azsecrets.SetSecretParameters{Value: &secretValue}, nil)
+			_, err = client.SetSecret(ctx, secretName, azsecrets.SetSecretParameters{Value: &secretValue, Tags: tags}, nil)
 			if err != nil {
 				return fmt.Errorf("failed to store secret '%s' after purge attempt: %w", secretName, err)
 			}
@@ -585,6 +624,27 @@ func (k *KubeadmInstaller) InstallAsFirstMaster(ctx context.Context) error {
 		region = "canadacentral" // fallback
 	}
 	dnsName := fmt.Sprintf("%s.%s.cloudapp.azure.com", k.cluster, region)
+	// Private clusters expose the API server on a name in the cluster's private DNS zone
+	network, err := getClusterNetwork(ctx, k.subscriptionID, k.cluster, k.credential)
+	if err != nil {
+		return err
+	}
+	if network.APIServerName != "" {
+		dnsName = network.APIServerName
+	}
+	// Dual-stack clusters list an IPv6 range after each IPv4 one
+	cidrs := network.cidrs()
+	podSubnet, serviceSubnet, nodeCIDRMaskSizeIPv6 := cidrs.Pod, cidrs.Service, ""
+	if network.DualStack {
+		podSubnet += "," + cidrs.PodV6
+		serviceSubnet += "," + cidrs.ServiceV6
+		nodeCIDRMaskSizeIPv6 = fmt.Sprintf("  - name: node-cidr-mask-size-ipv6\n    value: \"%d\"\n", cidr.NodeCIDRMaskSizeIPv6)
+	}
+	// Public dual-stack clusters also serve the API server on the DNS name of their IPv6 public IP
+	ipv6SAN := ""
+	if network.DualStack && !network.Private {
+		ipv6SAN = fmt.Sprintf("  - \"%s%s.%s.cloudapp.azure.com\"\n", k.cluster, clusternet.DNSLabelIPv6Suffix, region)
+	}
 	// Use internal IP for control plane endpoint to avoid external load balancer dependency
 	controlPlaneEndpoint := fmt.Sprintf("%s:6443", internalIP)
 	fmt.Printf("Using internal IP control plane endpoint: %s\n", controlPlaneEndpoint)
@@ -605,13 +665,13 @@ kind: ClusterConfiguration
 kubernetesVersion: v1.33.1
 controlPlaneEndpoint: "%s"
 networking:
-  podSubnet: "16.0.0.0/5"
-  serviceSubnet: "172.20.0.0/16"
+  podSubnet: "`+podSubnet+`"
+  serviceSubnet: "`+serviceSubnet+`"
 apiServer:
   certSANs:
   - "%s"
   - "%s"
-  extraArgs:
+`+ipv6SAN+`  extraArgs:
   - name: max-requests-inflight
     value: "400"
   - name: max-mutating-requests-inflight
@@ -621,11 +681,11 @@ apiServer:
 controllerManager:
   extraArgs:
   - name: cluster-cidr
-    value: "16.0.0.0/5"
+    value: "`+podSubnet+`"
   - name: node-cidr-mask-size-ipv4
     value: "21"
-  - name: service-cluster-ip-range
-    value: "172.20.0.0/16"
+`+nodeCIDRMaskSizeIPv6+`  - name: service-cluster-ip-range
+    value: "`+serviceSubnet+`"
   - name: kube-api-qps
     value: "300"
   - name: kube-api-burst
@@ -646,7 +706,7 @@ kind: InitConfiguration
 localAPIEndpoint:
   advertiseAddress: "%s"
   bindPort: 6443
----
+%s---
 apiVersion: kubelet.config.k8s.io/v1beta1
 kind: KubeletConfiguration
 maxPods: 300
@@ -660,7 +720,7 @@ clientConnection:
 percentageOfNodesToScore: 1
 profiles:
   - schedulerName: default-scheduler
-`, controlPlaneEndpoint, internalIP, dnsName, internalIP)
+`, controlPlaneEndpoint, internalIP, dnsName, internalIP, k.nodeRegistrationConfig())
 
 	// Write kubeadm config to temporary file
 	configCmd := fmt.Sprintf("cat > /tmp/kubeadm-config.yaml << 'EOF'\n%s\nEOF", kubeadmConfig)
@@ -704,13 +764,17 @@ profiles:
 	// Replace the internal IP with load balancer public IP in kubeconfig
 	externalEndpoint := fmt.Sprintf("%s:6443", dnsName)
 	modifiedKubeconfig := strings.ReplaceAll(kubeconfigOutput, fmt.Sprintf("https://%s:6443", internalIP), fmt.Sprintf("https://%s", externalEndpoint))
-	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-kubeconfig", k.cluster), modifiedKubeconfig); err != nil {
+	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-kubeconfig", k.cluster), modifiedKubeconfig, nil); err != nil {
 		return err
 	}
 	fmt.Println("Kubeconfig stored in Key Vault with load balancer endpoint")
 
 	// Create custom Flannel manifest on the remote machine
 	fmt.Println("Creating custom Flannel configuration...")
+	flannelIPv6 := ""
+	if network.DualStack {
+		flannelIPv6 = fmt.Sprintf("\"EnableIPv6\": true,\n      \"IPv6Network\": \"%s\",\n      ", cidr.PodCIDRv6)
+	}
 	flannelManifest := `---
 apiVersion: v1
 kind: Namespace
@@ -810,8 +874,8 @@ data:
     }
   net-conf.json: |
     {
-      "Network": "16.0.0.0/5",
-      "EnableNFTables": false,
+      "Network": "` + cidr.PodCIDR + `",
+      ` + flannelIPv6 + `"EnableNFTables": false,
       "Backend": {
         "Type": "vxlan"
       }
@@ -993,7 +1057,8 @@ spec:
 	fmt.Println("Generating and storing join tokens...")
 
 	// Worker join command
-	workerJoinOutput, err := k.executeCommand("sudo kubeadm token create --print-join-command 2>/dev/null")
+	joinCreatedAt := time.Now()
+	workerJoinOutput, err := k.executeCommand(fmt.Sprintf("sudo kubeadm token create --ttl %s --print-join-command 2>/dev/null", joinTokenTTL))
 	if err != nil {
 		return fmt.Errorf("failed to generate worker join token: %w", err)
 	}
@@ -1005,7 +1070,7 @@ spec:
 	internalEndpoint := fmt.Sprintf("%s:6443", internalIP)
 	workerJoinForCluster := strings.ReplaceAll(workerJoin, dnsEndpoint, internalEndpoint)
 
-	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-worker-join", k.cluster), workerJoinForCluster); err != nil {
+	if err := k.storeSecretInKeyVault(ctx, workerJoinSecretName(k.cluster), workerJoinForCluster, joinExpiryTags(joinCreatedAt.Add(joinTokenTTL))); err != nil {
 		return err
 	}
 
@@ -1016,13 +1081,13 @@ spec:
 	}
 	certKey := strings.TrimSpace(certKeyOutput)
 	masterJoin := fmt.Sprintf("%s --control-plane --certificate-key %s", workerJoinForCluster, certKey)
-	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-master-join", k.cluster), masterJoin); err != nil {
+	if err := k.storeSecretInKeyVault(ctx, masterJoinSecretName(k.cluster), masterJoin, joinExpiryTags(joinCreatedAt.Add(certificateKeyTTL))); err != nil {
 		return err
 	}
 
 	// Store API server endpoint (use load balancer public IP for external access)
 	apiEndpoint := externalEndpoint // Use external DNS name for client access
-	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-api-endpoint", k.cluster), apiEndpoint); err != nil {
+	if err := k.storeSecretInKeyVault(ctx, fmt.Sprintf("%s-api-endpoint", k.cluster), apiEndpoint, nil); err != nil {
 		return err
 	}
 
@@ -1083,6 +1148,19 @@ func (k *KubeadmInstaller) InstallAsAdditionalMaster(ctx context.Context) error
 
 	// Execute join (kubeadm will perform download-certs if certificate-key present)
 	joinCommand := fmt.Sprintf("sudo bash -c \"%s\"", strings.ReplaceAll(cleanedMasterJoin, "\"", "\\\""))
+	if nodeRegistration := k.nodeRegistrationConfig(); nodeRegistration != "" {
+		// Labels and taints can only be passed through a JoinConfiguration, which can't be mixed with join flags
+		joinConfig, err := joinConfigurationFromCommand(masterJoin, nodeRegistration)
+		if err != nil {
+			return err
+		}
+		configCmd := fmt.Sprintf("cat > /tmp/kubeadm-join.yaml << 'EOF'\n%s\nEOF", joinConfig)
+		if _, err := k.executeCommand(configCmd); err != nil {
+			return fmt.Errorf("failed to create kubeadm join config file: %w", err)
+		}
+		defer k.executeCommand("rm -f /tmp/kubeadm-join.yaml")
+		joinCommand = "sudo kubeadm join --config=/tmp/kubeadm-join.yaml --ignore-preflight-errors=all"
+	}
 	fmt.Printf("Executing join command: %s\n", joinCommand)
 	output, err2 := k.executeCommand(joinCommand)
 	if err2 != nil {
@@ -1152,6 +1230,17 @@ func (k *KubeadmInstaller) InstallAsWorker(ctx context.Context) error {
 	// Replace multiple spaces with single space
 	cleanedWorkerJoin = strings.Join(strings.Fields(cleanedWorkerJoin), " ")
 
+	if len(k.nodeLabels) > 0 || len(k.nodeTaints) > 0 {
+		// Same kubelet flags cloud-init writes for worker pools
+		kubeletArgs := "--node-labels=" + strings.Join(k.nodeLabels, ",")
+		if len(k.nodeTaints) > 0 {
+			kubeletArgs += " --register-with-taints=" + strings.Join(k.nodeTaints, ",")
+		}
+		if _, err := k.executeCommand(fmt.Sprintf("echo 'KUBELET_EXTRA_ARGS=%s' | sudo tee /etc/sysconfig/kubelet", kubeletArgs)); err != nil {
+			return fmt.Errorf("failed to configure kubelet labels and taints: %w", err)
+		}
+	}
+
 	joinCommand := fmt.Sprintf("sudo %s", cleanedWorkerJoin)
 	_, err = k.executeCommand(joinCommand)
 	if err != nil {
@@ -1162,11 +1251,72 @@ func (k *KubeadmInstaller) InstallAsWorker(ctx context.Context) error {
 	return nil
 }
 
+// joinConfigurationFromCommand converts a "kubeadm join" command into an equivalent JoinConfiguration
+func joinConfigurationFromCommand(joinCommand, nodeRegistration string) (string, error) {
+	fields := strings.Fields(joinCommand)
+	var endpoint, token, caCertHash, certificateKey string
+	controlPlane := false
+	for i := 0; i < len(fields); i++ {
+		next := ""
+		if i+1 < len(fields) {
+			next = fields[i+1]
+		}
+		switch fields[i] {
+		case "join":
+			endpoint = next
+			i++
+		case "--token":
+			token = next
+			i++
+		case "--discovery-token-ca-cert-hash":
+			caCertHash = next
+			i++
+		case "--certificate-key":
+			certificateKey = next
+			i++
+		case "--control-plane":
+			controlPlane = true
+		}
+	}
+	if endpoint == "" || token == "" || caCertHash == "" {
+		return "", fmt.Errorf("invalid join command format")
+	}
+
+	var b strings.Builder
+	b.WriteString("apiVersion: kubeadm.k8s.io/v1beta4\n")
+	b.WriteString("kind: JoinConfiguration\n")
+	b.WriteString("discovery:\n")
+	b.WriteString("  bootstrapToken:\n")
+	fmt.Fprintf(&b, "    apiServerEndpoint: \"%s\"\n", endpoint)
+	fmt.Fprintf(&b, "    token: \"%s\"\n", token)
+	b.WriteString("    caCertHashes:\n")
+	fmt.Fprintf(&b, "    - \"%s\"\n", caCertHash)
+	if controlPlane {
+		b.WriteString("controlPlane:\n")
+		if certificateKey != "" {
+			fmt.Fprintf(&b, "  certificateKey: \"%s\"\n", certificateKey)
+		} else {
+			b.WriteString("  {}\n")
+		}
+	}
+	b.WriteString(nodeRegistration)
+	return b.String(), nil
+}
+
+// defaultPrivateKeyPath returns the SSH private key used to reach nodes: K3A_SSH_PRIVATE_KEY, which the
+// current k3a context can provide, or ~/.ssh/id_rsa
+func defaultPrivateKeyPath() string {
+	if v := os.Getenv("K3A_SSH_PRIVATE_KEY"); v != "" {
+		return v
+	}
+	return filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
+}
+
 // CreateSSHClient creates an SSH client connection to the target VM via load balancer NAT
 func CreateSSHClientViaNAT(lbPublicIP string, natPort int, username, privateKeyPath string) (*ssh.Client, error) {
 	// Read private key
 	if privateKeyPath == "" {
-		privateKeyPath = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
+		privateKeyPath = defaultPrivateKeyPath()
 	}
 
 	privateKeyBytes, err := os.ReadFile(privateKeyPath)
@@ -1206,7 +1356,7 @@ func CreateSSHClientViaNAT(lbPublicIP string, natPort int, username, privateKeyP
 func CreateSSHClient(host, username, privateKeyPath string) (*ssh.Client, error) {
 	// Read private key
 	if privateKeyPath == "" {
-		privateKeyPath = filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa")
+		privateKeyPath = defaultPrivateKeyPath()
 	}
 
 	privateKeyBytes, err := os.ReadFile(privateKeyPath)
@@ -5,7 +5,7 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	kstrings "github.com/jwilder/k3a/pkg/strings"
+	"github.com/jwilder/k3a/pkg/kube"
 )
 
 type KubeadmInstallArgs struct {
@@ -43,9 +43,12 @@ func KubeadmInstall(args KubeadmInstallArgs) error {
 
 	fmt.Printf("Found %d instances in VMSS %s\n", len(instances), vmssName)
 
-	clusterHash := kstrings.UniqueString(args.Cluster)
-	keyVaultName := fmt.Sprintf("k3akv%s", clusterHash)
-	lbName := fmt.Sprintf("k3alb%s", clusterHash)
+	keyVaultName := kube.KeyVaultName(args.Cluster)
+	network, err := getClusterNetwork(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	lbName := network.APILBName
 
 	// Get load balancer public IP for SSH access
 	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, lbName)
@@ -67,6 +70,12 @@ func KubeadmInstall(args KubeadmInstallArgs) error {
 
 	fmt.Printf("Determined node type: %s\n", nodeType)
 
+	// Labels and taints requested at pool creation are stored as VMSS tags
+	labels, taints, err := getPoolNodeRegistration(ctx, args.SubscriptionID, args.Cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+
 	// For control-plane, we process instances sequentially:
 	// - First instance as first-master (if cluster doesn't exist) or additional master
 	// - Remaining instances as additional masters
@@ -97,6 +106,7 @@ func KubeadmInstall(args KubeadmInstallArgs) error {
 
 		// Create kubeadm installer
 		installer := NewKubeadmInstaller(args.SubscriptionID, args.Cluster, keyVaultName, sshClient, cred)
+		installer.SetNodeRegistration(labels, taints)
 
 		// Install based on node type
 		switch nodeType {
@@ -145,6 +155,7 @@ func KubeadmInstall(args KubeadmInstallArgs) error {
 
 			// Create kubeadm installer
 			installer := NewKubeadmInstaller(args.SubscriptionID, args.Cluster, keyVaultName, sshClient, cred)
+			installer.SetNodeRegistration(labels, taints)
 
 			if err := installer.InstallAsAdditionalMaster(ctx); err != nil {
 				return fmt.Errorf("failed to install additional master on %s: %w", instance.Name, err)
@@ -0,0 +1,188 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"golang.org/x/crypto/ssh"
+)
+
+// KubectlRunner runs kubectl on a control-plane instance reached through the load balancer SSH NAT
+type KubectlRunner struct {
+	Host      string
+	sshClient *ssh.Client
+}
+
+// NewKubectlRunner connects to the first reachable control-plane instance whose node name is not in exclude
+func NewKubectlRunner(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential, exclude []string) (*KubectlRunner, error) {
+	vmssName, err := getControlPlaneVMSSName(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+	lbName := network.APILBName
+
+	vmssManager := NewVMSSManager(subscriptionID, cluster, cred)
+	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, lbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get load balancer public IP: %w", err)
+	}
+	natPortMappings, err := vmssManager.GetVMSSNATPortMappings(ctx, vmssName, lbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NAT port mappings: %w", err)
+	}
+
+	hostnames, err := getInstanceNodeNames(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool)
+	for _, name := range exclude {
+		skip[strings.ToLower(name)] = true
+	}
+
+	var lastErr error
+	for instanceName, natPort := range natPortMappings {
+		hostname := hostnames[instanceName]
+		if skip[strings.ToLower(hostname)] {
+			continue
+		}
+		sshClient, err := CreateSSHClientViaNAT(lbPublicIP, natPort, "azureuser", "")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return &KubectlRunner{Host: hostname, sshClient: sshClient}, nil
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to connect to a control-plane instance: %w", lastErr)
+	}
+	return nil, fmt.Errorf("no control-plane instance available to run kubectl")
+}
+
+// Run executes kubectl with the given arguments and returns its combined output
+func (r *KubectlRunner) Run(args string) (string, error) {
+	session, err := r.sshClient.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput("kubectl " + args)
+	if err != nil {
+		return string(output), fmt.Errorf("kubectl %s failed: %s, error: %w", args, strings.TrimSpace(string(output)), err)
+	}
+	return string(output), nil
+}
+
+// RunScript runs a bash script as root on the instance with the given arguments and returns its combined output
+func (r *KubectlRunner) RunScript(script string, args ...string) (string, error) {
+	session, err := r.sshClient.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = strings.NewReader(script)
+	output, err := session.CombinedOutput("sudo bash -s -- " + strings.Join(args, " "))
+	if err != nil {
+		return string(output), fmt.Errorf("script failed on %s: %s, error: %w", r.Host, strings.TrimSpace(string(output)), err)
+	}
+	return string(output), nil
+}
+
+// Close closes the underlying SSH connection
+func (r *KubectlRunner) Close() error {
+	return r.sshClient.Close()
+}
+
+// ControlPlaneHostnames returns the node names of the cluster's control-plane instances
+func ControlPlaneHostnames(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) ([]string, error) {
+	vmssName, err := getControlPlaneVMSSName(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+	hostnames, err := getInstanceNodeNames(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(hostnames))
+	for _, name := range hostnames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// getControlPlaneVMSSName returns the name of the VMSS tagged as the cluster's control-plane
+func getControlPlaneVMSSName(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	pager := vmssClient.NewListPager(cluster, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list VMSS: %w", err)
+		}
+		for _, vmss := range page.Value {
+			if vmss.Name == nil || vmss.Tags == nil {
+				continue
+			}
+			if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+				return *vmss.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no control-plane pool found in cluster '%s'", cluster)
+}
+
+// getInstanceNodeNames maps VMSS instance names to the node names their instances register with
+func getInstanceNodeNames(ctx context.Context, subscriptionID, cluster, vmssName string, cred *azidentity.DefaultAzureCredential) (map[string]string, error) {
+	vmssVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMSS VMs client: %w", err)
+	}
+	hostnames := make(map[string]string)
+	pager := vmssVMsClient.NewListPager(cluster, vmssName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get VMSS instances: %w", err)
+		}
+		for _, vm := range page.Value {
+			if vm.Name == nil {
+				continue
+			}
+			hostnames[*vm.Name] = instanceNodeName(*vm.Name)
+		}
+	}
+	return hostnames, nil
+}
+
+// controlPlaneInstancePattern matches the instance names cloud-init renames to control-plane-NNNNNN
+var controlPlaneInstancePattern = regexp.MustCompile(`control-plane-vmss_([0-9]+)`)
+
+// instanceNodeName returns the node name of a VMSS instance. It must match the hostname set by
+// cloud-init: control-plane instances (control-plane-vmss_1) become control-plane-000001 and all
+// other instances keep their instance name. Kubernetes lowercases the hostname for the node name.
+func instanceNodeName(instanceName string) string {
+	if m := controlPlaneInstancePattern.FindStringSubmatch(instanceName); m != nil {
+		if id, err := strconv.Atoi(m[1]); err == nil {
+			return fmt.Sprintf("control-plane-%06d", id)
+		}
+	}
+	return strings.ToLower(instanceName)
+}
@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+)
+
+const (
+	// PoolLabel is added to every node with the name of the k3a pool it belongs to
+	PoolLabel = "k3a.io/pool"
+
+	labelsTag = "k3a-labels"
+	taintsTag = "k3a-taints"
+)
+
+// nodeLabels validates k=v labels and returns them with the pool label added
+func nodeLabels(poolName string, labels []string) ([]string, error) {
+	result := []string{fmt.Sprintf("%s=%s", PoolLabel, poolName)}
+	for _, label := range labels {
+		key, _, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label '%s' (expected key=value)", label)
+		}
+		if key == PoolLabel {
+			return nil, fmt.Errorf("label '%s' is reserved for the pool name", PoolLabel)
+		}
+		if strings.Contains(label, ",") {
+			return nil, fmt.Errorf("invalid label '%s' (must not contain ',')", label)
+		}
+		result = append(result, label)
+	}
+	return result, nil
+}
+
+// validateTaints checks that taints are in key[=value]:Effect form
+func validateTaints(taints []string) error {
+	for _, taint := range taints {
+		keyValue, effect, ok := strings.Cut(taint, ":")
+		key, _, _ := strings.Cut(keyValue, "=")
+		if !ok || key == "" || strings.Contains(taint, ",") {
+			return fmt.Errorf("invalid taint '%s' (expected key=value:Effect)", taint)
+		}
+		switch effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			return fmt.Errorf("invalid taint effect '%s' in '%s' (must be NoSchedule, PreferNoSchedule or NoExecute)", effect, taint)
+		}
+	}
+	return nil
+}
+
+// getPoolNodeRegistration reads the labels and taints stored on a pool's VMSS tags
+func getPoolNodeRegistration(ctx context.Context, subscriptionID, cluster, vmssName string, cred *azidentity.DefaultAzureCredential) ([]string, []string, error) {
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	return splitTag(vmss.Tags, labelsTag), splitTag(vmss.Tags, taintsTag), nil
+}
+
+func splitTag(tags map[string]*string, name string) []string {
+	v, ok := tags[name]
+	if !ok || v == nil || *v == "" {
+		return nil
+	}
+	return strings.Split(*v, ",")
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	kstrings "github.com/jwilder/k3a/pkg/strings"
 	"github.com/rodaine/table"
 )
 
@@ -31,8 +30,11 @@ func ListNATMappings(args ListNATArgs) error {
 	}
 
 	// Get load balancer name
-	clusterHash := kstrings.UniqueString(args.Cluster)
-	lbName := fmt.Sprintf("k3alb%s", clusterHash)
+	network, err := getClusterNetwork(ctx, args.SubscriptionID, args.Cluster, cred)
+	if err != nil {
+		return err
+	}
+	lbName := network.APILBName
 
 	// Get load balancer public IP
 	lbPublicIP, err := vmssManager.GetLoadBalancerPublicIP(ctx, lbName)
@@ -0,0 +1,149 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/jwilder/k3a/pkg/cidr"
+	"github.com/jwilder/k3a/pkg/clusternet"
+	kstrings "github.com/jwilder/k3a/pkg/strings"
+)
+
+// clusterNetwork describes how a cluster's API server and SSH NAT pool are exposed
+type clusterNetwork struct {
+	Private       bool
+	APIServerName string // private API server DNS name, empty for public clusters
+	PublicLBName  string // load balancer providing outbound SNAT (and inbound access for public clusters)
+	APILBName     string // load balancer carrying the kubernetes-api rule and the SSH NAT pool
+	SubnetID      string // node subnet, which may live in a VNet outside the cluster resource group
+	DualStack     bool   // nodes get an IPv6 address and pods and services get IPv6 ranges
+	Egress        string // loadbalancer or nat-gateway
+	OutboundIPs   int    // public IPs used for egress
+	SNATPorts     int    // SNAT ports per instance allocated by the load balancer outbound rule
+}
+
+// getClusterNetwork reads the cluster's resource group tags to find out whether it is a private cluster
+func getClusterNetwork(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (clusterNetwork, error) {
+	lbName := fmt.Sprintf("k3alb%s", kstrings.UniqueString(cluster))
+	network := clusterNetwork{
+		PublicLBName: lbName,
+		APILBName:    lbName,
+		SubnetID:     fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/k3a-vnet/subnets/default", subscriptionID, cluster),
+		Egress:       clusternet.EgressLoadBalancer,
+		OutboundIPs:  5,
+		SNATPorts:    192,
+	}
+
+	rgClient, err := armresources.NewResourceGroupsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return network, fmt.Errorf("failed to create resource groups client: %w", err)
+	}
+	rg, err := rgClient.Get(ctx, cluster, nil)
+	if err != nil {
+		return network, fmt.Errorf("failed to get resource group '%s': %w", cluster, err)
+	}
+	// Clusters created before k3a-subnet-id was recorded always use k3a-vnet/default
+	if v, ok := rg.Tags[clusternet.SubnetIDTag]; ok && v != nil && *v != "" {
+		network.SubnetID = *v
+	}
+	if v, ok := rg.Tags[clusternet.IPFamilyTag]; ok && v != nil && *v == clusternet.IPFamilyDual {
+		network.DualStack = true
+	}
+	// Clusters created before egress was configurable use 5 outbound IPs with 192 ports per instance
+	if v, ok := rg.Tags[clusternet.EgressTag]; ok && v != nil && *v != "" {
+		network.Egress = *v
+	}
+	if v, ok := rg.Tags[clusternet.OutboundIPsTag]; ok && v != nil {
+		if n, err := strconv.Atoi(*v); err == nil {
+			network.OutboundIPs = n
+		}
+	}
+	if v, ok := rg.Tags[clusternet.SNATPortsTag]; ok && v != nil {
+		if n, err := strconv.Atoi(*v); err == nil {
+			network.SNATPorts = n
+		}
+	}
+	if v, ok := rg.Tags[clusternet.PrivateTag]; ok && v != nil && *v == "true" {
+		network.Private = true
+		network.APILBName = lbName + "-internal"
+		if name, ok := rg.Tags[clusternet.APIServerNameTag]; ok && name != nil {
+			network.APIServerName = *name
+		}
+	}
+	return network, nil
+}
+
+// ClusterCIDRs are the pod and service ranges of a cluster. The IPv6 ranges are empty on IPv4-only clusters.
+type ClusterCIDRs struct {
+	Pod       string
+	Service   string
+	PodV6     string
+	ServiceV6 string
+}
+
+// cidrs returns the pod and service ranges the cluster's kubeadm configuration uses
+func (n clusterNetwork) cidrs() ClusterCIDRs {
+	c := ClusterCIDRs{Pod: cidr.PodCIDR, Service: cidr.ServiceCIDR}
+	if n.DualStack {
+		c.PodV6, c.ServiceV6 = cidr.PodCIDRv6, cidr.ServiceCIDRv6
+	}
+	return c
+}
+
+// GetClusterCIDRs returns the cluster's pod and service ranges
+func GetClusterCIDRs(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (ClusterCIDRs, error) {
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return ClusterCIDRs{}, err
+	}
+	return network.cidrs(), nil
+}
+
+// ServiceNetwork describes where Services of type LoadBalancer are exposed: on the load balancer that
+// holds the node pools' backend pools, with public frontends, or private frontends in the node subnet
+// for private clusters
+type ServiceNetwork struct {
+	LBName   string
+	Private  bool
+	SubnetID string
+}
+
+// GetServiceNetwork returns where the cluster exposes Services of type LoadBalancer
+func GetServiceNetwork(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (ServiceNetwork, error) {
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return ServiceNetwork{}, err
+	}
+	return ServiceNetwork{LBName: network.APILBName, Private: network.Private, SubnetID: network.SubnetID}, nil
+}
+
+// GetNodeSubnet returns the subnet the cluster's nodes are placed in
+func GetNodeSubnet(ctx context.Context, subscriptionID, cluster string, cred *azidentity.DefaultAzureCredential) (*armnetwork.Subnet, error) {
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return nil, err
+	}
+	return getSubnet(ctx, network.SubnetID, cred)
+}
+
+// getSubnet fetches a subnet by resource ID
+func getSubnet(ctx context.Context, subnetID string, cred *azidentity.DefaultAzureCredential) (*armnetwork.Subnet, error) {
+	id, err := arm.ParseResourceID(subnetID)
+	if err != nil || id.Parent == nil {
+		return nil, fmt.Errorf("invalid subnet ID '%s'", subnetID)
+	}
+	subnetClient, err := armnetwork.NewSubnetsClient(id.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client: %w", err)
+	}
+	subnet, err := subnetClient.Get(ctx, id.ResourceGroupName, id.Parent.Name, id.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet: %w", err)
+	}
+	return &subnet.Subnet, nil
+}
@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/jwilder/k3a/pkg/protect"
+)
+
+type ProtectArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Name           string
+	Lock           bool
+}
+
+// Protect tags the pool VMSS k3a-protected=true and, with Lock, adds a CanNotDelete lock
+func Protect(args ProtectArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssID, err := getVMSSID(ctx, args.SubscriptionID, args.Cluster, args.Name, cred)
+	if err != nil {
+		return err
+	}
+	if err := protect.Set(ctx, args.SubscriptionID, vmssID, args.Lock, cred); err != nil {
+		return err
+	}
+	fmt.Printf("Pool '%s' is protected from deletion.\n", args.Name)
+	return nil
+}
+
+// Unprotect removes the protection tag and the k3a lock from the pool VMSS
+func Unprotect(args ProtectArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssID, err := getVMSSID(ctx, args.SubscriptionID, args.Cluster, args.Name, cred)
+	if err != nil {
+		return err
+	}
+	if err := protect.Clear(ctx, args.SubscriptionID, vmssID, cred); err != nil {
+		return err
+	}
+	fmt.Printf("Pool '%s' is no longer protected from deletion.\n", args.Name)
+	return nil
+}
+
+func getVMSSID(ctx context.Context, subscriptionID, cluster, poolName string, cred *azidentity.DefaultAzureCredential) (string, error) {
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmssName := poolName + "-vmss"
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	return *vmss.ID, nil
+}
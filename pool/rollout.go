@@ -0,0 +1,304 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+)
+
+const (
+	// rolloutTag is set on a pool's VMSS while its rollout is paused
+	rolloutTag    = "k3a-rollout"
+	rolloutPaused = "paused"
+
+	nodeReadyTimeout = 15 * time.Minute
+)
+
+type RolloutArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Name           string
+	MaxUnavailable int
+	MaxFailures    int
+	Reimage        bool
+}
+
+type rolloutInstance struct {
+	InstanceID string
+	NodeName   string
+}
+
+// Rollout replaces the instances of a pool that are not on the latest VMSS model, at most
+// MaxUnavailable at a time. Each node is drained, updated (or reimaged) and must become Ready
+// again before the next batch starts.
+func Rollout(args RolloutArgs) error {
+	subscriptionID := args.SubscriptionID
+	cluster := args.Cluster
+	if args.MaxUnavailable < 1 {
+		return fmt.Errorf("--max-unavailable must be greater than 0")
+	}
+	if args.MaxFailures < 1 {
+		return fmt.Errorf("--max-failures must be greater than 0")
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmssName := args.Name + "-vmss"
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	if v, ok := vmss.Tags[rolloutTag]; ok && v != nil && *v == rolloutPaused {
+		return fmt.Errorf("rollout of pool '%s' is paused, use 'k3a pool rollout resume' to continue", args.Name)
+	}
+
+	maxUnavailable := args.MaxUnavailable
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil && *v == "control-plane" {
+		// A reimaged control-plane instance boots with an empty disk and would not rejoin etcd
+		if args.Reimage {
+			return fmt.Errorf("--reimage is not supported for control-plane pools; roll them out in place, or delete and scale instances to replace them")
+		}
+		if maxUnavailable > 1 {
+			fmt.Println("Control-plane pools are rolled out one instance at a time.")
+			maxUnavailable = 1
+		}
+	}
+
+	instances, err := getOutdatedInstances(ctx, subscriptionID, cluster, vmssName, cred)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		fmt.Printf("All instances in pool '%s' are running the latest model.\n", args.Name)
+		return nil
+	}
+	fmt.Printf("Rolling out %d instance(s) in pool '%s' (max unavailable: %d)\n", len(instances), args.Name, maxUnavailable)
+
+	replaced := 0
+	failures := 0
+	for start := 0; start < len(instances); start += maxUnavailable {
+		paused, err := isRolloutPaused(ctx, vmssClient, cluster, vmssName)
+		if err != nil {
+			return err
+		}
+		if paused {
+			fmt.Printf("Rollout of pool '%s' paused after %d of %d instance(s).\n", args.Name, replaced, len(instances))
+			return nil
+		}
+
+		end := start + maxUnavailable
+		if end > len(instances) {
+			end = len(instances)
+		}
+		batch := instances[start:end]
+
+		failed, err := rolloutBatch(ctx, subscriptionID, cluster, args, batch, cred)
+		if err != nil {
+			return err
+		}
+		replaced += len(batch) - failed
+		if failed == 0 {
+			failures = 0
+			continue
+		}
+		failures += failed
+		if failures >= args.MaxFailures {
+			return fmt.Errorf("aborting rollout of pool '%s' after %d failure(s); %d of %d instance(s) replaced", args.Name, failures, replaced, len(instances))
+		}
+	}
+
+	fmt.Printf("Rollout of pool '%s' completed: %d instance(s) replaced.\n", args.Name, replaced)
+	return nil
+}
+
+// rolloutBatch drains, replaces and waits for the nodes in a batch, returning how many failed
+func rolloutBatch(ctx context.Context, subscriptionID, cluster string, args RolloutArgs, batch []rolloutInstance, cred *azidentity.DefaultAzureCredential) (int, error) {
+	var nodeNames []string
+	for _, instance := range batch {
+		nodeNames = append(nodeNames, instance.NodeName)
+	}
+
+	// Run kubectl from a control-plane instance that isn't part of this batch
+	kubectl, err := NewKubectlRunner(ctx, subscriptionID, cluster, cred, nodeNames)
+	if err != nil {
+		return 0, err
+	}
+	defer kubectl.Close()
+
+	failed := 0
+	var drained []rolloutInstance
+	for _, instance := range batch {
+		fmt.Printf("Draining node %s (instance %s)...\n", instance.NodeName, instance.InstanceID)
+		if _, err := kubectl.Run(fmt.Sprintf("drain %s --ignore-daemonsets --delete-emptydir-data --timeout=5m", instance.NodeName)); err != nil {
+			fmt.Printf("Warning: failed to drain node %s: %v\n", instance.NodeName, err)
+			if _, err := kubectl.Run("uncordon " + instance.NodeName); err != nil {
+				fmt.Printf("Warning: failed to uncordon node %s: %v\n", instance.NodeName, err)
+			}
+			failed++
+			continue
+		}
+		drained = append(drained, instance)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(drained))
+	for i, instance := range drained {
+		wg.Add(1)
+		go func(i int, instance rolloutInstance) {
+			defer wg.Done()
+			instanceArgs := UpdateInstanceArgs{
+				SubscriptionID: subscriptionID,
+				Cluster:        cluster,
+				PoolName:       args.Name,
+				InstanceID:     instance.InstanceID,
+			}
+			if args.Reimage {
+				errs[i] = ReimageInstance(instanceArgs)
+			} else {
+				errs[i] = UpdateInstance(instanceArgs)
+			}
+		}(i, instance)
+	}
+	wg.Wait()
+
+	for i, instance := range drained {
+		if errs[i] != nil {
+			// Leave the node cordoned so it doesn't receive work on an unknown model
+			fmt.Printf("Warning: failed to replace instance %s: %v\n", instance.InstanceID, errs[i])
+			failed++
+			continue
+		}
+		if err := waitForNodeReady(kubectl, instance.NodeName, nodeReadyTimeout); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			failed++
+			continue
+		}
+		if _, err := kubectl.Run("uncordon " + instance.NodeName); err != nil {
+			fmt.Printf("Warning: failed to uncordon node %s: %v\n", instance.NodeName, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Node %s is Ready\n", instance.NodeName)
+	}
+
+	return failed, nil
+}
+
+// waitForNodeReady polls the node's Ready condition until it is True or the timeout expires
+func waitForNodeReady(kubectl *KubectlRunner, nodeName string, timeout time.Duration) error {
+	start := time.Now()
+	for time.Since(start) < timeout {
+		output, err := kubectl.Run(fmt.Sprintf("get node %s -o jsonpath='{.status.conditions[?(@.type==\"Ready\")].status}'", nodeName))
+		if err == nil && strings.TrimSpace(output) == "True" {
+			return nil
+		}
+		fmt.Printf("Waiting for node %s to become Ready...\n", nodeName)
+		time.Sleep(15 * time.Second)
+	}
+	return fmt.Errorf("node %s did not become Ready within %v", nodeName, timeout)
+}
+
+// getOutdatedInstances returns the instances of a VMSS with LatestModelApplied=false
+func getOutdatedInstances(ctx context.Context, subscriptionID, cluster, vmssName string, cred *azidentity.DefaultAzureCredential) ([]rolloutInstance, error) {
+	vmssVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VMSS VMs client: %w", err)
+	}
+	var instances []rolloutInstance
+	pager := vmssVMsClient.NewListPager(cluster, vmssName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get VMSS instances: %w", err)
+		}
+		for _, vm := range page.Value {
+			if vm.InstanceID == nil || vm.Name == nil || vm.Properties == nil || vm.Properties.LatestModelApplied == nil || *vm.Properties.LatestModelApplied {
+				continue
+			}
+			instances = append(instances, rolloutInstance{
+				InstanceID: *vm.InstanceID,
+				NodeName:   instanceNodeName(*vm.Name),
+			})
+		}
+	}
+	return instances, nil
+}
+
+func isRolloutPaused(ctx context.Context, vmssClient *armcompute.VirtualMachineScaleSetsClient, cluster, vmssName string) (bool, error) {
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	v, ok := vmss.Tags[rolloutTag]
+	return ok && v != nil && *v == rolloutPaused, nil
+}
+
+// setRolloutTag sets or, when value is empty, removes the rollout tag on a pool's VMSS
+func setRolloutTag(ctx context.Context, subscriptionID, cluster, vmssName, value string, cred *azidentity.DefaultAzureCredential) error {
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmss, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	tags := vmss.Tags
+	if tags == nil {
+		tags = map[string]*string{}
+	}
+	if value == "" {
+		delete(tags, rolloutTag)
+	} else {
+		tags[rolloutTag] = to.Ptr(value)
+	}
+	poller, err := vmssClient.BeginUpdate(ctx, cluster, vmssName, armcompute.VirtualMachineScaleSetUpdate{Tags: tags}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start VMSS tag update: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to update VMSS tags: %w", err)
+	}
+	return nil
+}
+
+// PauseRollout asks a running rollout to stop after its current batch
+func PauseRollout(args RolloutArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	if err := setRolloutTag(ctx, args.SubscriptionID, args.Cluster, args.Name+"-vmss", rolloutPaused, cred); err != nil {
+		return err
+	}
+	fmt.Printf("Rollout of pool '%s' paused. It stops after the current batch.\n", args.Name)
+	return nil
+}
+
+// ResumeRollout clears the paused state and continues with the remaining outdated instances
+func ResumeRollout(args RolloutArgs) error {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	if err := setRolloutTag(ctx, args.SubscriptionID, args.Cluster, args.Name+"-vmss", "", cred); err != nil {
+		return err
+	}
+	fmt.Printf("Resuming rollout of pool '%s'.\n", args.Name)
+	return Rollout(args)
+}
@@ -46,6 +46,45 @@ func Scale(args ScalePoolArgs) error {
 	if vmss.SKU == nil {
 		return fmt.Errorf("VMSS '%s' has no SKU information", vmssName)
 	}
+	network, err := getClusterNetwork(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+	if err := checkSNATCapacity(ctx, subscriptionID, cluster, vmssName, int64(instanceCount), network, cred); err != nil {
+		return err
+	}
+	role := "worker"
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil {
+		role = *v
+	}
+	scaleUp := vmss.SKU.Capacity == nil || int64(instanceCount) > *vmss.SKU.Capacity
+	// New control-plane instances are joined over SSH once running; record which instances already exist
+	existing := make(map[string]bool)
+	if scaleUp && role == "control-plane" {
+		if err := ensureAPIBackendPools(ctx, subscriptionID, cluster, poolName, &vmss.VirtualMachineScaleSet, cred); err != nil {
+			return err
+		}
+		instances, err := NewVMSSManager(subscriptionID, cluster, cred).GetVMSSInstances(ctx, vmssName)
+		if err != nil {
+			return fmt.Errorf("failed to list VMSS instances: %w", err)
+		}
+		for _, instance := range instances {
+			existing[instance.Name] = true
+		}
+	} else if scaleUp {
+		// New instances join with the stored join command, which must still be valid when they boot
+		if err := refreshJoinIfExpiring(ctx, subscriptionID, cluster, role, cred); err != nil {
+			return err
+		}
+	}
+	if !scaleUp && role == "control-plane" {
+		// Members must leave etcd before their VMs go away, so they cannot be removed by a capacity change
+		if err := removeControlPlaneInstances(ctx, subscriptionID, cluster, vmssName, instanceCount, vmssClient, cred); err != nil {
+			return err
+		}
+		fmt.Printf("Pool '%s' scaled to %d instances successfully in cluster '%s'.\n", poolName, instanceCount, cluster)
+		return nil
+	}
 	poller, err := vmssClient.BeginUpdate(ctx, cluster, vmssName, armcompute.VirtualMachineScaleSetUpdate{
 		SKU: &armcompute.SKU{
 			Capacity: to.Ptr[int64](int64(instanceCount)),
@@ -58,6 +97,11 @@ func Scale(args ScalePoolArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to scale VMSS: %w", err)
 	}
+	if scaleUp && role == "control-plane" {
+		if err := joinNewControlPlaneInstances(ctx, subscriptionID, cluster, poolName, existing, instanceCount, cred); err != nil {
+			return err
+		}
+	}
 	fmt.Printf("Pool '%s' scaled to %d instances successfully in cluster '%s'.\n", poolName, instanceCount, cluster)
 	return nil
 }
@@ -0,0 +1,133 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
+	"github.com/jwilder/k3a/pkg/cidr"
+	"github.com/jwilder/k3a/pkg/clusternet"
+)
+
+// createPoolSubnet carves a dedicated subnet for the pool out of the address space of the VNet holding the
+// cluster's node subnet. request is a prefix length such as "/22" or an explicit CIDR. Existing subnets and
+// the pod and service CIDRs are treated as allocated. The cluster NSG, and NAT gateway if the cluster uses one,
+// are attached to the new subnet.
+func createPoolSubnet(ctx context.Context, subscriptionID, cluster, poolName, request string, network clusterNetwork, cred *azidentity.DefaultAzureCredential) (*armnetwork.Subnet, error) {
+	clusterSubnetID, err := arm.ParseResourceID(network.SubnetID)
+	if err != nil || clusterSubnetID.Parent == nil {
+		return nil, fmt.Errorf("invalid cluster subnet ID '%s'", network.SubnetID)
+	}
+	vnetID := clusterSubnetID.Parent
+
+	vnetClient, err := armnetwork.NewVirtualNetworksClient(vnetID.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VNet client: %w", err)
+	}
+	vnet, err := vnetClient.Get(ctx, vnetID.ResourceGroupName, vnetID.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VNet '%s': %w", vnetID.Name, err)
+	}
+	if vnet.Properties == nil || vnet.Properties.AddressSpace == nil {
+		return nil, fmt.Errorf("VNet '%s' has no address space", vnetID.Name)
+	}
+
+	subnetName := poolName + "-subnet"
+	used := []string{cidr.PodCIDR, cidr.ServiceCIDR}
+	if network.DualStack {
+		used = append(used, cidr.PodCIDRv6, cidr.ServiceCIDRv6)
+	}
+	for _, subnet := range vnet.Properties.Subnets {
+		if subnet.Properties == nil {
+			continue
+		}
+		prefixes := clusternet.SubnetPrefixes(subnet.Properties)
+		// Re-running pool create reuses the pool's existing subnet
+		if subnet.Name != nil && *subnet.Name == subnetName {
+			fmt.Printf("Using existing subnet '%s' (%s)\n", subnetName, strings.Join(prefixes, ", "))
+			return subnet, nil
+		}
+		used = append(used, prefixes...)
+	}
+	var spaces, spacesV6 []string
+	for _, prefix := range vnet.Properties.AddressSpace.AddressPrefixes {
+		if cidr.IsIPv6(*prefix) {
+			spacesV6 = append(spacesV6, *prefix)
+		} else {
+			spaces = append(spaces, *prefix)
+		}
+	}
+
+	prefix, err := cidr.Allocate(spaces, request, used)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate subnet for pool '%s': %w", poolName, err)
+	}
+	properties := &armnetwork.SubnetPropertiesFormat{
+		AddressPrefix: to.Ptr(prefix),
+	}
+	allocated := prefix
+	if network.DualStack {
+		// Azure IPv6 subnets are always a /64
+		prefixV6, err := cidr.Allocate(spacesV6, "/64", used)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate IPv6 subnet for pool '%s': %w", poolName, err)
+		}
+		properties = &armnetwork.SubnetPropertiesFormat{
+			AddressPrefixes: []*string{to.Ptr(prefix), to.Ptr(prefixV6)},
+		}
+		allocated = prefix + ", " + prefixV6
+	}
+
+	nsgID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkSecurityGroups/k3a-nsg", subscriptionID, cluster)
+	subnetClient, err := armnetwork.NewSubnetsClient(vnetID.SubscriptionID, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet client: %w", err)
+	}
+	properties.NetworkSecurityGroup = &armnetwork.SecurityGroup{ID: to.Ptr(nsgID)}
+	if network.Egress == clusternet.EgressNATGateway {
+		properties.NatGateway = &armnetwork.SubResource{ID: to.Ptr(clusternet.NATGatewayID(subscriptionID, cluster))}
+	}
+	poller, err := subnetClient.BeginCreateOrUpdate(ctx, vnetID.ResourceGroupName, vnetID.Name, subnetName, armnetwork.Subnet{
+		Properties: properties,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subnet '%s': %w", subnetName, err)
+	}
+	resp, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete subnet creation: %w", err)
+	}
+	fmt.Printf("Created subnet '%s' (%s) for pool '%s'\n", subnetName, allocated, poolName)
+	return &resp.Subnet, nil
+}
+
+// deletePoolSubnet removes a subnet created by createPoolSubnet, ignoring subnets that are already gone
+func deletePoolSubnet(ctx context.Context, subnetID string, cred *azidentity.DefaultAzureCredential) error {
+	id, err := arm.ParseResourceID(subnetID)
+	if err != nil || id.Parent == nil {
+		return fmt.Errorf("invalid subnet ID '%s'", subnetID)
+	}
+	subnetClient, err := armnetwork.NewSubnetsClient(id.SubscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create subnet client: %w", err)
+	}
+	poller, err := subnetClient.BeginDelete(ctx, id.ResourceGroupName, id.Parent.Name, id.Name, nil)
+	if err == nil {
+		_, err = poller.PollUntilDone(ctx, nil)
+	}
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == 404 {
+			return nil
+		}
+		return fmt.Errorf("failed to delete subnet '%s': %w", id.Name, err)
+	}
+	fmt.Printf("Subnet '%s' deleted.\n", id.Name)
+	return nil
+}
@@ -3,11 +3,199 @@ package pool
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
+	"github.com/rodaine/table"
 )
 
+type UpdatePoolArgs struct {
+	SubscriptionID string
+	Cluster        string
+	Name           string
+	SKU            string
+	OSDiskSizeGB   int
+	MSIIDs         []string
+	K8sVersion     string
+	ImageID        string // Pre-baked image to move the pool to; its Kubernetes version must match K8sVersion
+}
+
+// Update patches the VMSS model of an existing pool. Running instances keep the old model until
+// they are updated or reimaged, so the instances that are behind are reported at the end.
+func Update(args UpdatePoolArgs) error {
+	subscriptionID := args.SubscriptionID
+	cluster := args.Cluster
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	ctx := context.Background()
+	vmssClient, err := armcompute.NewVirtualMachineScaleSetsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS client: %w", err)
+	}
+	vmssName := args.Name + "-vmss"
+	resp, err := vmssClient.Get(ctx, cluster, vmssName, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get VMSS '%s': %w", vmssName, err)
+	}
+	vmss := resp.VirtualMachineScaleSet
+	if vmss.Properties == nil || vmss.Properties.VirtualMachineProfile == nil {
+		return fmt.Errorf("VMSS '%s' has no virtual machine profile", vmssName)
+	}
+	profile := vmss.Properties.VirtualMachineProfile
+
+	role := "worker"
+	if v, ok := vmss.Tags["k3a"]; ok && v != nil {
+		role = *v
+	}
+
+	if args.SKU != "" {
+		if vmss.SKU == nil {
+			vmss.SKU = &armcompute.SKU{Tier: to.Ptr("Standard")}
+		}
+		vmss.SKU.Name = to.Ptr(args.SKU)
+	}
+
+	if args.OSDiskSizeGB > 0 && profile.StorageProfile != nil && profile.StorageProfile.OSDisk != nil {
+		osDisk := profile.StorageProfile.OSDisk
+		if osDisk.DiffDiskSettings != nil {
+			return fmt.Errorf("OS disk size can't be changed for pools with ephemeral OS disks")
+		}
+		if osDisk.DiskSizeGB != nil && int(*osDisk.DiskSizeGB) > args.OSDiskSizeGB {
+			return fmt.Errorf("OS disk size can't be reduced (current %dGB, requested %dGB)", *osDisk.DiskSizeGB, args.OSDiskSizeGB)
+		}
+		osDisk.DiskSizeGB = to.Ptr(int32(args.OSDiskSizeGB))
+	}
+
+	msi, err := getManagedIdentity(ctx, subscriptionID, cluster, cred)
+	if err != nil {
+		return err
+	}
+
+	if len(args.MSIIDs) > 0 {
+		if vmss.Identity == nil {
+			vmss.Identity = &armcompute.VirtualMachineScaleSetIdentity{
+				Type: to.Ptr(armcompute.ResourceIdentityTypeUserAssigned),
+			}
+		}
+		if vmss.Identity.UserAssignedIdentities == nil {
+			vmss.Identity.UserAssignedIdentities = map[string]*armcompute.VirtualMachineScaleSetIdentityUserAssignedIdentitiesValue{}
+		}
+		for id, v := range buildUserAssignedIdentities(*msi.ID, args.MSIIDs) {
+			if _, ok := vmss.Identity.UserAssignedIdentities[id]; !ok {
+				vmss.Identity.UserAssignedIdentities[id] = v
+			}
+		}
+	}
+
+	// The VMSS GET response never includes custom data, so it is always regenerated to keep
+	// it in sync with the rest of the model.
+	currentVersion := ""
+	if v, ok := vmss.Tags[K8sVersionTag]; ok && v != nil {
+		currentVersion = *v
+	}
+	k8sVersion := args.K8sVersion
+	prebakedImage := profile.StorageProfile != nil && profile.StorageProfile.ImageReference != nil && profile.StorageProfile.ImageReference.ID != nil
+	if args.ImageID != "" {
+		// New and reimaged instances boot the new image, which only runs the version baked into it
+		if k8sVersion, err = checkImageK8sVersion(ctx, args.ImageID, args.K8sVersion, cred); err != nil {
+			return err
+		}
+		if profile.StorageProfile == nil {
+			profile.StorageProfile = &armcompute.VirtualMachineScaleSetStorageProfile{}
+		}
+		profile.StorageProfile.ImageReference = &armcompute.ImageReference{ID: to.Ptr(args.ImageID)}
+		prebakedImage = true
+	} else if prebakedImage && k8sVersion != "" && strings.TrimPrefix(k8sVersion, "v") != strings.TrimPrefix(currentVersion, "v") {
+		// Nodes from a pre-baked image never install Kubernetes, so only a new image changes the version
+		return fmt.Errorf("pool '%s' runs a pre-baked image with Kubernetes %s; pass --image-id with an image built for %s", args.Name, currentVersion, k8sVersion)
+	}
+	if k8sVersion == "" {
+		k8sVersion = currentVersion
+	}
+	if k8sVersion == "" {
+		return fmt.Errorf("pool '%s' has no recorded Kubernetes version, --k8s-version is required", args.Name)
+	}
+	customDataB64, err := buildCustomData(ctx, subscriptionID, cluster, nodeConfig{
+		Role:          role,
+		K8sVersion:    k8sVersion,
+		PrebakedImage: prebakedImage,
+		Labels:        splitTag(vmss.Tags, labelsTag),
+		Taints:        splitTag(vmss.Tags, taintsTag),
+		MountDataDisk: vmss.Tags[dataDiskMountTag] != nil && *vmss.Tags[dataDiskMountTag] == "true",
+	}, msi, cred)
+	if err != nil {
+		return err
+	}
+	if profile.OSProfile != nil {
+		profile.OSProfile.CustomData = to.Ptr(customDataB64)
+	}
+	if vmss.Tags == nil {
+		vmss.Tags = map[string]*string{}
+	}
+	vmss.Tags[K8sVersionTag] = to.Ptr(k8sVersion)
+
+	poller, err := vmssClient.BeginCreateOrUpdate(ctx, cluster, vmssName, vmss, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start VMSS update: %w", err)
+	}
+	if _, err := poller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("VMSS update failed: %w", err)
+	}
+	fmt.Printf("Pool '%s' model updated in cluster '%s'.\n", args.Name, cluster)
+
+	return printOutdatedInstances(ctx, subscriptionID, cluster, args.Name, cred)
+}
+
+// printOutdatedInstances lists the instances of a pool that are not running the latest VMSS model
+func printOutdatedInstances(ctx context.Context, subscriptionID, cluster, poolName string, cred *azidentity.DefaultAzureCredential) error {
+	vmssVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(subscriptionID, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create VMSS VMs client: %w", err)
+	}
+	vmssName := poolName + "-vmss"
+	pager := vmssVMsClient.NewListPager(cluster, vmssName, nil)
+	tbl := table.New("ID", "NAME", "STATUS")
+	outdated := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get VMSS instances: %w", err)
+		}
+		for _, vm := range page.Value {
+			if vm.Properties == nil || vm.Properties.LatestModelApplied == nil || *vm.Properties.LatestModelApplied {
+				continue
+			}
+			id := "-"
+			if vm.InstanceID != nil {
+				id = *vm.InstanceID
+			}
+			name := "-"
+			if vm.Name != nil {
+				name = *vm.Name
+			}
+			status := "-"
+			if vm.Properties.ProvisioningState != nil {
+				status = *vm.Properties.ProvisioningState
+			}
+			tbl.AddRow(id, name, status)
+			outdated++
+		}
+	}
+	if outdated == 0 {
+		fmt.Println("All instances are running the latest model.")
+		return nil
+	}
+	fmt.Printf("%d instance(s) are not running the latest model (LatestModelApplied=false):\n", outdated)
+	tbl.Print()
+	fmt.Println("Use 'k3a pool instance update' or 'k3a pool instance reimage' to apply the new model.")
+	return nil
+}
+
 type UpdateInstanceArgs struct {
 	SubscriptionID string
 	Cluster        string
@@ -306,7 +306,8 @@ func (vm *VMSSManager) GetVMSSNATPortMappings(ctx context.Context, vmssName, lbN
 	return portMappings, nil
 }
 
-// GetLoadBalancerPublicIP gets the public IP of the load balancer for SSH access via NAT rules
+// GetLoadBalancerPublicIP gets the public IP of the load balancer for SSH access via NAT rules,
+// or the frontend's private IP for an internal load balancer
 func (vm *VMSSManager) GetLoadBalancerPublicIP(ctx context.Context, lbName string) (string, error) {
 	lbClient, err := armnetwork.NewLoadBalancersClient(vm.subscriptionID, vm.credential, nil)
 	if err != nil {
@@ -348,5 +349,12 @@ func (vm *VMSSManager) GetLoadBalancerPublicIP(ctx context.Context, lbName strin
 		}
 	}
 
+	// Internal load balancers (private clusters) are reached on their private frontend IP
+	for _, frontendIP := range lb.Properties.FrontendIPConfigurations {
+		if frontendIP.Properties != nil && frontendIP.Properties.PrivateIPAddress != nil {
+			return *frontendIP.Properties.PrivateIPAddress, nil
+		}
+	}
+
 	return "", fmt.Errorf("no public IP address found for load balancer")
 }